@@ -6,11 +6,17 @@ inicijalizacije, konekciju s bazom podataka, repozitorija, servisa..
 */
 
 import (
+	"context"
+	"crypto/rand"
 	"log"
+	"os"
 	"server/db"
 	"server/internal/user"
 	"server/internal/user/websocket"
 	"server/router"
+	"server/storage"
+	"server/util"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -21,23 +27,99 @@ func main() {
 	if err != nil {
 		log.Println("No .env file found")
 	}
+
+	// Lokalno spremište za avatare (poslužuje ga router pod /media)
+	mediaDir := envOrDefault("MEDIA_DIR", "./media")
+	mediaURL := envOrDefault("MEDIA_BASE_URL", "http://localhost:8080/media")
+	media, err := storage.NewLocalStorage(mediaDir, mediaURL)
+	if err != nil {
+		log.Fatalf("could not initialize media storage: %s", err)
+	}
+
+	// Privici se spremaju izvan /media i preuzimaju samo potpisanim linkovima s rokom trajanja
+	attachments, err := storage.NewLocalStorage(envOrDefault("ATTACHMENTS_DIR", "./attachments"), "")
+	if err != nil {
+		log.Fatalf("could not initialize attachment storage: %s", err)
+	}
+	attachmentURLs := storage.NewURLSigner(envOrDefault("API_BASE_URL", "http://localhost:8080"), attachmentSecret(), time.Hour)
+
 	dbConnection, err := db.NewDatabase() // Otvara bazu i vraća instancu na bazu
 	if err != nil {
 		log.Fatalf("could not initialize database connection: %s", err)
 	}
-	defer dbConnection.Close()                                 // Osiguravamo zatvaranje baze nakon završetka rada
-	userRepository := user.NewRepository(dbConnection.GetDB()) // Omogućava rad s bazom
-	userService := user.NewService(userRepository)             // Omogućava interakciju s bazom
-	userHandler := user.NewHandler(userService)                // Omogućava HTTP zahtjeve koji koriste service
+	defer dbConnection.Close()                                                 // Osiguravamo zatvaranje baze nakon završetka rada
+	userRepository := user.NewRepository(dbConnection.GetDB())                 // Omogućava rad s bazom
+	attempts := user.NewMemoryAttemptStore()                                   // Brojači neuspjelih prijava (brute-force zaštita)
+	passwords := util.NewPasswordPolicyFromEnv()                               // Pravila za nove lozinke
+	user.SetSecretKey(jwtSecret())                                             // Ključ za potpisivanje JWT tokena
+	util.SetArgon2Params(util.Argon2ParamsFromEnv())                           // Parametri za hashiranje lozinki
+	userService := user.NewService(userRepository, attempts, passwords, media) // Omogućava interakciju s bazom
+	userHandler := user.NewHandler(userService)                                // Omogućava HTTP zahtjeve koji koriste service
+
+	// SSO prijava putem OIDC pružatelja konfiguriranih u .env
+	oidcHandler := user.NewOIDCHandler(userService, user.NewOIDCProvidersFromEnv())
 
 	hub := websocket.NewHub()
-	webSocketHandler := websocket.NewHandler(hub)
+	roomRepository := websocket.NewRepository(dbConnection.GetDB()) // Sobe i poruke u bazi
+	roomService := websocket.NewService(roomRepository, userService, attachments, attachmentURLs)
+	webSocketHandler := websocket.NewHandler(hub, userService, roomService)
+	if err := webSocketHandler.LoadRooms(context.Background()); err != nil {
+		log.Fatalf("could not load rooms: %s", err)
+	}
+	// Hub sprema vrijeme zadnje aktivnosti kad se korisnik odspoji
+	hub.SetPresenceStore(userService)
 	go hub.Run() // Pokreće hub u pozadini
 
+	// Izvoz i brisanje računa obuhvaćaju i podatke koje drže hub i baza soba
+	userService.AddDataProvider(webSocketHandler)
+	go userService.RunAccountPurge(time.Hour)    // Trajno briše račune kojima je istekao rok za odustajanje
+	go roomService.RunAttachmentPurge(time.Hour) // Briše privitke koji nisu poslani u poruci unutar roka
+
+	// Hub odmah prestaje isporučivati poruke između blokiranih korisnika i prati kontakte i prisutnost
+	userService.AddBlockListener(webSocketHandler)
+	userService.AddContactListener(webSocketHandler)
+	userService.SetPresence(webSocketHandler)
+
 	// Inicijalizacija ruta
-	router.InitRouter(userHandler, webSocketHandler)
+	router.InitRouter(userHandler, oidcHandler, webSocketHandler, media.Dir())
 	log.Println("Router initialized, starting server...")
 	if err := router.Start("0.0.0.0:8080"); err != nil {
 		log.Fatalf("server failed to start: %v", err)
 	}
 }
+
+// envOrDefault vraća vrijednost .env varijable ili zadanu vrijednost ako nije postavljena.
+func envOrDefault(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// jwtSecret vraća ključ za potpisivanje JWT tokena (JWT_SECRET).
+// Ako ključ nije postavljen, generira se nasumični pa se korisnici nakon restarta moraju ponovno prijaviti.
+func jwtSecret() []byte {
+	if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+	log.Println("JWT_SECRET nije postavljen, koristi se nasumični ključ")
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		log.Fatalf("could not generate JWT secret: %s", err)
+	}
+	return secret
+}
+
+// attachmentSecret vraća ključ za potpisivanje linkova privitaka (ATTACHMENT_URL_SECRET).
+// Ako ključ nije postavljen, generira se nasumični pa linkovi prestaju vrijediti nakon restarta.
+func attachmentSecret() []byte {
+	if secret := os.Getenv("ATTACHMENT_URL_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+	log.Println("ATTACHMENT_URL_SECRET nije postavljen, koristi se nasumični ključ")
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		log.Fatalf("could not generate attachment URL secret: %s", err)
+	}
+	return secret
+}
@@ -0,0 +1,13 @@
+ALTER TABLE "users" ADD COLUMN "totp_secret" varchar;
+ALTER TABLE "users" ADD COLUMN "totp_enabled" boolean NOT NULL DEFAULT false;
+-- Zadnji prihvaćeni TOTP korak; kod istog ili starijeg koraka se odbija (zaštita od ponovnog korištenja)
+ALTER TABLE "users" ADD COLUMN "totp_last_step" bigint;
+
+CREATE TABLE "user_recovery_codes" (
+    "id" bigserial PRIMARY KEY,
+    "user_id" bigint NOT NULL REFERENCES "users" ("id") ON DELETE CASCADE,
+    "code_hash" varchar NOT NULL,
+    "used_at" timestamptz
+);
+
+CREATE INDEX "user_recovery_codes_user_id_idx" ON "user_recovery_codes" ("user_id");
@@ -0,0 +1,10 @@
+CREATE TABLE "user_identities" (
+    "id" bigserial PRIMARY KEY,
+    "user_id" bigint NOT NULL REFERENCES "users" ("id") ON DELETE CASCADE,
+    "provider" varchar NOT NULL,
+    "subject" varchar NOT NULL,
+    "created_at" timestamptz NOT NULL DEFAULT now(),
+    UNIQUE ("provider", "subject")
+);
+
+CREATE INDEX "user_identities_user_id_idx" ON "user_identities" ("user_id");
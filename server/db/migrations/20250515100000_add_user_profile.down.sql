@@ -0,0 +1,4 @@
+ALTER TABLE "users" DROP COLUMN IF EXISTS "created_at";
+ALTER TABLE "users" DROP COLUMN IF EXISTS "status_text";
+ALTER TABLE "users" DROP COLUMN IF EXISTS "bio";
+ALTER TABLE "users" DROP COLUMN IF EXISTS "display_name";
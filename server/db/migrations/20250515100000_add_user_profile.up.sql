@@ -0,0 +1,4 @@
+ALTER TABLE "users" ADD COLUMN "display_name" varchar NOT NULL DEFAULT '';
+ALTER TABLE "users" ADD COLUMN "bio" text NOT NULL DEFAULT '';
+ALTER TABLE "users" ADD COLUMN "status_text" varchar NOT NULL DEFAULT '';
+ALTER TABLE "users" ADD COLUMN "created_at" timestamptz NOT NULL DEFAULT now();
@@ -0,0 +1,5 @@
+ALTER TABLE "users" ADD COLUMN "token_version" integer NOT NULL DEFAULT 0;
+ALTER TABLE "users" ADD COLUMN "deletion_scheduled_at" timestamptz;
+
+CREATE INDEX "users_deletion_scheduled_at_idx" ON "users" ("deletion_scheduled_at")
+    WHERE "deletion_scheduled_at" IS NOT NULL;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS "users_email_lower_key";
+DROP INDEX IF EXISTS "users_username_lower_key";
+-- Razriješeni duplikati se ne vraćaju; izvorne vrijednosti ostaju samo u ovoj tablici do njenog brisanja
+DROP TABLE IF EXISTS "user_handle_conflicts";
@@ -0,0 +1,45 @@
+-- Postojeći duplikati (ista imena/emailovi koji se razlikuju samo u velikim/malim slovima) razrješavaju se
+-- prije kreiranja indeksa: najstariji račun zadržava vrijednost, a ostali dobivaju jedinstvenu zamjenu.
+-- Izvorne vrijednosti spremaju se u "user_handle_conflicts" kako bi podrška mogla javiti korisnicima.
+CREATE TABLE "user_handle_conflicts" (
+    "user_id" bigint NOT NULL REFERENCES "users" ("id") ON DELETE CASCADE,
+    "field" varchar NOT NULL, -- 'username' ili 'email'
+    "original_value" varchar NOT NULL,
+    "resolved_at" timestamptz NOT NULL DEFAULT now()
+);
+
+-- Korisničko ime dobiva sufiks "-<id>" (skraćeno na najviše 32 znaka)
+WITH "duplicates" AS (
+    SELECT "id", "username" FROM (
+        SELECT "id", "username", row_number() OVER (PARTITION BY lower("username") ORDER BY "id") AS "n"
+        FROM "users"
+    ) AS "ranked"
+    WHERE "n" > 1
+), "logged" AS (
+    INSERT INTO "user_handle_conflicts" ("user_id", "field", "original_value")
+    SELECT "id", 'username', "username" FROM "duplicates"
+)
+UPDATE "users" AS u
+SET "username" = left(d."username", 32 - length(d."id"::text) - 1) || '-' || d."id"
+FROM "duplicates" AS d
+WHERE u."id" = d."id";
+
+-- Email se ne može pogoditi pa se zamjenjuje nedostavljivom adresom (.invalid je rezervirana domena)
+WITH "duplicates" AS (
+    SELECT "id", "email" FROM (
+        SELECT "id", "email", row_number() OVER (PARTITION BY lower("email") ORDER BY "id") AS "n"
+        FROM "users"
+    ) AS "ranked"
+    WHERE "n" > 1
+), "logged" AS (
+    INSERT INTO "user_handle_conflicts" ("user_id", "field", "original_value")
+    SELECT "id", 'email', "email" FROM "duplicates"
+)
+UPDATE "users" AS u
+SET "email" = 'duplicate-' || d."id" || '@email.invalid'
+FROM "duplicates" AS d
+WHERE u."id" = d."id";
+
+-- Korisnička imena i emailovi jedinstveni su bez obzira na velika/mala slova
+CREATE UNIQUE INDEX "users_username_lower_key" ON "users" (lower("username"));
+CREATE UNIQUE INDEX "users_email_lower_key" ON "users" (lower("email"));
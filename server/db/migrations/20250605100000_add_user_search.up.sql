@@ -0,0 +1,7 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+ALTER TABLE "users" ADD COLUMN "discoverable" boolean NOT NULL DEFAULT true;
+
+-- Trigram indeksi pokrivaju i prefiksne (LIKE 'abc%') i fuzzy (%) upite
+CREATE INDEX "users_username_trgm_idx" ON "users" USING gin (lower("username") gin_trgm_ops);
+CREATE INDEX "users_display_name_trgm_idx" ON "users" USING gin (lower("display_name") gin_trgm_ops);
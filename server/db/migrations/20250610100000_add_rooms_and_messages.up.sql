@@ -0,0 +1,29 @@
+CREATE TABLE "rooms" (
+    "id" varchar PRIMARY KEY,
+    "name" varchar NOT NULL DEFAULT '',
+    "kind" varchar NOT NULL DEFAULT 'group', -- 'group' ili 'direct'
+    "created_at" timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE "room_members" (
+    "room_id" varchar NOT NULL REFERENCES "rooms" ("id") ON DELETE CASCADE,
+    "user_id" bigint NOT NULL REFERENCES "users" ("id") ON DELETE CASCADE,
+    "last_read_message_id" bigint NOT NULL DEFAULT 0,
+    "joined_at" timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY ("room_id", "user_id")
+);
+
+CREATE INDEX "room_members_user_id_idx" ON "room_members" ("user_id");
+
+CREATE TABLE "messages" (
+    "id" bigserial PRIMARY KEY,
+    "room_id" varchar NOT NULL REFERENCES "rooms" ("id") ON DELETE CASCADE,
+    "user_id" bigint REFERENCES "users" ("id") ON DELETE SET NULL,
+    "username" varchar NOT NULL,
+    "type" varchar NOT NULL DEFAULT 'chat',
+    "content" text NOT NULL,
+    "created_at" timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX "messages_room_id_id_idx" ON "messages" ("room_id", "id");
+CREATE INDEX "messages_user_id_idx" ON "messages" ("user_id");
@@ -0,0 +1,20 @@
+-- Zahtjevi za kontakt (requester je poslao zahtjev addresseeju)
+CREATE TABLE "contact_requests" (
+    "requester_id" bigint NOT NULL REFERENCES "users" ("id") ON DELETE CASCADE,
+    "addressee_id" bigint NOT NULL REFERENCES "users" ("id") ON DELETE CASCADE,
+    "created_at" timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY ("requester_id", "addressee_id")
+);
+
+CREATE INDEX "contact_requests_addressee_id_idx" ON "contact_requests" ("addressee_id");
+
+-- Prihvaćeni kontakti, spremljeni u oba smjera
+CREATE TABLE "contacts" (
+    "user_id" bigint NOT NULL REFERENCES "users" ("id") ON DELETE CASCADE,
+    "contact_id" bigint NOT NULL REFERENCES "users" ("id") ON DELETE CASCADE,
+    "created_at" timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY ("user_id", "contact_id")
+);
+
+-- Samo kontakti smiju korisniku slati DM i pozivati ga
+ALTER TABLE "users" ADD COLUMN "contacts_only" boolean NOT NULL DEFAULT false;
@@ -0,0 +1,3 @@
+-- Zadnja aktivnost (kraj zadnje WebSocket veze) i ručno postavljen status prisutnosti
+ALTER TABLE "users" ADD COLUMN "last_seen_at" timestamptz;
+ALTER TABLE "users" ADD COLUMN "presence_status" varchar NOT NULL DEFAULT 'online'; -- 'online', 'away' ili 'dnd'
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS "messages_room_id_user_id_client_msg_id_key";
+ALTER TABLE "messages" DROP COLUMN IF EXISTS "client_msg_id";
@@ -0,0 +1,6 @@
+-- ID koji klijent dodjeljuje poruci — ponovno poslana poruka (npr. nakon reconnecta) ne sprema se dvaput
+ALTER TABLE "messages" ADD COLUMN "client_msg_id" varchar;
+
+-- Jedinstven je unutar sobe i autora; neprijavljeni autori (user_id NULL) dijele ključ 0
+CREATE UNIQUE INDEX "messages_room_id_user_id_client_msg_id_key" ON "messages" ("room_id", (coalesce("user_id", 0)), "client_msg_id")
+    WHERE "client_msg_id" IS NOT NULL;
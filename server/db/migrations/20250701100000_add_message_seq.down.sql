@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS "messages_room_id_seq_key";
+ALTER TABLE "messages" DROP COLUMN IF EXISTS "seq";
+ALTER TABLE "room_members" DROP COLUMN IF EXISTS "read_seq";
+ALTER TABLE "rooms" DROP COLUMN IF EXISTS "last_seq";
@@ -0,0 +1,14 @@
+-- Redni broj poruke unutar sobe (seq) — klijent nakon reconnecta traži poruke nakon zadnjeg primljenog seq
+ALTER TABLE "rooms" ADD COLUMN "last_seq" bigint NOT NULL DEFAULT 0;
+ALTER TABLE "messages" ADD COLUMN "seq" bigint NOT NULL DEFAULT 0;
+
+UPDATE "messages" m SET "seq" = s."seq"
+FROM (SELECT "id", row_number() OVER (PARTITION BY "room_id" ORDER BY "id") AS "seq" FROM "messages") s
+WHERE m."id" = s."id";
+
+UPDATE "rooms" r SET "last_seq" = coalesce((SELECT max("seq") FROM "messages" WHERE "room_id" = r."id"), 0);
+
+-- Seq zadnjeg pomaka oznake pročitanosti člana — oznake se nakon reconnecta šalju ponovno
+ALTER TABLE "room_members" ADD COLUMN "read_seq" bigint NOT NULL DEFAULT 0;
+
+CREATE UNIQUE INDEX "messages_room_id_seq_key" ON "messages" ("room_id", "seq");
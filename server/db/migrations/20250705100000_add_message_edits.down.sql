@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS "message_edits";
+DROP INDEX IF EXISTS "messages_room_id_update_seq_idx";
+ALTER TABLE "messages" DROP COLUMN IF EXISTS "update_seq";
+ALTER TABLE "messages" DROP COLUMN IF EXISTS "deleted_at";
+ALTER TABLE "messages" DROP COLUMN IF EXISTS "edited_at";
+ALTER TABLE "room_members" DROP COLUMN IF EXISTS "role";
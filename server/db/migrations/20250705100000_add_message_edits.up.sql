@@ -0,0 +1,21 @@
+-- Uloga člana sobe: autor sobe je moderator i smije uređivati i brisati tuđe poruke
+ALTER TABLE "room_members" ADD COLUMN "role" varchar NOT NULL DEFAULT 'member'; -- 'member' ili 'moderator'
+
+-- Uređene poruke pamte vrijeme zadnje izmjene, a obrisane ostaju kao zapis bez sadržaja (tombstone)
+ALTER TABLE "messages" ADD COLUMN "edited_at" timestamptz;
+ALTER TABLE "messages" ADD COLUMN "deleted_at" timestamptz;
+
+-- Izmjena i brisanje dobivaju novi seq sobe kako bi se ponovno poslali klijentu koji nastavlja sesiju
+ALTER TABLE "messages" ADD COLUMN "update_seq" bigint;
+CREATE INDEX "messages_room_id_update_seq_idx" ON "messages" ("room_id", "update_seq") WHERE "update_seq" IS NOT NULL;
+
+-- Povijest izmjena: prethodni sadržaj poruke prije svake izmjene
+CREATE TABLE "message_edits" (
+    "id" bigserial PRIMARY KEY,
+    "message_id" bigint NOT NULL REFERENCES "messages" ("id") ON DELETE CASCADE,
+    "user_id" bigint REFERENCES "users" ("id") ON DELETE SET NULL, -- tko je izmijenio poruku
+    "content" text NOT NULL,
+    "edited_at" timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX "message_edits_message_id_idx" ON "message_edits" ("message_id");
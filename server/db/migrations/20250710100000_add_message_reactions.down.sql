@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS "messages_room_id_reaction_seq_idx";
+ALTER TABLE "messages" DROP COLUMN IF EXISTS "reaction_seq";
+DROP TABLE IF EXISTS "message_reactions";
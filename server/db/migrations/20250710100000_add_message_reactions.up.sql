@@ -0,0 +1,12 @@
+-- Reakcije na poruke: svaki korisnik može isti emoji na poruku dodati samo jednom
+CREATE TABLE "message_reactions" (
+    "message_id" bigint NOT NULL REFERENCES "messages" ("id") ON DELETE CASCADE,
+    "user_id" bigint NOT NULL REFERENCES "users" ("id") ON DELETE CASCADE,
+    "emoji" varchar NOT NULL,
+    "created_at" timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY ("message_id", "user_id", "emoji")
+);
+
+-- Promjena reakcija dobiva novi seq sobe kako bi klijent koji nastavlja sesiju dobio trenutni zbroj reakcija
+ALTER TABLE "messages" ADD COLUMN "reaction_seq" bigint;
+CREATE INDEX "messages_room_id_reaction_seq_idx" ON "messages" ("room_id", "reaction_seq") WHERE "reaction_seq" IS NOT NULL;
@@ -0,0 +1,4 @@
+-- Odgovori u niti pokazuju na početnu poruku niti (niti su jednorazinske)
+ALTER TABLE "messages" ADD COLUMN "parent_id" bigint REFERENCES "messages" ("id") ON DELETE SET NULL;
+
+CREATE INDEX "messages_parent_id_idx" ON "messages" ("parent_id") WHERE "parent_id" IS NOT NULL;
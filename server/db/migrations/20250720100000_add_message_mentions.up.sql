@@ -0,0 +1,9 @@
+-- Spominjanja (@korisnik, @room, @here): jedan zapis po poruci i spomenutom korisniku
+CREATE TABLE "mentions" (
+    "message_id" bigint NOT NULL REFERENCES "messages" ("id") ON DELETE CASCADE,
+    "user_id" bigint NOT NULL REFERENCES "users" ("id") ON DELETE CASCADE,
+    "created_at" timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY ("message_id", "user_id")
+);
+
+CREATE INDEX "mentions_user_id_created_at_idx" ON "mentions" ("user_id", "created_at" DESC);
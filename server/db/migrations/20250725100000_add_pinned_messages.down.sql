@@ -0,0 +1,2 @@
+ALTER TABLE "rooms" DROP COLUMN IF EXISTS "pin_seq";
+DROP TABLE IF EXISTS "pinned_messages";
@@ -0,0 +1,14 @@
+-- Prikvačene poruke sobe (prikvačuju ih moderatori)
+CREATE TABLE "pinned_messages" (
+    "message_id" bigint PRIMARY KEY REFERENCES "messages" ("id") ON DELETE CASCADE,
+    "room_id" varchar NOT NULL REFERENCES "rooms" ("id") ON DELETE CASCADE,
+    "pinned_by" bigint REFERENCES "users" ("id") ON DELETE SET NULL,
+    "pinned_at" timestamptz NOT NULL DEFAULT now(),
+    "slot" integer NOT NULL -- mjesto u sobi (1..najveći broj prikvačenih poruka)
+);
+
+-- Jedinstveno mjesto ograničava broj prikvačenih poruka i kad ih moderatori prikvačuju istovremeno
+CREATE UNIQUE INDEX "pinned_messages_room_id_slot_key" ON "pinned_messages" ("room_id", "slot");
+
+-- Seq zadnjeg prikvačivanja ili otkvačivanja; klijent koji nastavlja sesiju nakon te promjene dobiva resync
+ALTER TABLE "rooms" ADD COLUMN "pin_seq" bigint NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS "messages_search_vector_idx";
+ALTER TABLE "messages" DROP COLUMN IF EXISTS "search_vector";
+DROP TEXT SEARCH CONFIGURATION IF EXISTS "croatian";
@@ -0,0 +1,19 @@
+-- Postgres nema hrvatsku konfiguraciju pretraživanja; srpski snowball stemmer (latinica i ćirilica)
+-- dobro pokriva hrvatski, a ako nije dostupan koristi se konfiguracija bez stemanja
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM pg_ts_config WHERE cfgname = 'serbian') THEN
+        CREATE TEXT SEARCH CONFIGURATION "croatian" (COPY = serbian);
+    ELSE
+        CREATE TEXT SEARCH CONFIGURATION "croatian" (COPY = simple);
+    END IF;
+END
+$$;
+
+-- Sadržaj poruke indeksiran je s hrvatskim i engleskim stemanjem
+ALTER TABLE "messages" ADD COLUMN "search_vector" tsvector
+    GENERATED ALWAYS AS (
+        to_tsvector('croatian'::regconfig, "content") || to_tsvector('english'::regconfig, "content")
+    ) STORED;
+
+CREATE INDEX "messages_search_vector_idx" ON "messages" USING gin ("search_vector");
@@ -0,0 +1,19 @@
+-- Privici chat poruka: datoteka je u blob spremištu, a ovdje su njeni metapodaci.
+-- Privitak se prvo uploada u sobu (message_id je NULL), a zatim veže uz chat poruku koja ga navodi.
+CREATE TABLE "attachments" (
+    "id" bigserial PRIMARY KEY,
+    "room_id" varchar NOT NULL REFERENCES "rooms" ("id") ON DELETE CASCADE,
+    "user_id" bigint REFERENCES "users" ("id") ON DELETE SET NULL,
+    "message_id" bigint REFERENCES "messages" ("id") ON DELETE CASCADE,
+    "storage_key" varchar NOT NULL,
+    "thumbnail_key" varchar NOT NULL DEFAULT '', -- prazno ako privitak nije slika
+    "filename" varchar NOT NULL,
+    "content_type" varchar NOT NULL,
+    "size" bigint NOT NULL,
+    "width" int NOT NULL DEFAULT 0,
+    "height" int NOT NULL DEFAULT 0,
+    "created_at" timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX "attachments_message_id_idx" ON "attachments" ("message_id");
+CREATE INDEX "attachments_user_id_idx" ON "attachments" ("user_id");
@@ -0,0 +1,11 @@
+-- Povijest poziva: svaki call-request poslan u sobu (sadržaj signalizacije se ne sprema).
+-- Korisnik u izvozu podataka dobiva pozive koje je uputio i pozive u sobama čiji je član.
+CREATE TABLE "calls" (
+    "id" bigserial PRIMARY KEY,
+    "room_id" varchar NOT NULL REFERENCES "rooms" ("id") ON DELETE CASCADE,
+    "caller_id" bigint REFERENCES "users" ("id") ON DELETE SET NULL, -- NULL za neprijavljene i obrisane korisnike
+    "created_at" timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX "calls_room_id_created_at_idx" ON "calls" ("room_id", "created_at");
+CREATE INDEX "calls_caller_id_idx" ON "calls" ("caller_id");
@@ -0,0 +1,229 @@
+// Package user - zaštita prijave od brute-force napada.
+// Neuspjeli pokušaji prijave broje se po računu (email) i po IP adresi:
+// - nakon nekoliko besplatnih pokušaja svaki sljedeći zahtijeva eksponencijalno duže čekanje,
+// - nakon praga pokušaja ključ se zaključava na duže vrijeme.
+//
+// Pokušaj se broji unaprijed (Reserve) i vraća tek kad uspije (Release), pa istovremeni
+// zahtjevi ne mogu svi proći provjeru prije nego što se ijedan neuspjeh zabilježi.
+//
+// Brojači se čuvaju u AttemptStore sučelju — MemoryAttemptStore je zadana implementacija
+// za jednu instancu, a za više instanci treba implementirati dijeljeni store (npr. Redis).
+
+package user
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Attempts je stanje neuspjelih pokušaja za jedan ključ.
+type Attempts struct {
+	Count int       // broj uzastopnih neuspjelih pokušaja
+	Last  time.Time // vrijeme zadnjeg neuspjelog pokušaja
+}
+
+// AttemptStore čuva brojače neuspjelih pokušaja prijave.
+// Reserve mora biti atomska: provjera politike i povećanje brojača su jedna operacija.
+// Zapis smije isteći policy.ttl() nakon zadnjeg pokušaja.
+type AttemptStore interface {
+	Reserve(ctx context.Context, key string, policy LimitPolicy, now time.Time) (retryAfter time.Duration, err error)
+	Release(ctx context.Context, key string) error
+	Reset(ctx context.Context, key string) error
+}
+
+// LimitPolicy određuje koliko se pokušaja tolerira i koliko dugo traje blokada.
+type LimitPolicy struct {
+	FreeAttempts     int           // pokušaji bez ikakvog čekanja
+	BaseDelay        time.Duration // čekanje nakon prvog pokušaja iznad FreeAttempts (udvostručuje se)
+	MaxDelay         time.Duration // gornja granica eksponencijalnog čekanja
+	LockoutThreshold int           // broj pokušaja nakon kojeg slijedi zaključavanje
+	LockoutDuration  time.Duration // trajanje zaključavanja
+}
+
+// blockedUntil vraća trenutak do kojeg je ključ blokiran (nulto vrijeme ako nije).
+func (p LimitPolicy) blockedUntil(a Attempts) time.Time {
+	if a.Count >= p.LockoutThreshold {
+		return a.Last.Add(p.LockoutDuration)
+	}
+	if a.Count <= p.FreeAttempts {
+		return time.Time{}
+	}
+	delay := p.BaseDelay << (a.Count - p.FreeAttempts - 1)
+	if delay <= 0 || delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return a.Last.Add(delay)
+}
+
+// ttl je koliko dugo zapis mora trajati nakon zadnjeg pokušaja.
+func (p LimitPolicy) ttl() time.Duration {
+	return p.LockoutDuration + p.MaxDelay
+}
+
+var (
+	// accountPolicy štiti pojedini račun neovisno o IP adresi napadača.
+	accountPolicy = LimitPolicy{
+		FreeAttempts:     3,
+		BaseDelay:        time.Second,
+		MaxDelay:         time.Minute,
+		LockoutThreshold: 10,
+		LockoutDuration:  15 * time.Minute,
+	}
+	// ipPolicy je blaža jer više korisnika može dijeliti istu IP adresu (NAT).
+	ipPolicy = LimitPolicy{
+		FreeAttempts:     10,
+		BaseDelay:        time.Second,
+		MaxDelay:         time.Minute,
+		LockoutThreshold: 50,
+		LockoutDuration:  15 * time.Minute,
+	}
+)
+
+// TooManyAttemptsError vraća se kad je račun ili IP privremeno blokiran.
+type TooManyAttemptsError struct {
+	RetryAfter time.Duration
+}
+
+func (e *TooManyAttemptsError) Error() string {
+	return fmt.Sprintf("previše neuspjelih pokušaja prijave, pokušajte ponovno za %d s", int(e.RetryAfter.Seconds()+0.5))
+}
+
+// loginLimiter primjenjuje politike na račun i IP adresu.
+type loginLimiter struct {
+	store AttemptStore
+}
+
+// limitKeys vraća ključeve i pripadne politike za jedan pokušaj prijave.
+func limitKeys(account, ip string) map[string]LimitPolicy {
+	keys := map[string]LimitPolicy{"account:" + account: accountPolicy}
+	if ip != "" {
+		keys["ip:"+ip] = ipPolicy
+	}
+	return keys
+}
+
+// Reserve unaprijed broji pokušaj kao neuspjeli za račun i IP adresu.
+// Ako je bilo koji ključ blokiran, vraća TooManyAttemptsError i ne broji pokušaj ni za jedan ključ.
+// Pokušaj koji uspije treba vratiti s Release.
+func (l *loginLimiter) Reserve(ctx context.Context, account, ip string) error {
+	now := time.Now()
+	var reserved []string
+	var retryAfter time.Duration
+	for key, policy := range limitKeys(account, ip) {
+		wait, err := l.store.Reserve(ctx, key, policy, now)
+		if err != nil {
+			l.release(ctx, reserved)
+			return err
+		}
+		if wait > 0 {
+			retryAfter = max(retryAfter, wait)
+			continue
+		}
+		reserved = append(reserved, key)
+	}
+	if retryAfter > 0 {
+		l.release(ctx, reserved)
+		return &TooManyAttemptsError{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// Release vraća pokušaj rezerviran s Reserve jer je provjera uspjela.
+func (l *loginLimiter) Release(ctx context.Context, account, ip string) error {
+	for key := range limitKeys(account, ip) {
+		if err := l.store.Release(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// release vraća već rezervirane ključeve kad pokušaj ipak nije dopušten.
+func (l *loginLimiter) release(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		l.store.Release(ctx, key)
+	}
+}
+
+// Succeed briše brojač računa nakon uspješne prijave.
+// Brojač IP adrese se ne briše kako napadač ne bi mogao resetirati limit vlastitim računom.
+func (l *loginLimiter) Succeed(ctx context.Context, account string) error {
+	return l.store.Reset(ctx, "account:"+account)
+}
+
+// MemoryAttemptStore je AttemptStore koji čuva brojače u memoriji procesa.
+type MemoryAttemptStore struct {
+	mu        sync.Mutex
+	entries   map[string]memoryAttempt
+	lastSweep time.Time
+}
+
+// memoryAttempt je zapis s vremenom isteka.
+type memoryAttempt struct {
+	Attempts
+	expiresAt time.Time
+}
+
+// NewMemoryAttemptStore vraća prazan store u memoriji.
+func NewMemoryAttemptStore() *MemoryAttemptStore {
+	return &MemoryAttemptStore{entries: make(map[string]memoryAttempt)}
+}
+
+// Reserve pod istim lockom provjerava je li ključ blokiran i, ako nije, povećava mu brojač.
+func (s *MemoryAttemptStore) Reserve(ctx context.Context, key string, policy LimitPolicy, now time.Time) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now, policy.ttl())
+
+	entry, ok := s.entries[key]
+	if !ok || now.After(entry.expiresAt) {
+		entry = memoryAttempt{}
+	}
+	if wait := policy.blockedUntil(entry.Attempts).Sub(now); wait > 0 {
+		return wait, nil
+	}
+	entry.Count++
+	entry.Last = now
+	entry.expiresAt = now.Add(policy.ttl())
+	s.entries[key] = entry
+	return 0, nil
+}
+
+// Release smanjuje brojač ključa za jedan rezervirani pokušaj.
+func (s *MemoryAttemptStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok || entry.Count == 0 {
+		return nil
+	}
+	entry.Count--
+	s.entries[key] = entry
+	return nil
+}
+
+// Reset briše brojač ključa.
+func (s *MemoryAttemptStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
+
+// sweep povremeno uklanja istekle zapise da mapa ne raste beskonačno.
+func (s *MemoryAttemptStore) sweep(now time.Time, interval time.Duration) {
+	if now.Sub(s.lastSweep) < interval {
+		return
+	}
+	for key, entry := range s.entries {
+		if now.After(entry.expiresAt) {
+			delete(s.entries, key)
+		}
+	}
+	s.lastSweep = now
+}
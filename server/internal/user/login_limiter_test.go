@@ -0,0 +1,57 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestLoginLimiterReserveIsAtomic(t *testing.T) {
+	limiter := &loginLimiter{store: NewMemoryAttemptStore()}
+	ctx := context.Background()
+
+	// Istovremeni pogrešni pokušaji ne smiju svi proći provjeru prije prvog zabilježenog neuspjeha
+	var allowed atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if limiter.Reserve(ctx, "ana@example.com", "") == nil {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got, want := int(allowed.Load()), accountPolicy.FreeAttempts+1; got != want {
+		t.Fatalf("%d concurrent attempts allowed, want %d", got, want)
+	}
+}
+
+func TestLoginLimiterReleaseReturnsAttempt(t *testing.T) {
+	limiter := &loginLimiter{store: NewMemoryAttemptStore()}
+	ctx := context.Background()
+
+	// Uspješni pokušaji se vraćaju pa ne troše besplatne pokušaje
+	for i := 0; i < 2*accountPolicy.FreeAttempts; i++ {
+		if err := limiter.Reserve(ctx, "ana@example.com", "10.0.0.1"); err != nil {
+			t.Fatalf("attempt %d: %v", i, err)
+		}
+		if err := limiter.Release(ctx, "ana@example.com", "10.0.0.1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i <= accountPolicy.FreeAttempts; i++ {
+		if err := limiter.Reserve(ctx, "ana@example.com", "10.0.0.1"); err != nil {
+			t.Fatalf("failed attempt %d: %v", i, err)
+		}
+	}
+	var tooMany *TooManyAttemptsError
+	if err := limiter.Reserve(ctx, "ana@example.com", "10.0.0.1"); !errors.As(err, &tooMany) {
+		t.Fatalf("expected TooManyAttemptsError, got %v", err)
+	}
+}
@@ -0,0 +1,150 @@
+// Package user sadrži HTTP handlere za SSO prijavu putem OpenID Connecta:
+// - GET /auth/oidc/:provider/login    → preusmjerava korisnika na pružatelja,
+// - GET /auth/oidc/:provider/callback → mijenja kod za tokene i postavlja isti JWT cookie kao Login.
+//
+// Stanje toka (state, nonce, PKCE verifier) čuva se u kratkotrajnom potpisanom cookieju,
+// pa callback radi i kad je pokrenuto više instanci servera.
+
+package user
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	oidcFlowCookie = "oidc_flow"      // cookie koji nosi stanje toka između login i callback zahtjeva
+	oidcFlowTTL    = 10 * time.Minute // koliko dugo korisnik ima za prijavu kod pružatelja
+)
+
+// OIDCHandler povezuje OIDC pružatelje sa Service slojem.
+type OIDCHandler struct {
+	Service
+	providers map[string]*OIDCProvider
+}
+
+// NewOIDCHandler vraća novi handler za konfigurirane pružatelje.
+func NewOIDCHandler(s Service, providers map[string]*OIDCProvider) *OIDCHandler {
+	return &OIDCHandler{Service: s, providers: providers}
+}
+
+// oidcFlowClaims su podaci toka spremljeni u potpisanom cookieju.
+type oidcFlowClaims struct {
+	Provider string `json:"provider"`
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	jwt.RegisteredClaims
+}
+
+// Login započinje authorization-code + PKCE tok i preusmjerava korisnika na pružatelja.
+func (h *OIDCHandler) Login(c *gin.Context) {
+	provider, ok := h.providers[c.Param("provider")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "nepoznat pružatelj identiteta"})
+		return
+	}
+
+	state, errState := randomToken(24)
+	nonce, errNonce := randomToken(24)
+	verifier, errVerifier := randomToken(48)
+	if errState != nil || errNonce != nil || errVerifier != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "nešto je pošlo po zlu s prijavom"})
+		return
+	}
+
+	flow := jwt.NewWithClaims(jwt.SigningMethodHS256, oidcFlowClaims{
+		Provider: provider.Name,
+		State:    state,
+		Nonce:    nonce,
+		Verifier: verifier,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(oidcFlowTTL)),
+		},
+	})
+	signedFlow, err := flow.SignedString(secretKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "nešto je pošlo po zlu s prijavom"})
+		return
+	}
+
+	redirect, err := provider.AuthCodeURL(c.Request.Context(), state, nonce, verifier)
+	if err != nil {
+		log.Println("Greška pri OIDC discoveryju:", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "pružatelj identiteta nije dostupan"})
+		return
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcFlowCookie, signedFlow, int(oidcFlowTTL.Seconds()), "/auth/oidc", "", false, true)
+	c.Redirect(http.StatusFound, redirect)
+}
+
+// Callback završava tok: provjerava state, mijenja kod za ID token,
+// povezuje ili kreira korisnika i postavlja JWT cookie.
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	provider, ok := h.providers[c.Param("provider")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "nepoznat pružatelj identiteta"})
+		return
+	}
+
+	if errCode := c.Query("error"); errCode != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": errCode})
+		return
+	}
+
+	rawFlow, err := c.Cookie(oidcFlowCookie)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "prijava je istekla, pokušajte ponovno"})
+		return
+	}
+	// Cookie je jednokratan
+	c.SetCookie(oidcFlowCookie, "", -1, "/auth/oidc", "", false, true)
+
+	flow := &oidcFlowClaims{}
+	_, err = jwt.ParseWithClaims(rawFlow, flow, func(t *jwt.Token) (interface{}, error) {
+		return secretKey, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil || flow.Provider != provider.Name || flow.State == "" || flow.State != c.Query("state") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "prijava je istekla, pokušajte ponovno"})
+		return
+	}
+
+	identity, err := provider.Exchange(c.Request.Context(), c.Query("code"), flow.Verifier, flow.Nonce)
+	if err != nil {
+		log.Println("Greška pri OIDC zamjeni koda:", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "prijava kod pružatelja identiteta nije uspjela"})
+		return
+	}
+
+	u, err := h.Service.LoginWithIdentity(c.Request.Context(), identity)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Korisnik s uključenim 2FA dobiva samo challenge token — cookie se postavlja tek u VerifyLoginTOTP.
+	// Frontend ga dobiva u fragmentu URL-a (ne šalje se serveru ni u Referer zaglavlju).
+	if u.TwoFactorRequired {
+		if redirect := os.Getenv("OIDC_SUCCESS_REDIRECT"); redirect != "" {
+			c.Redirect(http.StatusFound, redirect+"#twoFactorRequired=true&challengeToken="+url.QueryEscape(u.ChallengeToken))
+			return
+		}
+		c.JSON(http.StatusOK, u)
+		return
+	}
+
+	c.SetCookie("jwt", u.AccessToken, 60*60*24, "/", "localhost", false, true)
+	if redirect := os.Getenv("OIDC_SUCCESS_REDIRECT"); redirect != "" {
+		c.Redirect(http.StatusFound, redirect)
+		return
+	}
+	c.JSON(http.StatusOK, u)
+}
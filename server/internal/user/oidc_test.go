@@ -0,0 +1,427 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"server/util"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	testClientID    = "chat-client"
+	testRedirectURL = "http://localhost:8080/auth/oidc/mock/callback"
+	testKeyID       = "test-key"
+)
+
+// mockIssuer je lažni OIDC pružatelj (discovery, JWKS i token endpoint) za testove.
+type mockIssuer struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu      sync.Mutex
+	grants  map[string]mockGrant // izdani autorizacijski kodovi
+	subject string
+	email   string
+	emailOK any // vrijednost claima email_verified
+}
+
+// mockGrant je ono što pružatelj pamti uz autorizacijski kod.
+type mockGrant struct {
+	challenge string
+	nonce     string
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockIssuer{
+		key:     key,
+		grants:  make(map[string]mockGrant),
+		subject: "subject-1",
+		email:   "ana@example.com",
+		emailOK: true,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.URL,
+			"authorization_endpoint": m.URL + "/authorize",
+			"token_endpoint":         m.URL + "/token",
+			"jwks_uri":               m.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]string{{
+				"kid": testKeyID,
+				"kty": "RSA",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", m.token)
+
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+	return m
+}
+
+// token provjerava kod i PKCE verifier te izdaje potpisani ID token.
+func (m *mockIssuer) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.Form.Get("grant_type") != "authorization_code" {
+		http.Error(w, `{"error":"invalid_request"}`, http.StatusBadRequest)
+		return
+	}
+
+	m.mu.Lock()
+	grant, ok := m.grants[r.Form.Get("code")]
+	delete(m.grants, r.Form.Get("code"))
+	subject, email, emailOK := m.subject, m.email, m.emailOK
+	m.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != grant.challenge ||
+		r.Form.Get("client_id") != testClientID || r.Form.Get("redirect_uri") != testRedirectURL {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":                m.URL,
+		"aud":                testClientID,
+		"sub":                subject,
+		"exp":                time.Now().Add(time.Minute).Unix(),
+		"iat":                time.Now().Unix(),
+		"nonce":              grant.nonce,
+		"email":              email,
+		"email_verified":     emailOK,
+		"preferred_username": "ana",
+	})
+	idToken.Header["kid"] = testKeyID
+	signed, err := idToken.SignedString(m.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"id_token": signed, "token_type": "Bearer"})
+}
+
+// authorize glumi korisnika koji se prijavio kod pružatelja: pamti PKCE izazov i nonce
+// iz URL-a za preusmjeravanje i vraća autorizacijski kod te state.
+func (m *mockIssuer) authorize(t *testing.T, authURL string) (code, state string) {
+	t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		t.Fatalf("authorization URL has no S256 PKCE challenge: %s", authURL)
+	}
+	if q.Get("client_id") != testClientID || q.Get("redirect_uri") != testRedirectURL {
+		t.Fatalf("unexpected client in authorization URL: %s", authURL)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	code = fmt.Sprintf("code-%d", len(m.grants)+1)
+	m.grants[code] = mockGrant{challenge: q.Get("code_challenge"), nonce: q.Get("nonce")}
+	return code, q.Get("state")
+}
+
+func (m *mockIssuer) provider() *OIDCProvider {
+	return &OIDCProvider{
+		Name:        "mock",
+		Issuer:      m.URL,
+		ClientID:    testClientID,
+		RedirectURL: testRedirectURL,
+		Scopes:      []string{"openid", "email", "profile"},
+	}
+}
+
+// identityRepository je Repository s korisnicima u memoriji; ostale metode nisu implementirane.
+type identityRepository struct {
+	Repository
+
+	mu    sync.Mutex
+	users map[string]*User // po emailu
+	links map[string]int64 // provider/subject → ID korisnika
+}
+
+func newIdentityRepository(users ...*User) *identityRepository {
+	r := &identityRepository{
+		users: make(map[string]*User),
+		links: make(map[string]int64),
+	}
+	for _, u := range users {
+		r.users[u.Email] = u
+	}
+	return r
+}
+
+func (r *identityRepository) GetUserByIdentity(ctx context.Context, provider, subject string) (*User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	id, ok := r.links[provider+"/"+subject]
+	if !ok {
+		return nil, nil
+	}
+	for _, u := range r.users {
+		if u.ID == id {
+			return u, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *identityRepository) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.users[email], nil
+}
+
+func (r *identityRepository) CreateUser(ctx context.Context, user *User) (*User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	created := *user
+	created.ID = int64(len(r.users) + 1)
+	r.users[created.Email] = &created
+	return &created, nil
+}
+
+func (r *identityRepository) LinkIdentity(ctx context.Context, userID int64, provider, subject string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.links[provider+"/"+subject] = userID
+	return nil
+}
+
+func newIdentityService(repo *identityRepository) Service {
+	return NewService(repo, NewMemoryAttemptStore(), util.PasswordPolicy{}, nil)
+}
+
+func TestOIDCExchangeRequiresPKCEVerifier(t *testing.T) {
+	issuer := newMockIssuer(t)
+	provider := issuer.provider()
+	ctx := context.Background()
+
+	authURL, err := provider.AuthCodeURL(ctx, "state", "nonce", "correct-verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, _ := issuer.authorize(t, authURL)
+	if _, err := provider.Exchange(ctx, code, "wrong-verifier", "nonce"); err == nil {
+		t.Fatal("Exchange with wrong PKCE verifier succeeded")
+	}
+
+	code, _ = issuer.authorize(t, authURL)
+	identity, err := provider.Exchange(ctx, code, "correct-verifier", "nonce")
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if identity.Provider != "mock" || identity.Subject != "subject-1" || identity.Email != "ana@example.com" || !identity.EmailVerified {
+		t.Fatalf("unexpected identity: %+v", identity)
+	}
+}
+
+func TestOIDCExchangeRejectsNonceMismatch(t *testing.T) {
+	issuer := newMockIssuer(t)
+	provider := issuer.provider()
+	ctx := context.Background()
+
+	authURL, err := provider.AuthCodeURL(ctx, "state", "nonce-a", "verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := issuer.authorize(t, authURL)
+	if _, err := provider.Exchange(ctx, code, "verifier", "nonce-b"); err == nil {
+		t.Fatal("Exchange accepted id_token with a different nonce")
+	}
+}
+
+func TestOIDCEmailVerifiedString(t *testing.T) {
+	issuer := newMockIssuer(t)
+	issuer.emailOK = "true"
+	provider := issuer.provider()
+	ctx := context.Background()
+
+	authURL, err := provider.AuthCodeURL(ctx, "state", "nonce", "verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := issuer.authorize(t, authURL)
+	identity, err := provider.Exchange(ctx, code, "verifier", "nonce")
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if !identity.EmailVerified {
+		t.Fatal(`email_verified "true" was not accepted`)
+	}
+}
+
+// oidcRouter vraća gin router s login i callback rutama kao u router.InitRouter.
+func oidcRouter(issuer *mockIssuer, s Service) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	h := NewOIDCHandler(s, map[string]*OIDCProvider{"mock": issuer.provider()})
+	r := gin.New()
+	r.GET("/auth/oidc/:provider/login", h.Login)
+	r.GET("/auth/oidc/:provider/callback", h.Callback)
+	return r
+}
+
+// startOIDCLogin pokreće tok i vraća autorizacijski kod, state i cookie toka.
+func startOIDCLogin(t *testing.T, issuer *mockIssuer, r *gin.Engine) (string, string, *http.Cookie) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/auth/oidc/mock/login", nil))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("login status = %d, body %s", rec.Code, rec.Body)
+	}
+
+	var flow *http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == oidcFlowCookie {
+			flow = c
+		}
+	}
+	if flow == nil {
+		t.Fatal("login did not set the flow cookie")
+	}
+
+	code, state := issuer.authorize(t, rec.Header().Get("Location"))
+	return code, state, flow
+}
+
+func callback(r *gin.Engine, code, state string, flow *http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/auth/oidc/mock/callback?"+url.Values{"code": {code}, "state": {state}}.Encode(), nil)
+	if flow != nil {
+		req.AddCookie(flow)
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestOIDCCallbackChecksState(t *testing.T) {
+	issuer := newMockIssuer(t)
+	repo := newIdentityRepository()
+	r := oidcRouter(issuer, newIdentityService(repo))
+
+	code, _, flow := startOIDCLogin(t, issuer, r)
+	if rec := callback(r, code, "forged-state", flow); rec.Code != http.StatusBadRequest {
+		t.Fatalf("callback with wrong state: status = %d, want 400", rec.Code)
+	}
+
+	code, state, _ := startOIDCLogin(t, issuer, r)
+	if rec := callback(r, code, state, nil); rec.Code != http.StatusBadRequest {
+		t.Fatalf("callback without flow cookie: status = %d, want 400", rec.Code)
+	}
+
+	if len(repo.links) != 0 || len(repo.users) != 0 {
+		t.Fatal("rejected callback must not create or link users")
+	}
+}
+
+func TestOIDCCallbackLinksVerifiedEmail(t *testing.T) {
+	issuer := newMockIssuer(t)
+	existing := &User{ID: 7, Username: "ana", Email: "ana@example.com"}
+	repo := newIdentityRepository(existing)
+	r := oidcRouter(issuer, newIdentityService(repo))
+
+	code, state, flow := startOIDCLogin(t, issuer, r)
+	rec := callback(r, code, state, flow)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("callback status = %d, body %s", rec.Code, rec.Body)
+	}
+
+	if repo.links["mock/subject-1"] != existing.ID {
+		t.Fatalf("identity linked to %d, want %d", repo.links["mock/subject-1"], existing.ID)
+	}
+	var res LoginUserRes
+	if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.ID != "7" || res.AccessToken == "" {
+		t.Fatalf("unexpected login response: %+v", res)
+	}
+	var jwtCookie bool
+	for _, c := range rec.Result().Cookies() {
+		jwtCookie = jwtCookie || (c.Name == "jwt" && c.Value == res.AccessToken)
+	}
+	if !jwtCookie {
+		t.Fatal("callback did not set the jwt cookie")
+	}
+}
+
+func TestOIDCCallbackRejectsUnverifiedEmail(t *testing.T) {
+	issuer := newMockIssuer(t)
+	issuer.emailOK = false
+	existing := &User{ID: 7, Username: "ana", Email: "ana@example.com"}
+	repo := newIdentityRepository(existing)
+	r := oidcRouter(issuer, newIdentityService(repo))
+
+	code, state, flow := startOIDCLogin(t, issuer, r)
+	if rec := callback(r, code, state, flow); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("callback status = %d, want 401", rec.Code)
+	}
+	if len(repo.links) != 0 || len(repo.users) != 1 {
+		t.Fatal("unverified email must not link or create users")
+	}
+}
+
+func TestLoginWithIdentityCreatesUser(t *testing.T) {
+	repo := newIdentityRepository()
+	s := newIdentityService(repo)
+
+	res, err := s.LoginWithIdentity(context.Background(), &ExternalIdentity{
+		Provider: "mock", Subject: "subject-2", Email: "novi@example.com", EmailVerified: true, Username: "Novi Korisnik",
+	})
+	if err != nil {
+		t.Fatalf("LoginWithIdentity: %v", err)
+	}
+	created := repo.users["novi@example.com"]
+	if created == nil || res.AccessToken == "" {
+		t.Fatalf("user not created or no token: %+v", res)
+	}
+	if repo.links["mock/subject-2"] != created.ID {
+		t.Fatal("new user was not linked to the identity")
+	}
+}
+
+func TestLoginWithIdentityRequiresTOTP(t *testing.T) {
+	existing := &User{ID: 7, Username: "ana", Email: "ana@example.com", TOTPEnabled: true}
+	repo := newIdentityRepository(existing)
+	repo.links["mock/subject-1"] = existing.ID
+	s := newIdentityService(repo)
+
+	res, err := s.LoginWithIdentity(context.Background(), &ExternalIdentity{
+		Provider: "mock", Subject: "subject-1", Email: "ana@example.com", EmailVerified: true,
+	})
+	if err != nil {
+		t.Fatalf("LoginWithIdentity: %v", err)
+	}
+	if !res.TwoFactorRequired || res.ChallengeToken == "" || res.AccessToken != "" {
+		t.Fatalf("user with 2FA got a full login: %+v", res)
+	}
+}
@@ -6,14 +6,44 @@
 
 package user
 
-import "context"
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
 
 // User predstavlja korisnički zapis u bazi.
 type User struct {
 	ID       int64  `json:"id" db:"id"`
 	Username string `json:"username" db:"username"`
 	Email    string `json:"email" db:"email"`
-	Password string `json:"password" db:"password"`
+	Password string `json:"-" db:"password"` // hash lozinke — nikad se ne šalje klijentu
+
+	DisplayName  string    `json:"displayName" db:"display_name"`
+	Bio          string    `json:"bio" db:"bio"`
+	StatusText   string    `json:"statusText" db:"status_text"`
+	CreatedAt    time.Time `json:"createdAt" db:"created_at"`
+	AvatarKey    string    `json:"-" db:"avatar_key"`               // prefiks ključeva avatara u spremištu (prazan ako nema avatara)
+	Discoverable bool      `json:"discoverable" db:"discoverable"`  // smije li se korisnik pojaviti u pretrazi
+	ContactsOnly bool      `json:"contactsOnly" db:"contacts_only"` // smiju li mu DM i pozive slati samo kontakti
+
+	LastSeenAt     *time.Time `json:"-" db:"last_seen_at"`    // kraj zadnje WebSocket veze (nil ako se nikad nije spojio)
+	PresenceStatus string     `json:"-" db:"presence_status"` // ručno postavljen status: online, away ili dnd
+
+	TokenVersion        int        `json:"-" db:"token_version"`         // povećava se pri opozivu svih tokena
+	DeletionScheduledAt *time.Time `json:"-" db:"deletion_scheduled_at"` // trenutak trajnog brisanja (nil ako brisanje nije zatraženo)
+
+	TOTPSecret  string `json:"-" db:"totp_secret"`            // base32 tajni ključ za 2FA (prazan ako nije postavljen)
+	TOTPEnabled bool   `json:"totpEnabled" db:"totp_enabled"` // true nakon potvrde prvog TOTP koda
+}
+
+// RecoveryCode je jednokratni kod za prijavu kad korisnik nema pristup autentikatoru.
+type RecoveryCode struct {
+	ID       int64  `db:"id"`
+	UserID   int64  `db:"user_id"`
+	CodeHash string `db:"code_hash"`
 }
 
 // CreateUserReq koristi se prilikom registracije korisnika (unos podataka).
@@ -34,24 +64,283 @@ type CreateUserRes struct {
 type LoginUserReq struct {
 	Email    string `json:"email" db:"email"`
 	Password string `json:"password" db:"password"`
+	IP       string `json:"-"` // IP adresa klijenta (postavlja handler) — za brute-force zaštitu
 }
 
 // LoginUserRes vraća se nakon uspješne prijave korisnika.
+// Ako korisnik ima uključen 2FA, vraća se samo ChallengeToken,
+// a pravi JWT se izdaje tek nakon VerifyLoginTOTP.
 type LoginUserRes struct {
-	AccessToken string `json:"accessToken"` // JWT
-	ID          string `json:"id"`
-	Username    string `json:"username"`
-	Email       string `json:"email"`
+	AccessToken       string `json:"accessToken,omitempty"` // JWT
+	ID                string `json:"id,omitempty"`
+	Username          string `json:"username,omitempty"`
+	Email             string `json:"email,omitempty"`
+	TwoFactorRequired bool   `json:"twoFactorRequired,omitempty"`
+	ChallengeToken    string `json:"challengeToken,omitempty"` // kratkotrajni token za drugi korak prijave
+}
+
+// VerifyTOTPReq koristi se u drugom koraku prijave (TOTP ili recovery kod).
+type VerifyTOTPReq struct {
+	ChallengeToken string `json:"challengeToken"`
+	Code           string `json:"code"`
+	IP             string `json:"-"`
+}
+
+// EnrollTOTPRes vraća tajni ključ i otpauth URI za postavljanje autentikatora.
+type EnrollTOTPRes struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// ConfirmTOTPReq sadrži prvi kod iz autentikatora kojim se potvrđuje uključivanje 2FA.
+type ConfirmTOTPReq struct {
+	Code string `json:"code"`
+}
+
+// ConfirmTOTPRes vraća recovery kodove — prikazuju se korisniku samo jednom.
+type ConfirmTOTPRes struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// ProfileRes je prikaz vlastitog profila (GET /me).
+type ProfileRes struct {
+	ID           string            `json:"id"`
+	Username     string            `json:"username"`
+	Email        string            `json:"email"`
+	DisplayName  string            `json:"displayName"`
+	Bio          string            `json:"bio"`
+	StatusText   string            `json:"statusText"`
+	TOTPEnabled  bool              `json:"totpEnabled"`
+	Discoverable bool              `json:"discoverable"`
+	ContactsOnly bool              `json:"contactsOnly"`
+	Presence     string            `json:"presence"` // ručno postavljen status (online, away, dnd)
+	CreatedAt    time.Time         `json:"createdAt"`
+	AvatarURL    string            `json:"avatarUrl,omitempty"`
+	AvatarURLs   map[string]string `json:"avatarUrls,omitempty"` // veličina u pikselima → URL
+}
+
+// PublicProfileRes je javni prikaz profila drugog korisnika (GET /users/:id) — bez emaila.
+type PublicProfileRes struct {
+	ID          string            `json:"id"`
+	Username    string            `json:"username"`
+	DisplayName string            `json:"displayName"`
+	Bio         string            `json:"bio"`
+	StatusText  string            `json:"statusText"`
+	AvatarURL   string            `json:"avatarUrl,omitempty"`
+	AvatarURLs  map[string]string `json:"avatarUrls,omitempty"`
+}
+
+// UpdateProfileReq koristi se za PATCH /me — mijenjaju se samo poslana polja.
+type UpdateProfileReq struct {
+	Username     *string `json:"username"`
+	DisplayName  *string `json:"displayName"`
+	Bio          *string `json:"bio"`
+	StatusText   *string `json:"statusText"`
+	Discoverable *bool   `json:"discoverable"`
+	ContactsOnly *bool   `json:"contactsOnly"`
+}
+
+// UserSearchRes je stranica rezultata pretrage korisnika (GET /users/search).
+type UserSearchRes struct {
+	Results    []*PublicProfileRes `json:"results"`
+	NextOffset *int                `json:"nextOffset,omitempty"` // nil ako nema više rezultata
+}
+
+// ChangePasswordReq koristi se za promjenu lozinke (POST /me/password).
+type ChangePasswordReq struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+	IP              string `json:"-"`
+}
+
+// Identity je veza korisnika s vanjskim OIDC identitetom.
+type Identity struct {
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// DeleteAccountReq potvrđuje brisanje računa lozinkom ili TOTP kodom (ako je uključen 2FA).
+type DeleteAccountReq struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+	IP       string `json:"-"`
+}
+
+// DeleteAccountRes vraća se nakon zahtjeva za brisanjem računa.
+type DeleteAccountRes struct {
+	DeletionScheduledAt time.Time `json:"deletionScheduledAt"`
+}
+
+// ErrUserNotFound vraća se kad traženi korisnik ne postoji.
+var ErrUserNotFound = errors.New("korisnik ne postoji")
+
+// ErrContactsOnly vraća se kad korisnik prima DM i pozive samo od kontakata.
+var ErrContactsOnly = errors.New("korisnik prima poruke i pozive samo od kontakata")
+
+// ErrContactRequestNotFound vraća se kad zahtjev za kontakt ne postoji.
+var ErrContactRequestNotFound = errors.New("zahtjev za kontakt ne postoji")
+
+// ErrBlocked vraća se kad je jedan od dva korisnika blokirao drugoga.
+var ErrBlocked = errors.New("komunikacija s ovim korisnikom nije moguća")
+
+// Greške uključivanja 2FA koje su posljedica zahtjeva klijenta (400).
+var (
+	ErrTOTPAlreadyEnabled = errors.New("2FA je već uključen")
+	ErrTOTPNotEnrolled    = errors.New("2FA postavljanje nije započeto")
+	ErrInvalidTOTPCode    = errors.New("neispravan kod")
+)
+
+// FieldError opisuje grešku validacije jednog polja zahtjeva.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationError vraća se kad podaci zahtjeva nisu ispravni — handler ga šalje klijentu kao listu polja.
+type ValidationError struct {
+	Fields []FieldError `json:"fields"`
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		messages = append(messages, f.Message)
+	}
+	return strings.Join(messages, "; ")
+}
+
+// ConflictError vraća se kad vrijednost polja već koristi drugi korisnik (npr. zauzeto korisničko ime).
+type ConflictError struct {
+	FieldError
+}
+
+func (e *ConflictError) Error() string {
+	return e.Message
+}
+
+// ContactRes je jedan kontakt u listi (GET /me/contacts).
+type ContactRes struct {
+	User       *PublicProfileRes `json:"user"`
+	Presence   string            `json:"presence"`             // online, away, dnd ili offline
+	LastSeenAt *time.Time        `json:"lastSeenAt,omitempty"` // samo za kontakte koji nisu spojeni
+	Since      time.Time         `json:"since"`                // kada je zahtjev prihvaćen
+}
+
+// SetPresenceReq koristi se za PUT /me/presence.
+type SetPresenceReq struct {
+	Status string `json:"status"` // online, away ili dnd
+}
+
+// ContactRequestRes je jedan zahtjev za kontakt.
+type ContactRequestRes struct {
+	User      *PublicProfileRes `json:"user"`
+	CreatedAt time.Time         `json:"createdAt"`
+}
+
+// ContactRequestsRes je lista dolaznih i odlaznih zahtjeva (GET /me/contacts/requests).
+type ContactRequestsRes struct {
+	Incoming []ContactRequestRes `json:"incoming"`
+	Outgoing []ContactRequestRes `json:"outgoing"`
+}
+
+// SendContactRequestRes vraća se nakon slanja zahtjeva; Status je "pending",
+// ili "accepted" ako je druga strana već poslala zahtjev pa su odmah postali kontakti.
+type SendContactRequestRes struct {
+	Status string `json:"status"`
+}
+
+// Contact je spremljena veza korisnika s kontaktom ili zahtjev za kontakt.
+type Contact struct {
+	UserID    int64     `json:"userId" db:"contact_id"` // drugi korisnik u vezi
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+}
+
+// UsernameAvailabilityRes je odgovor na GET /users/available.
+type UsernameAvailabilityRes struct {
+	Username  string `json:"username"`
+	Available bool   `json:"available"`
+	Code      string `json:"code,omitempty"` // razlog nedostupnosti: "taken", "reserved", "invalid_length"...
+	Message   string `json:"message,omitempty"`
 }
 
 // Repository predstavlja apstrakciju nad bazom podataka.
 type Repository interface {
 	CreateUser(ctx context.Context, user *User) (*User, error)
 	GetUserByEmail(ctx context.Context, email string) (*User, error)
+	GetUserByID(ctx context.Context, id int64) (*User, error)
+	GetUserByUsername(ctx context.Context, username string) (*User, error)
+	SearchUsers(ctx context.Context, callerID int64, query string, limit, offset int) ([]*User, error)
+	UpdatePassword(ctx context.Context, userID int64, hashedPassword string) (int, error)
+	UpdatePasswordHash(ctx context.Context, userID int64, hashedPassword string) error
+	UpdateProfile(ctx context.Context, user *User) error
+	SetAvatar(ctx context.Context, userID int64, avatarKey string) error
+	SetTOTPSecret(ctx context.Context, userID int64, secret string) error
+	EnableTOTP(ctx context.Context, userID int64, recoveryCodeHashes []string) error
+	UseTOTPStep(ctx context.Context, userID, step int64) (bool, error)
+	GetRecoveryCodes(ctx context.Context, userID int64) ([]RecoveryCode, error)
+	UseRecoveryCode(ctx context.Context, id int64) error
+	GetUserByIdentity(ctx context.Context, provider, subject string) (*User, error)
+	LinkIdentity(ctx context.Context, userID int64, provider, subject string) error
+	GetIdentities(ctx context.Context, userID int64) ([]Identity, error)
+	ScheduleDeletion(ctx context.Context, userID int64, at time.Time) error
+	CancelDeletion(ctx context.Context, userID int64) error
+	GetUsersDueForDeletion(ctx context.Context, now time.Time) ([]*User, error)
+	DeleteUser(ctx context.Context, userID int64) error
+	BlockUser(ctx context.Context, blockerID, blockedID int64) error
+	UnblockUser(ctx context.Context, blockerID, blockedID int64) error
+	IsBlocked(ctx context.Context, userA, userB int64) (bool, error)
+	GetBlockRelations(ctx context.Context, userID int64) ([]int64, error)
+	CreateContactRequest(ctx context.Context, requesterID, addresseeID int64) error
+	DeleteContactRequest(ctx context.Context, requesterID, addresseeID int64) (bool, error)
+	AcceptContactRequest(ctx context.Context, requesterID, addresseeID int64) (bool, error)
+	HasContactRequest(ctx context.Context, requesterID, addresseeID int64) (bool, error)
+	GetIncomingContactRequests(ctx context.Context, userID int64) ([]Contact, error)
+	GetOutgoingContactRequests(ctx context.Context, userID int64) ([]Contact, error)
+	GetContacts(ctx context.Context, userID int64) ([]Contact, error)
+	IsContact(ctx context.Context, userID, contactID int64) (bool, error)
+	RemoveContact(ctx context.Context, userA, userB int64) error
+	UpdateLastSeen(ctx context.Context, userID int64, at time.Time) error
+	SetPresenceStatus(ctx context.Context, userID int64, status string) error
 }
 
 // Service predstavlja aplikacijsku logiku za korisnike.
 type Service interface {
 	CreateUser(ctx context.Context, req *CreateUserReq) (*CreateUserRes, error)
 	Login(ctx context.Context, req *LoginUserReq) (*LoginUserRes, error)
+	VerifyLoginTOTP(ctx context.Context, req *VerifyTOTPReq) (*LoginUserRes, error)
+	EnrollTOTP(ctx context.Context, userID int64) (*EnrollTOTPRes, error)
+	ConfirmTOTP(ctx context.Context, userID int64, req *ConfirmTOTPReq) (*ConfirmTOTPRes, error)
+	ParseAccessToken(ctx context.Context, token string) (*MYJWTClaims, error)
+	LoginWithIdentity(ctx context.Context, identity *ExternalIdentity) (*LoginUserRes, error)
+	GetProfile(ctx context.Context, userID int64) (*ProfileRes, error)
+	UpdateProfile(ctx context.Context, userID int64, req *UpdateProfileReq) (*ProfileRes, error)
+	ChangePassword(ctx context.Context, userID int64, req *ChangePasswordReq) (*LoginUserRes, error)
+	GetPublicProfile(ctx context.Context, userID int64) (*PublicProfileRes, error)
+	CheckUsernameAvailability(ctx context.Context, username string) (*UsernameAvailabilityRes, error)
+	SearchUsers(ctx context.Context, callerID int64, query string, limit, offset int) (*UserSearchRes, error)
+	UploadAvatar(ctx context.Context, userID int64, data []byte) (*ProfileRes, error)
+	ExportData(ctx context.Context, userID int64, w io.Writer) error
+	DeleteAccount(ctx context.Context, userID int64, req *DeleteAccountReq) (*DeleteAccountRes, error)
+	PurgeDeletedAccounts(ctx context.Context) (int, error)
+	RunAccountPurge(interval time.Duration)
+	AddDataProvider(provider UserDataProvider)
+	BlockUser(ctx context.Context, userID, blockedID int64) error
+	UnblockUser(ctx context.Context, userID, blockedID int64) error
+	IsBlocked(ctx context.Context, userA, userB int64) (bool, error)
+	GetBlockRelations(ctx context.Context, userID int64) ([]int64, error)
+	AddBlockListener(listener BlockListener)
+	SendContactRequest(ctx context.Context, userID, targetID int64) (*SendContactRequestRes, error)
+	AcceptContactRequest(ctx context.Context, userID, requesterID int64) error
+	DeleteContactRequest(ctx context.Context, userID, otherID int64) error
+	RemoveContact(ctx context.Context, userID, contactID int64) error
+	GetContacts(ctx context.Context, userID int64) ([]ContactRes, error)
+	GetContactRequests(ctx context.Context, userID int64) (*ContactRequestsRes, error)
+	GetContactIDs(ctx context.Context, userID int64) ([]int64, error)
+	CanContact(ctx context.Context, userID, targetID int64) error
+	AddContactListener(listener ContactListener)
+	SetPresence(presence PresenceProvider)
+	UpdateLastSeen(ctx context.Context, userID int64, at time.Time) error
+	SetPresenceStatus(ctx context.Context, userID int64, status string) error
 }
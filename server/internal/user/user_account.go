@@ -0,0 +1,264 @@
+// Package user - životni ciklus računa i zahtjevi ispitanika (GDPR):
+// - izvoz svih podataka korisnika u ZIP arhivu (GET /me/export),
+// - brisanje računa s rokom za odustajanje (DELETE /me, uz potvrdu lozinkom ili TOTP kodom),
+// - periodično trajno brisanje računa kojima je rok istekao.
+//
+// Podaci koji ne žive u users tablici (sobe, poruke, pozivi...) dohvaćaju se i brišu
+// preko UserDataProvider sučelja koje implementiraju ostali dijelovi aplikacije.
+
+package user
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"server/util"
+	"strconv"
+	"time"
+)
+
+const (
+	accountDeletionGracePeriod = 30 * 24 * time.Hour // rok u kojem se korisnik može predomisliti (prijavom)
+	exportTimeout              = 30 * time.Second    // izvoz čita više tablica pa ima duži timeout
+	purgeTimeout               = 5 * time.Minute     // gornja granica za jedan prolaz trajnog brisanja
+)
+
+// UserDataProvider je dio aplikacije koji drži podatke korisnika izvan users tablice.
+type UserDataProvider interface {
+	// ExportUserData vraća podatke korisnika po sekcijama (naziv sekcije → podaci za JSON).
+	ExportUserData(ctx context.Context, userID int64) (map[string]interface{}, error)
+	// DeleteUserData trajno briše ili anonimizira podatke korisnika.
+	DeleteUserData(ctx context.Context, userID int64) error
+	// DisconnectUser prekida sve aktivne veze korisnika.
+	DisconnectUser(userID int64)
+}
+
+// AddDataProvider registrira izvor podataka za izvoz i brisanje računa.
+// Poziva se pri pokretanju aplikacije, prije posluživanja zahtjeva.
+func (s *service) AddDataProvider(provider UserDataProvider) {
+	s.providers = append(s.providers, provider)
+}
+
+// ExportData zapisuje ZIP arhivu sa svim podacima korisnika:
+// profile.json, identities.json, contacts.json, avatar slike i po jednu JSON datoteku za svaku sekciju providera.
+func (s *service) ExportData(c context.Context, userID int64, w io.Writer) error {
+	ctx, cancel := context.WithTimeout(c, exportTimeout)
+	defer cancel()
+
+	user, err := s.Repository.GetUserByID(ctx, userID)
+	if err != nil {
+		log.Println("Greška pri dohvaćanju korisnika:", err)
+		return err
+	}
+	if user == nil {
+		return ErrUserNotFound
+	}
+
+	identities, err := s.Repository.GetIdentities(ctx, userID)
+	if err != nil {
+		log.Println("Greška pri dohvaćanju identiteta:", err)
+		return err
+	}
+
+	contacts, err := s.Repository.GetContacts(ctx, userID)
+	if err != nil {
+		log.Println("Greška pri dohvaćanju kontakata:", err)
+		return err
+	}
+
+	sections := map[string]interface{}{
+		"profile":    s.newProfileRes(user),
+		"identities": identities,
+		"contacts":   contacts,
+	}
+	for _, provider := range s.providers {
+		data, err := provider.ExportUserData(ctx, userID)
+		if err != nil {
+			log.Println("Greška pri izvozu podataka:", err)
+			return err
+		}
+		for name, section := range data {
+			sections[name] = section
+		}
+	}
+
+	archive := zip.NewWriter(w)
+	for name, section := range sections {
+		file, err := archive.Create(name + ".json")
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(file)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(section); err != nil {
+			return fmt.Errorf("failed to export %s: %w", name, err)
+		}
+	}
+
+	if user.AvatarKey != "" {
+		for _, size := range avatarSizes {
+			if err := s.exportObject(ctx, archive, avatarObjectKey(user.AvatarKey, size), fmt.Sprintf("avatar-%d.png", size)); err != nil {
+				log.Println("Greška pri izvozu avatara:", err)
+			}
+		}
+	}
+
+	log.Println("Izvoz podataka završen za korisnika:", user.Email)
+	return archive.Close()
+}
+
+// exportObject kopira objekt iz spremišta avatara u arhivu.
+func (s *service) exportObject(ctx context.Context, archive *zip.Writer, key, name string) error {
+	object, err := s.avatars.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer object.Close()
+
+	file, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, object)
+	return err
+}
+
+// DeleteAccount zakazuje brisanje računa nakon accountDeletionGracePeriod,
+// opoziva sve tokene i prekida aktivne WebSocket veze.
+// Korisnik mora potvrditi brisanje lozinkom ili TOTP kodom kako ukradena sesija ne bi bila dovoljna.
+// Prijavom unutar roka brisanje se poništava.
+func (s *service) DeleteAccount(c context.Context, userID int64, req *DeleteAccountReq) (*DeleteAccountRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	user, err := s.Repository.GetUserByID(ctx, userID)
+	if err != nil {
+		log.Println("Greška pri dohvaćanju korisnika:", err)
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	if err := s.reauthenticate(ctx, user, req.Password, req.Code, req.IP); err != nil {
+		return nil, err
+	}
+
+	at := time.Now().Add(accountDeletionGracePeriod)
+	if err := s.Repository.ScheduleDeletion(ctx, user.ID, at); err != nil {
+		log.Println("Greška pri zakazivanju brisanja:", err)
+		return nil, err
+	}
+
+	for _, provider := range s.providers {
+		provider.DisconnectUser(user.ID)
+	}
+
+	log.Println("Brisanje računa zakazano za korisnika:", user.Email, at)
+	return &DeleteAccountRes{DeletionScheduledAt: at}, nil
+}
+
+// reauthenticate traži ponovnu potvrdu identiteta prije osjetljive radnje: ispravnu lozinku
+// ili, ako je uključen 2FA, neiskorišteni TOTP kod. Neuspjesi se broje kao neuspjele prijave.
+func (s *service) reauthenticate(ctx context.Context, user *User, password, code, ip string) error {
+	if err := s.limiter.Reserve(ctx, user.Email, ip); err != nil {
+		return err
+	}
+
+	confirmed := password != "" && util.CheckPassword(password, user.Password) == nil
+	if !confirmed && code != "" && user.TOTPEnabled {
+		if step, ok := util.MatchTOTP(user.TOTPSecret, code, time.Now()); ok {
+			fresh, err := s.Repository.UseTOTPStep(ctx, user.ID, step)
+			if err != nil {
+				log.Println("Greška pri bilježenju TOTP koraka:", err)
+				return err
+			}
+			confirmed = fresh
+		}
+	}
+	if !confirmed {
+		log.Println("Neuspjela ponovna potvrda identiteta za korisnika:", user.Email)
+		return &ValidationError{Fields: []FieldError{{
+			Field:   "password",
+			Code:    "mismatch",
+			Message: "potvrdite radnju ispravnom lozinkom ili 2FA kodom",
+		}}}
+	}
+
+	s.releaseAttempt(ctx, user.Email, ip)
+	return nil
+}
+
+// PurgeDeletedAccounts trajno briše račune kojima je istekao rok za odustajanje.
+// Vraća broj obrisanih računa.
+func (s *service) PurgeDeletedAccounts(c context.Context) (int, error) {
+	ctx, cancel := context.WithTimeout(c, purgeTimeout)
+	defer cancel()
+
+	users, err := s.Repository.GetUsersDueForDeletion(ctx, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, user := range users {
+		if err := s.purgeAccount(ctx, user); err != nil {
+			log.Printf("Greška pri trajnom brisanju korisnika %d: %v", user.ID, err)
+			continue
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// purgeAccount briše podatke korisnika kod svih providera, avatar i na kraju samog korisnika.
+func (s *service) purgeAccount(ctx context.Context, user *User) error {
+	for _, provider := range s.providers {
+		provider.DisconnectUser(user.ID)
+		if err := provider.DeleteUserData(ctx, user.ID); err != nil {
+			return err
+		}
+	}
+	s.deleteAvatar(ctx, user.AvatarKey)
+	if err := s.Repository.DeleteUser(ctx, user.ID); err != nil {
+		return err
+	}
+	log.Println("Račun trajno obrisan:", strconv.Itoa(int(user.ID)))
+	return nil
+}
+
+// RunAccountPurge periodično pokreće PurgeDeletedAccounts (pokreće se kao go-rutina iz main).
+func (s *service) RunAccountPurge(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		purged, err := s.PurgeDeletedAccounts(context.Background())
+		if err != nil {
+			log.Println("Greška pri trajnom brisanju računa:", err)
+			continue
+		}
+		if purged > 0 {
+			log.Printf("Trajno obrisano računa: %d", purged)
+		}
+	}
+}
+
+// completeLogin završava uspješnu prijavu: resetira brojač neuspjelih pokušaja,
+// poništava zakazano brisanje računa i izdaje JWT.
+func (s *service) completeLogin(ctx context.Context, user *User) (*LoginUserRes, error) {
+	s.recordLoginSuccess(ctx, user.Email)
+
+	if user.DeletionScheduledAt != nil {
+		if err := s.Repository.CancelDeletion(ctx, user.ID); err != nil {
+			log.Println("Greška pri poništavanju brisanja računa:", err)
+			return nil, fmt.Errorf("nešto je pošlo po zlu s prijavom")
+		}
+		user.DeletionScheduledAt = nil
+		log.Println("Brisanje računa poništeno prijavom:", user.Email)
+	}
+
+	return issueLogin(user)
+}
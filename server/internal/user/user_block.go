@@ -0,0 +1,100 @@
+// Package user - blokiranje korisnika:
+// - blokiranje i odblokiranje (POST/DELETE /me/blocks/:userID),
+// - provjera blokade između dva korisnika (u oba smjera),
+// - obavještavanje ostalih dijelova aplikacije (npr. huba) o promjenama kroz BlockListener.
+//
+// Blokada djeluje obostrano: blokirani korisnici ne vide jedan drugoga u pretrazi,
+// ne primaju poruke i pozive jedan od drugoga i ne mogu otvoriti DM.
+
+package user
+
+import (
+	"context"
+	"log"
+)
+
+// BlockListener je dio aplikacije koji mora znati za promjene blokada dok korisnici rade.
+type BlockListener interface {
+	// BlockChanged javlja da je blockerID blokirao (blocked = true) ili odblokirao blockedID.
+	BlockChanged(blockerID, blockedID int64, blocked bool)
+}
+
+// AddBlockListener registrira slušatelja promjena blokada.
+// Poziva se pri pokretanju aplikacije, prije posluživanja zahtjeva.
+func (s *service) AddBlockListener(listener BlockListener) {
+	s.listeners = append(s.listeners, listener)
+}
+
+// BlockUser blokira korisnika blockedID u ime korisnika userID.
+func (s *service) BlockUser(c context.Context, userID, blockedID int64) error {
+	if userID == blockedID {
+		return &ValidationError{Fields: []FieldError{{
+			Field:   "userID",
+			Code:    "self",
+			Message: "ne možete blokirati sami sebe",
+		}}}
+	}
+
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	blocked, err := s.Repository.GetUserByID(ctx, blockedID)
+	if err != nil {
+		log.Println("Greška pri dohvaćanju korisnika:", err)
+		return err
+	}
+	if blocked == nil {
+		return ErrUserNotFound
+	}
+
+	if err := s.Repository.BlockUser(ctx, userID, blockedID); err != nil {
+		log.Println("Greška pri blokiranju korisnika:", err)
+		return err
+	}
+	// Blokada prekida i kontakt i zahtjeve za kontakt
+	if err := s.Repository.RemoveContact(ctx, userID, blockedID); err != nil {
+		log.Println("Greška pri uklanjanju kontakta:", err)
+		return err
+	}
+	s.notifyContactChanged(userID, blockedID, false)
+
+	for _, listener := range s.listeners {
+		listener.BlockChanged(userID, blockedID, true)
+	}
+	log.Printf("Korisnik %d blokirao korisnika %d", userID, blockedID)
+	return nil
+}
+
+// UnblockUser uklanja blokadu koju je userID postavio; odblokiranje je idempotentno.
+// Blokada koju je postavio drugi korisnik ostaje na snazi.
+func (s *service) UnblockUser(c context.Context, userID, blockedID int64) error {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	if err := s.Repository.UnblockUser(ctx, userID, blockedID); err != nil {
+		log.Println("Greška pri odblokiranju korisnika:", err)
+		return err
+	}
+
+	for _, listener := range s.listeners {
+		listener.BlockChanged(userID, blockedID, false)
+	}
+	log.Printf("Korisnik %d odblokirao korisnika %d", userID, blockedID)
+	return nil
+}
+
+// IsBlocked provjerava je li bilo koji od dva korisnika blokirao drugoga.
+func (s *service) IsBlocked(c context.Context, userA, userB int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	return s.Repository.IsBlocked(ctx, userA, userB)
+}
+
+// GetBlockRelations vraća sve korisnike s kojima korisnik ima blokadu (u bilo kojem smjeru).
+func (s *service) GetBlockRelations(c context.Context, userID int64) ([]int64, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	return s.Repository.GetBlockRelations(ctx, userID)
+}
@@ -0,0 +1,283 @@
+// Package user - kontakti (lista prijatelja) i zahtjevi za kontakt:
+// - slanje, prihvaćanje, odbijanje i povlačenje zahtjeva,
+// - uklanjanje kontakta i lista kontakata s trenutnom prisutnošću,
+// - postavka "samo kontakti" kojom korisnik prima DM i pozive samo od kontakata.
+//
+// Dijelovi aplikacije koji prate kontakte dok korisnici rade (npr. hub) registriraju se kao ContactListener.
+
+package user
+
+import (
+	"context"
+	"log"
+)
+
+// Statusi zahtjeva za kontakt.
+const (
+	ContactStatusPending  = "pending"
+	ContactStatusAccepted = "accepted"
+)
+
+// ContactListener je dio aplikacije koji mora znati za promjene kontakata dok korisnici rade.
+type ContactListener interface {
+	// ContactChanged javlja da su korisnici postali (contacts = true) ili prestali biti kontakti.
+	ContactChanged(userA, userB int64, contacts bool)
+}
+
+// AddContactListener registrira slušatelja promjena kontakata.
+// Poziva se pri pokretanju aplikacije, prije posluživanja zahtjeva.
+func (s *service) AddContactListener(listener ContactListener) {
+	s.contacts = append(s.contacts, listener)
+}
+
+// SendContactRequest šalje zahtjev za kontakt korisniku targetID.
+// Ako je targetID već poslao zahtjev korisniku, zahtjev se odmah prihvaća.
+func (s *service) SendContactRequest(c context.Context, userID, targetID int64) (*SendContactRequestRes, error) {
+	if userID == targetID {
+		return nil, &ValidationError{Fields: []FieldError{{
+			Field:   "userID",
+			Code:    "self",
+			Message: "ne možete dodati sami sebe",
+		}}}
+	}
+
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	target, err := s.Repository.GetUserByID(ctx, targetID)
+	if err != nil {
+		log.Println("Greška pri dohvaćanju korisnika:", err)
+		return nil, err
+	}
+	if target == nil || target.DeletionScheduledAt != nil {
+		return nil, ErrUserNotFound
+	}
+
+	blocked, err := s.Repository.IsBlocked(ctx, userID, targetID)
+	if err != nil {
+		return nil, err
+	}
+	if blocked {
+		return nil, ErrBlocked
+	}
+
+	isContact, err := s.Repository.IsContact(ctx, userID, targetID)
+	if err != nil {
+		return nil, err
+	}
+	if isContact {
+		return &SendContactRequestRes{Status: ContactStatusAccepted}, nil
+	}
+
+	// Druga strana je već poslala zahtjev — slanje zahtjeva nazad znači prihvaćanje
+	accepted, err := s.Repository.AcceptContactRequest(ctx, targetID, userID)
+	if err != nil {
+		log.Println("Greška pri prihvaćanju zahtjeva za kontakt:", err)
+		return nil, err
+	}
+	if accepted {
+		s.notifyContactChanged(userID, targetID, true)
+		return &SendContactRequestRes{Status: ContactStatusAccepted}, nil
+	}
+
+	if err := s.Repository.CreateContactRequest(ctx, userID, targetID); err != nil {
+		log.Println("Greška pri slanju zahtjeva za kontakt:", err)
+		return nil, err
+	}
+	log.Printf("Korisnik %d poslao zahtjev za kontakt korisniku %d", userID, targetID)
+	return &SendContactRequestRes{Status: ContactStatusPending}, nil
+}
+
+// AcceptContactRequest prihvaća zahtjev koji je korisniku poslao requesterID.
+func (s *service) AcceptContactRequest(c context.Context, userID, requesterID int64) error {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	accepted, err := s.Repository.AcceptContactRequest(ctx, requesterID, userID)
+	if err != nil {
+		log.Println("Greška pri prihvaćanju zahtjeva za kontakt:", err)
+		return err
+	}
+	if !accepted {
+		return ErrContactRequestNotFound
+	}
+
+	s.notifyContactChanged(userID, requesterID, true)
+	log.Printf("Korisnik %d prihvatio zahtjev za kontakt od korisnika %d", userID, requesterID)
+	return nil
+}
+
+// DeleteContactRequest odbija dolazni ili povlači odlazni zahtjev između korisnika i otherID.
+func (s *service) DeleteContactRequest(c context.Context, userID, otherID int64) error {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	declined, err := s.Repository.DeleteContactRequest(ctx, otherID, userID)
+	if err != nil {
+		log.Println("Greška pri odbijanju zahtjeva za kontakt:", err)
+		return err
+	}
+	withdrawn, err := s.Repository.DeleteContactRequest(ctx, userID, otherID)
+	if err != nil {
+		log.Println("Greška pri povlačenju zahtjeva za kontakt:", err)
+		return err
+	}
+	if !declined && !withdrawn {
+		return ErrContactRequestNotFound
+	}
+	return nil
+}
+
+// RemoveContact uklanja kontakt (za oba korisnika).
+func (s *service) RemoveContact(c context.Context, userID, contactID int64) error {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	if err := s.Repository.RemoveContact(ctx, userID, contactID); err != nil {
+		log.Println("Greška pri uklanjanju kontakta:", err)
+		return err
+	}
+
+	s.notifyContactChanged(userID, contactID, false)
+	return nil
+}
+
+// GetContacts vraća kontakte korisnika s javnim profilom i trenutnom prisutnošću.
+func (s *service) GetContacts(c context.Context, userID int64) ([]ContactRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	contacts, err := s.Repository.GetContacts(ctx, userID)
+	if err != nil {
+		log.Println("Greška pri dohvaćanju kontakata:", err)
+		return nil, err
+	}
+
+	res := make([]ContactRes, 0, len(contacts))
+	for _, contact := range contacts {
+		user, err := s.Repository.GetUserByID(ctx, contact.UserID)
+		if err != nil {
+			log.Println("Greška pri dohvaćanju korisnika:", err)
+			return nil, err
+		}
+		if user == nil || user.DeletionScheduledAt != nil {
+			continue
+		}
+		res = append(res, s.newContactRes(user, contact.CreatedAt))
+	}
+	return res, nil
+}
+
+// GetContactRequests vraća dolazne i odlazne zahtjeve za kontakt.
+func (s *service) GetContactRequests(c context.Context, userID int64) (*ContactRequestsRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	incoming, err := s.Repository.GetIncomingContactRequests(ctx, userID)
+	if err != nil {
+		log.Println("Greška pri dohvaćanju zahtjeva za kontakt:", err)
+		return nil, err
+	}
+	outgoing, err := s.Repository.GetOutgoingContactRequests(ctx, userID)
+	if err != nil {
+		log.Println("Greška pri dohvaćanju zahtjeva za kontakt:", err)
+		return nil, err
+	}
+
+	res := &ContactRequestsRes{}
+	if res.Incoming, err = s.contactRequests(ctx, incoming); err != nil {
+		return nil, err
+	}
+	if res.Outgoing, err = s.contactRequests(ctx, outgoing); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// contactRequests gradi prikaz zahtjeva s javnim profilima (obrisani korisnici se preskaču).
+func (s *service) contactRequests(ctx context.Context, requests []Contact) ([]ContactRequestRes, error) {
+	res := make([]ContactRequestRes, 0, len(requests))
+	for _, request := range requests {
+		profile, err := s.contactProfile(ctx, request.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if profile == nil {
+			continue
+		}
+		res = append(res, ContactRequestRes{User: profile, CreatedAt: request.CreatedAt})
+	}
+	return res, nil
+}
+
+// contactProfile vraća javni profil kontakta ili nil ako je račun obrisan ili zakazan za brisanje.
+func (s *service) contactProfile(ctx context.Context, userID int64) (*PublicProfileRes, error) {
+	user, err := s.Repository.GetUserByID(ctx, userID)
+	if err != nil {
+		log.Println("Greška pri dohvaćanju korisnika:", err)
+		return nil, err
+	}
+	if user == nil || user.DeletionScheduledAt != nil {
+		return nil, nil
+	}
+	return s.newPublicProfileRes(user), nil
+}
+
+// GetContactIDs vraća ID-eve kontakata korisnika.
+func (s *service) GetContactIDs(c context.Context, userID int64) ([]int64, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	contacts, err := s.Repository.GetContacts(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int64, 0, len(contacts))
+	for _, contact := range contacts {
+		ids = append(ids, contact.UserID)
+	}
+	return ids, nil
+}
+
+// CanContact provjerava smije li userID slati DM i pozive korisniku targetID.
+// Vraća ErrBlocked ako postoji blokada, a ErrContactsOnly ako targetID prima poruke
+// samo od kontakata, a userID to nije.
+func (s *service) CanContact(c context.Context, userID, targetID int64) error {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	blocked, err := s.Repository.IsBlocked(ctx, userID, targetID)
+	if err != nil {
+		return err
+	}
+	if blocked {
+		return ErrBlocked
+	}
+
+	target, err := s.Repository.GetUserByID(ctx, targetID)
+	if err != nil {
+		return err
+	}
+	if target == nil {
+		return ErrUserNotFound
+	}
+	if !target.ContactsOnly {
+		return nil
+	}
+
+	isContact, err := s.Repository.IsContact(ctx, targetID, userID)
+	if err != nil {
+		return err
+	}
+	if !isContact {
+		return ErrContactsOnly
+	}
+	return nil
+}
+
+// notifyContactChanged obavještava sve ContactListenere o promjeni.
+func (s *service) notifyContactChanged(userA, userB int64, contacts bool) {
+	for _, listener := range s.contacts {
+		listener.ContactChanged(userA, userB, contacts)
+	}
+}
@@ -2,15 +2,26 @@
 // Ovdje se definiraju REST endpointi za:
 // - registraciju korisnika (POST /signup),
 // - prijavu korisnika (POST /login),
-// - odjavu korisnika (POST /logout).
+// - odjavu korisnika (POST /logout),
+// - dvofaktorsku autentikaciju (POST /login/2fa, POST /me/2fa/totp, POST /me/2fa/totp/confirm),
+// - upravljanje profilom (GET/PATCH /me, POST /me/password, PUT /me/avatar, GET /users/:id),
+// - provjeru dostupnosti korisničkog imena (GET /users/available),
+// - pretragu korisnika (GET /users/search),
+// - izvoz podataka i brisanje računa (GET /me/export, DELETE /me).
 //
 // Handler koristi Service interfejs za obradu logike.
 
 package user
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -36,11 +47,11 @@ func (h *Handler) CreateUser(c *gin.Context) {
 		return
 	}
 
-	log.Printf("Received user data: %+v\n", u)
+	log.Printf("Received signup for username %q, email %q", u.Username, u.Email)
 
 	response, err := h.Service.CreateUser(c.Request.Context(), &u)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
@@ -55,16 +66,410 @@ func (h *Handler) Login(context *gin.Context) {
 		return
 	}
 
+	user.IP = context.ClientIP()
 	u, err := h.Service.Login(context.Request.Context(), &user)
 	if err != nil {
+		if respondTooManyAttempts(context, err) {
+			return
+		}
 		context.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	// Korisnik s uključenim 2FA dobiva samo challenge token — cookie se postavlja tek u VerifyLoginTOTP
+	if u.TwoFactorRequired {
+		context.JSON(http.StatusOK, u)
+		return
+	}
+
+	context.SetCookie("jwt", u.AccessToken, 60*60*24, "/", "localhost", false, true)
+	context.JSON(http.StatusOK, u)
+}
+
+// VerifyLoginTOTP obrađuje drugi korak prijave (TOTP ili recovery kod) i postavlja JWT cookie.
+func (h *Handler) VerifyLoginTOTP(context *gin.Context) {
+	var req VerifyTOTPReq
+	if err := context.ShouldBindJSON(&req); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	req.IP = context.ClientIP()
+	u, err := h.Service.VerifyLoginTOTP(context.Request.Context(), &req)
+	if err != nil {
+		if respondTooManyAttempts(context, err) {
+			return
+		}
+		context.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
 	context.SetCookie("jwt", u.AccessToken, 60*60*24, "/", "localhost", false, true)
 	context.JSON(http.StatusOK, u)
 }
 
+// EnrollTOTP započinje postavljanje 2FA i vraća tajni ključ i otpauth URI.
+func (h *Handler) EnrollTOTP(c *gin.Context) {
+	response, err := h.Service.EnrollTOTP(c.Request.Context(), CurrentUserID(c))
+	if err != nil {
+		respondTOTPError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// ConfirmTOTP potvrđuje 2FA prvim kodom iz autentikatora i vraća recovery kodove.
+func (h *Handler) ConfirmTOTP(c *gin.Context) {
+	var req ConfirmTOTPReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := h.Service.ConfirmTOTP(c.Request.Context(), CurrentUserID(c), &req)
+	if err != nil {
+		respondTOTPError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// respondTOTPError odgovara s 400 na greške klijenta pri uključivanju 2FA, a ostale greške mapira kao respondError.
+func respondTOTPError(c *gin.Context, err error) {
+	if errors.Is(err, ErrTOTPAlreadyEnabled) || errors.Is(err, ErrTOTPNotEnrolled) || errors.Is(err, ErrInvalidTOTPCode) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	respondError(c, err)
+}
+
+// GetProfile vraća profil prijavljenog korisnika.
+func (h *Handler) GetProfile(c *gin.Context) {
+	response, err := h.Service.GetProfile(c.Request.Context(), CurrentUserID(c))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// UpdateProfile mijenja poslana polja profila prijavljenog korisnika.
+func (h *Handler) UpdateProfile(c *gin.Context) {
+	var req UpdateProfileReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := h.Service.UpdateProfile(c.Request.Context(), CurrentUserID(c), &req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// ChangePassword mijenja lozinku prijavljenog korisnika (zahtijeva trenutnu lozinku).
+// Ostale sesije se odjavljuju, a ovaj klijent dobiva novi JWT u cookieju.
+func (h *Handler) ChangePassword(c *gin.Context) {
+	var req ChangePasswordReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	req.IP = c.ClientIP()
+	u, err := h.Service.ChangePassword(c.Request.Context(), CurrentUserID(c), &req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.SetCookie("jwt", u.AccessToken, 60*60*24, "/", "localhost", false, true)
+	c.JSON(http.StatusOK, gin.H{"message": "lozinka promijenjena", "accessToken": u.AccessToken})
+}
+
+// maxAvatarBytes je najveća dopuštena veličina datoteke avatara.
+const maxAvatarBytes = 5 << 20
+
+// UploadAvatar prima sliku avatara kao multipart polje "avatar".
+func (h *Handler) UploadAvatar(c *gin.Context) {
+	// Mala rezerva za multipart zaglavlja; veće tijelo zahtjeva se prekida
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxAvatarBytes+64<<10)
+
+	header, err := c.FormFile("avatar")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "avatar je prevelik (najviše 5 MB)"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "nedostaje datoteka avatara"})
+		return
+	}
+	if header.Size > maxAvatarBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "avatar je prevelik (najviše 5 MB)"})
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxAvatarBytes))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Sadržaj se provjerava neovisno o Content-Type koji je poslao klijent
+	switch http.DetectContentType(data) {
+	case "image/jpeg", "image/png", "image/webp":
+	default:
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "avatar mora biti JPEG, PNG ili WebP slika"})
+		return
+	}
+
+	response, err := h.Service.UploadAvatar(c.Request.Context(), CurrentUserID(c), data)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetPublicProfile vraća javni profil korisnika po ID-u.
+func (h *Handler) GetPublicProfile(c *gin.Context) {
+	userID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "neispravan ID korisnika"})
+		return
+	}
+
+	response, err := h.Service.GetPublicProfile(c.Request.Context(), userID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// ExportData šalje ZIP arhivu sa svim podacima prijavljenog korisnika.
+func (h *Handler) ExportData(c *gin.Context) {
+	// Arhiva se prvo slaže u memoriji kako bi se greška mogla vratiti kao JSON
+	var archive bytes.Buffer
+	if err := h.Service.ExportData(c.Request.Context(), CurrentUserID(c), &archive); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	filename := fmt.Sprintf("gochat-export-%d-%s.zip", CurrentUserID(c), time.Now().Format("20060102"))
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Data(http.StatusOK, "application/zip", archive.Bytes())
+}
+
+// DeleteAccount zakazuje brisanje računa, briše JWT cookie i vraća datum trajnog brisanja.
+// Tijelo zahtjeva nosi lozinku ili TOTP kod kojim korisnik potvrđuje brisanje.
+func (h *Handler) DeleteAccount(c *gin.Context) {
+	var req DeleteAccountReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	req.IP = c.ClientIP()
+	response, err := h.Service.DeleteAccount(c.Request.Context(), CurrentUserID(c), &req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.SetCookie("jwt", "", -1, "", "", false, true)
+	c.JSON(http.StatusOK, response)
+}
+
+// CheckUsernameAvailability provjerava može li se korisničko ime iz ?username= registrirati.
+func (h *Handler) CheckUsernameAvailability(c *gin.Context) {
+	response, err := h.Service.CheckUsernameAvailability(c.Request.Context(), c.Query("username"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// SearchUsers traži korisnike po ?q= uz paginaciju (?limit=, ?offset=).
+func (h *Handler) SearchUsers(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	offset, _ := strconv.Atoi(c.Query("offset"))
+
+	response, err := h.Service.SearchUsers(c.Request.Context(), CurrentUserID(c), c.Query("q"), limit, offset)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// BlockUser blokira korisnika :userID.
+func (h *Handler) BlockUser(c *gin.Context) {
+	blockedID, err := strconv.ParseInt(c.Param("userID"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "neispravan ID korisnika"})
+		return
+	}
+
+	if err := h.Service.BlockUser(c.Request.Context(), CurrentUserID(c), blockedID); err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "korisnik blokiran"})
+}
+
+// UnblockUser uklanja blokadu korisnika :userID.
+func (h *Handler) UnblockUser(c *gin.Context) {
+	blockedID, err := strconv.ParseInt(c.Param("userID"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "neispravan ID korisnika"})
+		return
+	}
+
+	if err := h.Service.UnblockUser(c.Request.Context(), CurrentUserID(c), blockedID); err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "korisnik odblokiran"})
+}
+
+// GetContacts vraća kontakte prijavljenog korisnika.
+func (h *Handler) GetContacts(c *gin.Context) {
+	response, err := h.Service.GetContacts(c.Request.Context(), CurrentUserID(c))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetContactRequests vraća dolazne i odlazne zahtjeve za kontakt.
+func (h *Handler) GetContactRequests(c *gin.Context) {
+	response, err := h.Service.GetContactRequests(c.Request.Context(), CurrentUserID(c))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// SendContactRequest šalje zahtjev za kontakt korisniku :userID.
+func (h *Handler) SendContactRequest(c *gin.Context) {
+	targetID, err := strconv.ParseInt(c.Param("userID"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "neispravan ID korisnika"})
+		return
+	}
+
+	response, err := h.Service.SendContactRequest(c.Request.Context(), CurrentUserID(c), targetID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// AcceptContactRequest prihvaća zahtjev za kontakt koji je poslao korisnik :userID.
+func (h *Handler) AcceptContactRequest(c *gin.Context) {
+	requesterID, err := strconv.ParseInt(c.Param("userID"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "neispravan ID korisnika"})
+		return
+	}
+
+	if err := h.Service.AcceptContactRequest(c.Request.Context(), CurrentUserID(c), requesterID); err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "zahtjev prihvaćen"})
+}
+
+// DeleteContactRequest odbija ili povlači zahtjev za kontakt s korisnikom :userID.
+func (h *Handler) DeleteContactRequest(c *gin.Context) {
+	otherID, err := strconv.ParseInt(c.Param("userID"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "neispravan ID korisnika"})
+		return
+	}
+
+	if err := h.Service.DeleteContactRequest(c.Request.Context(), CurrentUserID(c), otherID); err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "zahtjev uklonjen"})
+}
+
+// RemoveContact uklanja kontakt :userID.
+func (h *Handler) RemoveContact(c *gin.Context) {
+	contactID, err := strconv.ParseInt(c.Param("userID"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "neispravan ID korisnika"})
+		return
+	}
+
+	if err := h.Service.RemoveContact(c.Request.Context(), CurrentUserID(c), contactID); err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "kontakt uklonjen"})
+}
+
+// respondError mapira greške servisa na HTTP statuse (422, 409, 429, 403, 404, inače 500).
+func respondError(c *gin.Context, err error) {
+	if respondValidationError(c, err) || respondTooManyAttempts(c, err) {
+		return
+	}
+	var conflict *ConflictError
+	if errors.As(err, &conflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": conflict.Error(), "fields": []FieldError{conflict.FieldError}})
+		return
+	}
+	if errors.Is(err, ErrBlocked) || errors.Is(err, ErrContactsOnly) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, ErrUserNotFound) || errors.Is(err, ErrContactRequestNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// respondValidationError odgovara s 422 i listom neispravnih polja ako je greška ValidationError.
+func respondValidationError(c *gin.Context, err error) bool {
+	var validation *ValidationError
+	if !errors.As(err, &validation) {
+		return false
+	}
+	c.JSON(http.StatusUnprocessableEntity, gin.H{"error": validation.Error(), "fields": validation.Fields})
+	return true
+}
+
+// respondTooManyAttempts odgovara s 429 i Retry-After headerom ako je prijava blokirana.
+func respondTooManyAttempts(c *gin.Context, err error) bool {
+	var tooMany *TooManyAttemptsError
+	if !errors.As(err, &tooMany) {
+		return false
+	}
+	retryAfter := int(tooMany.RetryAfter.Seconds())
+	if tooMany.RetryAfter > time.Duration(retryAfter)*time.Second {
+		retryAfter++ // zaokružujemo prema gore da klijent ne pokuša prerano
+	}
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error(), "retryAfter": retryAfter})
+	return true
+}
+
 // Logout briše JWT cookie i šalje potvrdu odjave.
 func (h *Handler) Logout(context *gin.Context) {
 	context.SetCookie("jwt", "", -1, "", "", false, true)
@@ -0,0 +1,77 @@
+// Package user sadrži middleware za autentikaciju zahtjeva pomoću JWT tokena.
+// Token se čita iz "jwt" cookieja (postavlja ga Login) ili iz Authorization: Bearer headera.
+// Nakon uspješne provjere, ID i username korisnika dostupni su kroz gin.Context.
+
+package user
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// ContextUserID je ključ pod kojim se u gin.Context sprema ID prijavljenog korisnika (int64).
+	ContextUserID = "userID"
+	// ContextUsername je ključ pod kojim se u gin.Context sprema username prijavljenog korisnika.
+	ContextUsername = "username"
+)
+
+// Authenticate je middleware koji propušta samo zahtjeve s valjanim pristupnim tokenom.
+func (h *Handler) Authenticate(c *gin.Context) {
+	token, err := c.Cookie("jwt")
+	if err != nil || token == "" {
+		token = strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	}
+	if token == "" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "niste prijavljeni"})
+		return
+	}
+
+	claims, err := h.Service.ParseAccessToken(c.Request.Context(), token)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "neispravan ili istekao token"})
+		return
+	}
+
+	userID, err := strconv.ParseInt(claims.ID, 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "neispravan ili istekao token"})
+		return
+	}
+
+	c.Set(ContextUserID, userID)
+	c.Set(ContextUsername, claims.Username)
+	c.Next()
+}
+
+// OptionalAuthenticate postavlja podatke o korisniku ako zahtjev ima valjan token,
+// a zahtjeve bez tokena (ili s nevaljanim tokenom) propušta kao neprijavljene.
+func (h *Handler) OptionalAuthenticate(c *gin.Context) {
+	token, err := c.Cookie("jwt")
+	if err != nil || token == "" {
+		token = strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	}
+	if token == "" {
+		c.Next()
+		return
+	}
+
+	claims, err := h.Service.ParseAccessToken(c.Request.Context(), token)
+	if err != nil {
+		c.Next()
+		return
+	}
+	if userID, err := strconv.ParseInt(claims.ID, 10, 64); err == nil {
+		c.Set(ContextUserID, userID)
+		c.Set(ContextUsername, claims.Username)
+	}
+	c.Next()
+}
+
+// CurrentUserID vraća ID korisnika kojeg je postavio Authenticate middleware (0 ako korisnik nije prijavljen).
+func CurrentUserID(c *gin.Context) int64 {
+	return c.GetInt64(ContextUserID)
+}
@@ -0,0 +1,82 @@
+// Package user - prisutnost korisnika:
+// - ručno postavljen status (online, away, dnd) koji se pamti između veza,
+// - trenutak zadnje aktivnosti (last seen) koji se sprema kad korisnik prekine zadnju vezu,
+// - prikaz prisutnosti u listi kontakata.
+//
+// Stvarno stanje veza prati hub; ovdje se nalazi ono što se sprema u bazu
+// i PresenceProvider sučelje kroz koje hub javlja trenutnu prisutnost.
+
+package user
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Statusi prisutnosti.
+const (
+	PresenceOnline  = "online"
+	PresenceAway    = "away"
+	PresenceDND     = "dnd" // ne ometaj
+	PresenceOffline = "offline"
+)
+
+// PresenceProvider javlja trenutnu prisutnost korisnika (online, away, dnd ili offline).
+type PresenceProvider interface {
+	Presence(userID int64) string
+}
+
+// SetPresence postavlja izvor podataka o prisutnosti za listu kontakata.
+func (s *service) SetPresence(presence PresenceProvider) {
+	s.presence = presence
+}
+
+// UpdateLastSeen sprema trenutak zadnje aktivnosti korisnika.
+func (s *service) UpdateLastSeen(c context.Context, userID int64, at time.Time) error {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	return s.Repository.UpdateLastSeen(ctx, userID, at)
+}
+
+// SetPresenceStatus sprema ručno postavljen status (online, away ili dnd).
+func (s *service) SetPresenceStatus(c context.Context, userID int64, status string) error {
+	switch status {
+	case PresenceOnline, PresenceAway, PresenceDND:
+	default:
+		return &ValidationError{Fields: []FieldError{{
+			Field:   "status",
+			Code:    "invalid",
+			Message: "status mora biti online, away ili dnd",
+		}}}
+	}
+
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	if err := s.Repository.SetPresenceStatus(ctx, userID, status); err != nil {
+		log.Println("Greška pri spremanju statusa prisutnosti:", err)
+		return err
+	}
+	return nil
+}
+
+// newContactRes gradi prikaz kontakta s trenutnom prisutnošću;
+// vrijeme zadnje aktivnosti prikazuje se samo za kontakte koji nisu spojeni.
+func (s *service) newContactRes(user *User, since time.Time) ContactRes {
+	presence := PresenceOffline
+	if s.presence != nil {
+		presence = s.presence.Presence(user.ID)
+	}
+
+	res := ContactRes{
+		User:     s.newPublicProfileRes(user),
+		Presence: presence,
+		Since:    since,
+	}
+	if presence == PresenceOffline {
+		res.LastSeenAt = user.LastSeenAt
+	}
+	return res
+}
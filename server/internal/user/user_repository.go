@@ -9,6 +9,11 @@ package user
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
 )
 
 // DBTX definira minimalni skup metoda koje baza mora implementirati
@@ -36,19 +41,34 @@ func (r *repository) CreateUser(ctx context.Context, user *User) (*User, error)
 	query := "INSERT INTO users(username, password, email) VALUES ($1, $2, $3) returning id"
 	err := r.db.QueryRowContext(ctx, query, user.Username, user.Password, user.Email).Scan(&lastInsertId)
 	if err != nil {
-		return &User{}, err
+		return &User{}, mapUniqueViolation(err)
 	}
 
 	user.ID = int64(lastInsertId)
 	return user, nil
 }
 
-// GetUserByEmail dohvaća korisnika po emailu.
+// userColumns su stupci koje čitaju svi upiti koji vraćaju cijelog korisnika (vidi scanUser).
+const userColumns = "id, email, username, password, display_name, bio, status_text, created_at, avatar_key, discoverable, contacts_only, last_seen_at, presence_status, totp_secret, totp_enabled, token_version, deletion_scheduled_at"
+
+// rowScanner je zajedničko sučelje *sql.Row i *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanUser čita jedan redak sa stupcima userColumns.
 // Ako korisnik ne postoji, vraća (nil, nil).
-func (r *repository) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+func scanUser(row rowScanner) (*User, error) {
 	user := User{}
-	query := "SELECT id, email, username, password FROM users WHERE email = $1"
-	err := r.db.QueryRowContext(ctx, query, email).Scan(&user.ID, &user.Email, &user.Username, &user.Password)
+	var totpSecret sql.NullString
+	var deletionScheduledAt sql.NullTime
+	var lastSeenAt sql.NullTime
+	err := row.Scan(
+		&user.ID, &user.Email, &user.Username, &user.Password,
+		&user.DisplayName, &user.Bio, &user.StatusText, &user.CreatedAt, &user.AvatarKey, &user.Discoverable, &user.ContactsOnly,
+		&lastSeenAt, &user.PresenceStatus,
+		&totpSecret, &user.TOTPEnabled, &user.TokenVersion, &deletionScheduledAt,
+	)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -59,5 +79,449 @@ func (r *repository) GetUserByEmail(ctx context.Context, email string) (*User, e
 		return nil, err
 	}
 
+	user.TOTPSecret = totpSecret.String
+	if deletionScheduledAt.Valid {
+		user.DeletionScheduledAt = &deletionScheduledAt.Time
+	}
+	if lastSeenAt.Valid {
+		user.LastSeenAt = &lastSeenAt.Time
+	}
 	return &user, nil
 }
+
+// GetUserByEmail dohvaća korisnika po emailu.
+// Ako korisnik ne postoji, vraća (nil, nil).
+func (r *repository) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	query := "SELECT " + userColumns + " FROM users WHERE lower(email) = lower($1)"
+	return scanUser(r.db.QueryRowContext(ctx, query, email))
+}
+
+// GetUserByID dohvaća korisnika po ID-u.
+// Ako korisnik ne postoji, vraća (nil, nil).
+func (r *repository) GetUserByID(ctx context.Context, id int64) (*User, error) {
+	query := "SELECT " + userColumns + " FROM users WHERE id = $1"
+	return scanUser(r.db.QueryRowContext(ctx, query, id))
+}
+
+// GetUserByUsername dohvaća korisnika po korisničkom imenu (bez obzira na velika/mala slova).
+// Ako korisnik ne postoji, vraća (nil, nil).
+func (r *repository) GetUserByUsername(ctx context.Context, username string) (*User, error) {
+	query := "SELECT " + userColumns + " FROM users WHERE lower(username) = lower($1)"
+	return scanUser(r.db.QueryRowContext(ctx, query, username))
+}
+
+// SearchUsers traži korisnike po prefiksu ili trigram sličnosti korisničkog imena i prikaznog imena.
+// Izostavlja pozivatelja, korisnike koji se ne žele pojaviti u pretrazi,
+// račune zakazane za brisanje te korisnike koje je pozivatelj blokirao ili koji su blokirali njega.
+// Prefiksni pogoci dolaze prvi, zatim po sličnosti.
+func (r *repository) SearchUsers(ctx context.Context, callerID int64, search string, limit, offset int) ([]*User, error) {
+	prefix := escapeLike(strings.ToLower(search)) + "%"
+	query := "SELECT " + prefixColumns("u", userColumns) + ` FROM users u
+		WHERE u.id <> $1
+			AND u.discoverable
+			AND u.deletion_scheduled_at IS NULL
+			AND (
+				lower(u.username) LIKE $2 ESCAPE '\'
+				OR lower(u.display_name) LIKE $2 ESCAPE '\'
+				OR lower(u.username) % lower($3)
+				OR lower(u.display_name) % lower($3)
+			)
+			AND NOT EXISTS (
+				SELECT 1 FROM user_blocks b
+				WHERE (b.blocker_id = u.id AND b.blocked_id = $1)
+					OR (b.blocker_id = $1 AND b.blocked_id = u.id)
+			)
+		ORDER BY
+			(lower(u.username) LIKE $2 ESCAPE '\' OR lower(u.display_name) LIKE $2 ESCAPE '\') DESC,
+			greatest(similarity(lower(u.username), lower($3)), similarity(lower(u.display_name), lower($3))) DESC,
+			lower(u.username)
+		LIMIT $4 OFFSET $5`
+	rows, err := r.db.QueryContext(ctx, query, callerID, prefix, search, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make([]*User, 0, limit)
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// escapeLike escapea znakove koji imaju posebno značenje u LIKE uzorku.
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
+
+// UpdatePassword zamjenjuje lozinku korisnika i opoziva sve njegove tokene (povećava token_version).
+// Vraća novu verziju tokena.
+func (r *repository) UpdatePassword(ctx context.Context, userID int64, hashedPassword string) (int, error) {
+	var tokenVersion int
+	query := "UPDATE users SET password = $2, token_version = token_version + 1 WHERE id = $1 RETURNING token_version"
+	err := r.db.QueryRowContext(ctx, query, userID, hashedPassword).Scan(&tokenVersion)
+	return tokenVersion, err
+}
+
+// UpdatePasswordHash zamjenjuje hash iste lozinke (ponovno hashiranje) bez opoziva tokena.
+func (r *repository) UpdatePasswordHash(ctx context.Context, userID int64, hashedPassword string) error {
+	query := "UPDATE users SET password = $2 WHERE id = $1"
+	_, err := r.db.ExecContext(ctx, query, userID, hashedPassword)
+	return err
+}
+
+// UpdateProfile sprema promjenjiva polja profila (username, display name, bio, status).
+func (r *repository) UpdateProfile(ctx context.Context, user *User) error {
+	query := "UPDATE users SET username = $2, display_name = $3, bio = $4, status_text = $5, discoverable = $6, contacts_only = $7 WHERE id = $1"
+	_, err := r.db.ExecContext(ctx, query, user.ID, user.Username, user.DisplayName, user.Bio, user.StatusText, user.Discoverable, user.ContactsOnly)
+	return mapUniqueViolation(err)
+}
+
+// SetAvatar sprema prefiks ključeva novog avatara.
+func (r *repository) SetAvatar(ctx context.Context, userID int64, avatarKey string) error {
+	query := "UPDATE users SET avatar_key = $2 WHERE id = $1"
+	_, err := r.db.ExecContext(ctx, query, userID, avatarKey)
+	return err
+}
+
+// SetTOTPSecret sprema (još nepotvrđeni) TOTP tajni ključ korisnika i briše zadnji iskorišteni korak.
+func (r *repository) SetTOTPSecret(ctx context.Context, userID int64, secret string) error {
+	query := "UPDATE users SET totp_secret = $2, totp_last_step = NULL WHERE id = $1"
+	_, err := r.db.ExecContext(ctx, query, userID, secret)
+	return err
+}
+
+// EnableTOTP uključuje 2FA i zamjenjuje sve postojeće recovery kodove novima — u jednom upitu.
+func (r *repository) EnableTOTP(ctx context.Context, userID int64, recoveryCodeHashes []string) error {
+	query := `WITH enabled AS (
+		UPDATE users SET totp_enabled = true WHERE id = $1
+	), removed AS (
+		DELETE FROM user_recovery_codes WHERE user_id = $1
+	)
+	INSERT INTO user_recovery_codes(user_id, code_hash) SELECT $1, unnest($2::varchar[])`
+	_, err := r.db.ExecContext(ctx, query, userID, pq.Array(recoveryCodeHashes))
+	return err
+}
+
+// UseTOTPStep bilježi vremenski korak prihvaćenog TOTP koda.
+// Vraća false ako je već iskorišten isti ili noviji korak (kod se ne smije ponovno koristiti).
+func (r *repository) UseTOTPStep(ctx context.Context, userID, step int64) (bool, error) {
+	query := "UPDATE users SET totp_last_step = $2 WHERE id = $1 AND (totp_last_step IS NULL OR totp_last_step < $2)"
+	result, err := r.db.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+// GetRecoveryCodes vraća sve neiskorištene recovery kodove korisnika.
+func (r *repository) GetRecoveryCodes(ctx context.Context, userID int64) ([]RecoveryCode, error) {
+	query := "SELECT id, user_id, code_hash FROM user_recovery_codes WHERE user_id = $1 AND used_at IS NULL"
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var codes []RecoveryCode
+	for rows.Next() {
+		var code RecoveryCode
+		if err := rows.Scan(&code.ID, &code.UserID, &code.CodeHash); err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, rows.Err()
+}
+
+// UseRecoveryCode označava recovery kod iskorištenim.
+func (r *repository) UseRecoveryCode(ctx context.Context, id int64) error {
+	query := "UPDATE user_recovery_codes SET used_at = now() WHERE id = $1 AND used_at IS NULL"
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetUserByIdentity dohvaća korisnika povezanog s vanjskim identitetom (OIDC provider + subject).
+// Ako veza ne postoji, vraća (nil, nil).
+func (r *repository) GetUserByIdentity(ctx context.Context, provider, subject string) (*User, error) {
+	query := "SELECT " + prefixColumns("u", userColumns) + ` FROM users u
+		JOIN user_identities i ON i.user_id = u.id
+		WHERE i.provider = $1 AND i.subject = $2`
+	return scanUser(r.db.QueryRowContext(ctx, query, provider, subject))
+}
+
+// LinkIdentity povezuje korisnika s vanjskim identitetom.
+func (r *repository) LinkIdentity(ctx context.Context, userID int64, provider, subject string) error {
+	query := `INSERT INTO user_identities(user_id, provider, subject) VALUES ($1, $2, $3)
+		ON CONFLICT (provider, subject) DO NOTHING`
+	_, err := r.db.ExecContext(ctx, query, userID, provider, subject)
+	return err
+}
+
+// GetIdentities vraća sve vanjske identitete povezane s korisnikom.
+func (r *repository) GetIdentities(ctx context.Context, userID int64) ([]Identity, error) {
+	query := "SELECT provider, subject, created_at FROM user_identities WHERE user_id = $1 ORDER BY created_at"
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := make([]Identity, 0)
+	for rows.Next() {
+		var identity Identity
+		if err := rows.Scan(&identity.Provider, &identity.Subject, &identity.CreatedAt); err != nil {
+			return nil, err
+		}
+		identities = append(identities, identity)
+	}
+	return identities, rows.Err()
+}
+
+// ScheduleDeletion zakazuje trajno brisanje računa i opoziva sve izdane tokene.
+func (r *repository) ScheduleDeletion(ctx context.Context, userID int64, at time.Time) error {
+	query := "UPDATE users SET deletion_scheduled_at = $2, token_version = token_version + 1 WHERE id = $1"
+	_, err := r.db.ExecContext(ctx, query, userID, at)
+	return err
+}
+
+// CancelDeletion poništava zakazano brisanje računa.
+func (r *repository) CancelDeletion(ctx context.Context, userID int64) error {
+	query := "UPDATE users SET deletion_scheduled_at = NULL WHERE id = $1"
+	_, err := r.db.ExecContext(ctx, query, userID)
+	return err
+}
+
+// GetUsersDueForDeletion vraća korisnike kojima je istekao rok za odustajanje od brisanja.
+func (r *repository) GetUsersDueForDeletion(ctx context.Context, now time.Time) ([]*User, error) {
+	query := "SELECT " + userColumns + " FROM users WHERE deletion_scheduled_at <= $1"
+	rows, err := r.db.QueryContext(ctx, query, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// DeleteUser trajno briše korisnika (povezani zapisi brišu se kroz ON DELETE CASCADE).
+func (r *repository) DeleteUser(ctx context.Context, userID int64) error {
+	query := "DELETE FROM users WHERE id = $1"
+	_, err := r.db.ExecContext(ctx, query, userID)
+	return err
+}
+
+// uniqueConstraintFields povezuje jedinstvene indekse users tablice s poljima zahtjeva.
+var uniqueConstraintFields = map[string]FieldError{
+	"users_username_lower_key": {Field: "username", Code: "taken", Message: "korisničko ime je zauzeto"},
+	"users_email_lower_key":    {Field: "email", Code: "taken", Message: "korisnik s tim emailom već postoji"},
+}
+
+// mapUniqueViolation pretvara Postgres grešku 23505 (unique_violation) u ConflictError za pripadno polje.
+// Ostale greške vraća nepromijenjene.
+func mapUniqueViolation(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) || pqErr.Code != "23505" {
+		return err
+	}
+	if field, ok := uniqueConstraintFields[pqErr.Constraint]; ok {
+		return &ConflictError{FieldError: field}
+	}
+	return &ConflictError{FieldError: FieldError{Code: "conflict", Message: "zapis već postoji"}}
+}
+
+// prefixColumns dodaje alias tablice ispred svakog stupca (npr. "id, email" → "u.id, u.email").
+func prefixColumns(alias, columns string) string {
+	parts := strings.Split(columns, ", ")
+	for i, column := range parts {
+		parts[i] = alias + "." + column
+	}
+	return strings.Join(parts, ", ")
+}
+
+// BlockUser sprema blokadu; ponovno blokiranje istog korisnika ne radi ništa.
+func (r *repository) BlockUser(ctx context.Context, blockerID, blockedID int64) error {
+	query := `INSERT INTO user_blocks(blocker_id, blocked_id) VALUES ($1, $2)
+		ON CONFLICT (blocker_id, blocked_id) DO NOTHING`
+	_, err := r.db.ExecContext(ctx, query, blockerID, blockedID)
+	return err
+}
+
+// UnblockUser uklanja blokadu (ako postoji).
+func (r *repository) UnblockUser(ctx context.Context, blockerID, blockedID int64) error {
+	query := "DELETE FROM user_blocks WHERE blocker_id = $1 AND blocked_id = $2"
+	_, err := r.db.ExecContext(ctx, query, blockerID, blockedID)
+	return err
+}
+
+// IsBlocked provjerava je li bilo koji od dva korisnika blokirao drugoga.
+func (r *repository) IsBlocked(ctx context.Context, userA, userB int64) (bool, error) {
+	var blocked bool
+	query := `SELECT EXISTS (
+		SELECT 1 FROM user_blocks
+		WHERE (blocker_id = $1 AND blocked_id = $2) OR (blocker_id = $2 AND blocked_id = $1)
+	)`
+	err := r.db.QueryRowContext(ctx, query, userA, userB).Scan(&blocked)
+	return blocked, err
+}
+
+// GetBlockRelations vraća ID-eve korisnika koje je korisnik blokirao i koji su blokirali njega.
+func (r *repository) GetBlockRelations(ctx context.Context, userID int64) ([]int64, error) {
+	query := `SELECT blocked_id FROM user_blocks WHERE blocker_id = $1
+		UNION
+		SELECT blocker_id FROM user_blocks WHERE blocked_id = $1`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]int64, 0)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// CreateContactRequest sprema zahtjev za kontakt; ponovljeni zahtjev ne radi ništa.
+func (r *repository) CreateContactRequest(ctx context.Context, requesterID, addresseeID int64) error {
+	query := `INSERT INTO contact_requests(requester_id, addressee_id) VALUES ($1, $2)
+		ON CONFLICT (requester_id, addressee_id) DO NOTHING`
+	_, err := r.db.ExecContext(ctx, query, requesterID, addresseeID)
+	return err
+}
+
+// DeleteContactRequest briše zahtjev i vraća je li zahtjev postojao.
+func (r *repository) DeleteContactRequest(ctx context.Context, requesterID, addresseeID int64) (bool, error) {
+	query := "DELETE FROM contact_requests WHERE requester_id = $1 AND addressee_id = $2"
+	result, err := r.db.ExecContext(ctx, query, requesterID, addresseeID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// AcceptContactRequest u jednom upitu briše zahtjev i sprema kontakt u oba smjera.
+// Vraća false ako zahtjev nije postojao.
+func (r *repository) AcceptContactRequest(ctx context.Context, requesterID, addresseeID int64) (bool, error) {
+	query := `WITH request AS (
+		DELETE FROM contact_requests WHERE requester_id = $1 AND addressee_id = $2
+		RETURNING requester_id, addressee_id
+	)
+	INSERT INTO contacts(user_id, contact_id)
+		SELECT requester_id, addressee_id FROM request
+		UNION ALL
+		SELECT addressee_id, requester_id FROM request
+	ON CONFLICT (user_id, contact_id) DO NOTHING`
+	result, err := r.db.ExecContext(ctx, query, requesterID, addresseeID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// HasContactRequest provjerava postoji li zahtjev od requesterID prema addresseeID.
+func (r *repository) HasContactRequest(ctx context.Context, requesterID, addresseeID int64) (bool, error) {
+	var exists bool
+	query := "SELECT EXISTS (SELECT 1 FROM contact_requests WHERE requester_id = $1 AND addressee_id = $2)"
+	err := r.db.QueryRowContext(ctx, query, requesterID, addresseeID).Scan(&exists)
+	return exists, err
+}
+
+// GetIncomingContactRequests vraća zahtjeve koje je korisnik primio, najnovije prve.
+func (r *repository) GetIncomingContactRequests(ctx context.Context, userID int64) ([]Contact, error) {
+	query := `SELECT requester_id, created_at FROM contact_requests
+		WHERE addressee_id = $1 ORDER BY created_at DESC`
+	return r.queryContacts(ctx, query, userID)
+}
+
+// GetOutgoingContactRequests vraća zahtjeve koje je korisnik poslao, najnovije prve.
+func (r *repository) GetOutgoingContactRequests(ctx context.Context, userID int64) ([]Contact, error) {
+	query := `SELECT addressee_id, created_at FROM contact_requests
+		WHERE requester_id = $1 ORDER BY created_at DESC`
+	return r.queryContacts(ctx, query, userID)
+}
+
+// GetContacts vraća kontakte korisnika.
+func (r *repository) GetContacts(ctx context.Context, userID int64) ([]Contact, error) {
+	query := "SELECT contact_id, created_at FROM contacts WHERE user_id = $1 ORDER BY created_at"
+	return r.queryContacts(ctx, query, userID)
+}
+
+// queryContacts izvršava upit koji vraća parove (ID drugog korisnika, vrijeme).
+func (r *repository) queryContacts(ctx context.Context, query string, args ...interface{}) ([]Contact, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	contacts := make([]Contact, 0)
+	for rows.Next() {
+		var contact Contact
+		if err := rows.Scan(&contact.UserID, &contact.CreatedAt); err != nil {
+			return nil, err
+		}
+		contacts = append(contacts, contact)
+	}
+	return contacts, rows.Err()
+}
+
+// IsContact provjerava jesu li dva korisnika kontakti.
+func (r *repository) IsContact(ctx context.Context, userID, contactID int64) (bool, error) {
+	var exists bool
+	query := "SELECT EXISTS (SELECT 1 FROM contacts WHERE user_id = $1 AND contact_id = $2)"
+	err := r.db.QueryRowContext(ctx, query, userID, contactID).Scan(&exists)
+	return exists, err
+}
+
+// RemoveContact briše kontakt i zahtjeve između dva korisnika (u oba smjera).
+func (r *repository) RemoveContact(ctx context.Context, userA, userB int64) error {
+	query := `WITH requests AS (
+		DELETE FROM contact_requests
+		WHERE (requester_id = $1 AND addressee_id = $2) OR (requester_id = $2 AND addressee_id = $1)
+	)
+	DELETE FROM contacts
+	WHERE (user_id = $1 AND contact_id = $2) OR (user_id = $2 AND contact_id = $1)`
+	_, err := r.db.ExecContext(ctx, query, userA, userB)
+	return err
+}
+
+// UpdateLastSeen sprema trenutak zadnje aktivnosti korisnika.
+func (r *repository) UpdateLastSeen(ctx context.Context, userID int64, at time.Time) error {
+	query := "UPDATE users SET last_seen_at = $2 WHERE id = $1"
+	_, err := r.db.ExecContext(ctx, query, userID, at)
+	return err
+}
+
+// SetPresenceStatus sprema ručno postavljen status prisutnosti.
+func (r *repository) SetPresenceStatus(ctx context.Context, userID int64, status string) error {
+	query := "UPDATE users SET presence_status = $2 WHERE id = $1"
+	_, err := r.db.ExecContext(ctx, query, userID, status)
+	return err
+}
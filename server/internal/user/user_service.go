@@ -1,70 +1,106 @@
 // Package user implementira poslovnu logiku za korisničke operacije kao što su:
 // - registracija novog korisnika,
 // - prijava i validacija lozinke,
-// - generiranje JWT tokena.
+// - generiranje JWT tokena,
+// - dvofaktorska autentikacija (TOTP i recovery kodovi),
+// - prijava putem vanjskih OIDC pružatelja identiteta,
+// - pregled i uređivanje profila, promjena lozinke i upload avatara.
 //
 // Koristi Repository za pristup bazi, te koristi util funkcije za hashiranje i validaciju lozinke.
 
 package user
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"server/storage"
 	"server/util"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/golang-jwt/jwt/v4"
 )
 
 const (
-	secretKey = "secret" // tajni ključ za JWT token (u produkciji mora biti iz .env)
+	totpIssuer        = "GoChat"        // naziv aplikacije prikazan u autentikatoru
+	challengeAudience = "2fa-challenge" // audience claim koji razlikuje challenge od pristupnog tokena
+	challengeTTL      = 5 * time.Minute // koliko dugo korisnik ima za unos TOTP koda
+	recoveryCodeCount = 10              // broj recovery kodova koji se izdaju pri uključivanju 2FA
 )
 
+// secretKey je tajni ključ za potpisivanje JWT tokena (vidi SetSecretKey).
+var secretKey []byte
+
+// SetSecretKey postavlja tajni ključ za potpisivanje i provjeru JWT tokena (JWT_SECRET iz .env).
+// Mora se pozvati prije pokretanja servera; promjena ključa poništava sve izdane tokene.
+func SetSecretKey(secret []byte) {
+	secretKey = secret
+}
+
 // service je privatna implementacija Service interfejsa.
 type service struct {
 	Repository
-	timeout time.Duration
+	timeout   time.Duration
+	limiter   *loginLimiter
+	passwords util.PasswordPolicy
+	avatars   storage.Storage
+	providers []UserDataProvider // izvori podataka za izvoz i brisanje računa (vidi AddDataProvider)
+	listeners []BlockListener    // obavještavaju se o promjenama blokada (vidi AddBlockListener)
+	contacts  []ContactListener  // obavještavaju se o promjenama kontakata (vidi AddContactListener)
+	presence  PresenceProvider   // javlja je li korisnik trenutno spojen (nil = nepoznato)
 }
 
 // NewService kreira novi Service s definiranim timeoutom.
-func NewService(repository Repository) Service {
+// AttemptStore čuva brojače neuspjelih prijava (NewMemoryAttemptStore za jednu instancu),
+// PasswordPolicy određuje pravila za nove lozinke, a Storage sprema slike avatara.
+func NewService(repository Repository, attempts AttemptStore, passwords util.PasswordPolicy, avatars storage.Storage) Service {
 	return &service{
 		Repository: repository,
 		timeout:    time.Duration(2) * time.Second,
+		limiter:    &loginLimiter{store: attempts},
+		passwords:  passwords,
+		avatars:    avatars,
 	}
 }
 
 // CreateUser registrira novog korisnika:
-// - validira ulazne podatke,
-// - provjerava postoji li korisnik s istim emailom,
+// - validira ulazne podatke i lozinku prema politici,
 // - hashira lozinku,
-// - sprema korisnika u bazu.
+// - sprema korisnika u bazu (jedinstvenost emaila i korisničkog imena osigurava baza → ConflictError).
 func (s *service) CreateUser(c context.Context, req *CreateUserReq) (*CreateUserRes, error) {
 	log.Println("CreateUser called.")
-	log.Println("Podaci:", req.Username, req.Email, req.Password)
+	log.Println("Podaci:", req.Username, req.Email)
 
 	ctx, cancel := context.WithTimeout(c, s.timeout)
 	defer cancel()
 
+	req.Email = strings.TrimSpace(strings.ToLower(req.Email))
+	req.Username = strings.TrimSpace(req.Username)
+
+	fields := validateUsername(req.Username)
 	if req.Email == "" {
 		log.Println("Email prazan")
-		return nil, fmt.Errorf("email je obavezan")
+		fields = append(fields, FieldError{Field: "email", Code: "required", Message: "email je obavezan"})
 	}
 	if req.Password == "" {
 		log.Println("Lozinka prazna")
-		return nil, fmt.Errorf("lozinka je obavezna")
+		fields = append(fields, FieldError{Field: "password", Code: "required", Message: "lozinka je obavezna"})
+	} else {
+		passwordErrors, err := s.validatePassword(req.Password, req.Username, req.Email)
+		if err != nil {
+			log.Println("Greška pri provjeri lozinke:", err)
+			return nil, err
+		}
+		fields = append(fields, passwordErrors...)
 	}
-
-	req.Email = strings.TrimSpace(strings.ToLower(req.Email))
-
-	log.Println("Provjera korisnika u bazi...")
-	existing, err := s.Repository.GetUserByEmail(ctx, req.Email)
-	if err == nil && existing != nil {
-		log.Println("Korisnik već postoji")
-		return nil, fmt.Errorf("korisnik s tim emailom već postoji")
+	if len(fields) > 0 {
+		log.Println("Neispravni podaci za registraciju:", len(fields))
+		return nil, &ValidationError{Fields: fields}
 	}
 
 	log.Println("Hashiram lozinku...")
@@ -96,10 +132,392 @@ func (s *service) CreateUser(c context.Context, req *CreateUserReq) (*CreateUser
 	}, nil
 }
 
+// validatePassword provjerava lozinku prema politici i vraća greške za polje "password".
+func (s *service) validatePassword(password string, personal ...string) ([]FieldError, error) {
+	violations, err := s.passwords.Validate(password, personal...)
+	if err != nil {
+		return nil, err
+	}
+	fields := make([]FieldError, 0, len(violations))
+	for _, v := range violations {
+		fields = append(fields, FieldError{Field: "password", Code: v.Code, Message: v.Message})
+	}
+	return fields, nil
+}
+
+// Ograničenja duljine polja profila (u znakovima).
+const (
+	usernameMinLength    = 3
+	usernameMaxLength    = 32
+	displayNameMaxLength = 64
+	bioMaxLength         = 500
+	statusTextMaxLength  = 140
+)
+
+// CheckUsernameAvailability provjerava je li korisničko ime ispravno, nerezervirano i slobodno.
+func (s *service) CheckUsernameAvailability(c context.Context, username string) (*UsernameAvailabilityRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	username = strings.TrimSpace(username)
+	response := &UsernameAvailabilityRes{Username: username}
+	if fields := validateUsername(username); len(fields) > 0 {
+		response.Code = fields[0].Code
+		response.Message = fields[0].Message
+		return response, nil
+	}
+
+	existing, err := s.Repository.GetUserByUsername(ctx, username)
+	if err != nil {
+		log.Println("Greška pri provjeri korisničkog imena:", err)
+		return nil, err
+	}
+	if existing != nil {
+		response.Code = "taken"
+		response.Message = "korisničko ime je zauzeto"
+		return response, nil
+	}
+
+	response.Available = true
+	return response, nil
+}
+
+// Ograničenja pretrage korisnika.
+const (
+	searchMinQueryLength = 2
+	searchDefaultLimit   = 20
+	searchMaxLimit       = 50
+)
+
+// SearchUsers vraća stranicu korisnika čije ime ili prikazno ime odgovara upitu.
+func (s *service) SearchUsers(c context.Context, callerID int64, query string, limit, offset int) (*UserSearchRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	query = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(query), "@"))
+	if utf8.RuneCountInString(query) < searchMinQueryLength {
+		return nil, &ValidationError{Fields: []FieldError{{
+			Field:   "q",
+			Code:    "too_short",
+			Message: fmt.Sprintf("upit mora imati barem %d znaka", searchMinQueryLength),
+		}}}
+	}
+	if limit <= 0 {
+		limit = searchDefaultLimit
+	}
+	if limit > searchMaxLimit {
+		limit = searchMaxLimit
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	// Jedan redak više od traženog govori postoji li sljedeća stranica
+	users, err := s.Repository.SearchUsers(ctx, callerID, query, limit+1, offset)
+	if err != nil {
+		log.Println("Greška pri pretrazi korisnika:", err)
+		return nil, err
+	}
+
+	response := &UserSearchRes{Results: make([]*PublicProfileRes, 0, len(users))}
+	if len(users) > limit {
+		users = users[:limit]
+		next := offset + limit
+		response.NextOffset = &next
+	}
+	for _, user := range users {
+		response.Results = append(response.Results, s.newPublicProfileRes(user))
+	}
+	return response, nil
+}
+
+// avatarSizes su veličine (u pikselima) u kojima se sprema svaki avatar.
+var avatarSizes = []int{64, 128, 256}
+
+// defaultAvatarSize je veličina čiji se URL vraća kao AvatarURL.
+const defaultAvatarSize = 128
+
+// GetProfile vraća vlastiti profil prijavljenog korisnika.
+func (s *service) GetProfile(c context.Context, userID int64) (*ProfileRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	user, err := s.Repository.GetUserByID(ctx, userID)
+	if err != nil {
+		log.Println("Greška pri dohvaćanju korisnika:", err)
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	return s.newProfileRes(user), nil
+}
+
+// UpdateProfile mijenja poslana polja profila nakon validacije duljina.
+func (s *service) UpdateProfile(c context.Context, userID int64, req *UpdateProfileReq) (*ProfileRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	user, err := s.Repository.GetUserByID(ctx, userID)
+	if err != nil {
+		log.Println("Greška pri dohvaćanju korisnika:", err)
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	var fields []FieldError
+	if req.Username != nil {
+		username := strings.TrimSpace(*req.Username)
+		// Vlastito ime se smije zadržati i ako je u međuvremenu postalo rezervirano
+		if !strings.EqualFold(username, user.Username) {
+			fields = append(fields, validateUsername(username)...)
+		}
+		user.Username = username
+	}
+	if req.DisplayName != nil {
+		user.DisplayName = strings.TrimSpace(*req.DisplayName)
+		fields = appendTooLong(fields, "displayName", user.DisplayName, displayNameMaxLength)
+	}
+	if req.Bio != nil {
+		user.Bio = strings.TrimSpace(*req.Bio)
+		fields = appendTooLong(fields, "bio", user.Bio, bioMaxLength)
+	}
+	if req.StatusText != nil {
+		user.StatusText = strings.TrimSpace(*req.StatusText)
+		fields = appendTooLong(fields, "statusText", user.StatusText, statusTextMaxLength)
+	}
+	if req.Discoverable != nil {
+		user.Discoverable = *req.Discoverable
+	}
+	if req.ContactsOnly != nil {
+		user.ContactsOnly = *req.ContactsOnly
+	}
+	if len(fields) > 0 {
+		return nil, &ValidationError{Fields: fields}
+	}
+
+	if err := s.Repository.UpdateProfile(ctx, user); err != nil {
+		log.Println("Greška pri spremanju profila:", err)
+		return nil, err
+	}
+
+	log.Println("Profil ažuriran za korisnika:", user.Email)
+	return s.newProfileRes(user), nil
+}
+
+// appendTooLong dodaje grešku ako vrijednost ima više od max znakova.
+func appendTooLong(fields []FieldError, field, value string, max int) []FieldError {
+	if utf8.RuneCountInString(value) <= max {
+		return fields
+	}
+	return append(fields, FieldError{
+		Field:   field,
+		Code:    "too_long",
+		Message: fmt.Sprintf("polje smije imati najviše %d znakova", max),
+	})
+}
+
+// ChangePassword mijenja lozinku nakon provjere trenutne lozinke.
+// Neuspjele provjere broje se kao neuspjele prijave kako se ukradena sesija ne bi koristila za pogađanje lozinke.
+// Promjena opoziva sve postojeće tokene korisnika, a pozivatelj dobiva novi token.
+func (s *service) ChangePassword(c context.Context, userID int64, req *ChangePasswordReq) (*LoginUserRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	user, err := s.Repository.GetUserByID(ctx, userID)
+	if err != nil {
+		log.Println("Greška pri dohvaćanju korisnika:", err)
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	if err := s.limiter.Reserve(ctx, user.Email, req.IP); err != nil {
+		return nil, err
+	}
+	if err := util.CheckPassword(req.CurrentPassword, user.Password); err != nil {
+		log.Println("Neispravna trenutna lozinka za korisnika:", user.Email)
+		return nil, &ValidationError{Fields: []FieldError{{
+			Field:   "currentPassword",
+			Code:    "mismatch",
+			Message: "trenutna lozinka nije ispravna",
+		}}}
+	}
+	s.releaseAttempt(ctx, user.Email, req.IP)
+
+	fields, err := s.validatePassword(req.NewPassword, user.Username, user.Email)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) > 0 {
+		for i := range fields {
+			fields[i].Field = "newPassword"
+		}
+		return nil, &ValidationError{Fields: fields}
+	}
+
+	hashedPassword, err := util.HashPassword(req.NewPassword)
+	if err != nil {
+		return nil, err
+	}
+	tokenVersion, err := s.Repository.UpdatePassword(ctx, user.ID, hashedPassword)
+	if err != nil {
+		log.Println("Greška pri spremanju lozinke:", err)
+		return nil, err
+	}
+	user.TokenVersion = tokenVersion
+
+	s.recordLoginSuccess(ctx, user.Email)
+	log.Println("Lozinka promijenjena za korisnika:", user.Email)
+	return issueLogin(user)
+}
+
+// GetPublicProfile vraća javni profil korisnika.
+func (s *service) GetPublicProfile(c context.Context, userID int64) (*PublicProfileRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	user, err := s.Repository.GetUserByID(ctx, userID)
+	if err != nil {
+		log.Println("Greška pri dohvaćanju korisnika:", err)
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	return s.newPublicProfileRes(user), nil
+}
+
+// UploadAvatar dekodira sliku (JPEG, PNG ili WebP), izrezuje središnji kvadrat,
+// sprema ga u svim veličinama iz avatarSizes i briše prethodni avatar.
+func (s *service) UploadAvatar(c context.Context, userID int64, data []byte) (*ProfileRes, error) {
+	img, format, err := util.DecodeImage(data, "jpeg", "png", "webp")
+	if err != nil {
+		log.Println("Neispravna slika avatara:", err)
+		return nil, &ValidationError{Fields: []FieldError{{
+			Field:   "avatar",
+			Code:    "invalid_image",
+			Message: "avatar mora biti JPEG, PNG ili WebP slika",
+		}}}
+	}
+	log.Printf("Primljen %s avatar %dx%d", format, img.Bounds().Dx(), img.Bounds().Dy())
+
+	// Obrada slike može trajati pa timeout počinje tek nakon dekodiranja
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	user, err := s.Repository.GetUserByID(ctx, userID)
+	if err != nil {
+		log.Println("Greška pri dohvaćanju korisnika:", err)
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	// Novi ključ pri svakom uploadu kako klijenti ne bi prikazivali stari avatar iz cachea
+	version, err := randomToken(8)
+	if err != nil {
+		return nil, err
+	}
+	avatarKey := fmt.Sprintf("avatars/%d/%s", user.ID, version)
+
+	for _, size := range avatarSizes {
+		var buf bytes.Buffer
+		if err := util.EncodePNG(&buf, util.SquareThumbnail(img, size)); err != nil {
+			return nil, fmt.Errorf("failed to encode avatar: %w", err)
+		}
+		if err := s.avatars.Put(ctx, avatarObjectKey(avatarKey, size), &buf, "image/png"); err != nil {
+			log.Println("Greška pri spremanju avatara:", err)
+			return nil, err
+		}
+	}
+
+	if err := s.Repository.SetAvatar(ctx, user.ID, avatarKey); err != nil {
+		log.Println("Greška pri spremanju avatara u bazu:", err)
+		s.deleteAvatar(ctx, avatarKey)
+		return nil, err
+	}
+
+	s.deleteAvatar(ctx, user.AvatarKey)
+	user.AvatarKey = avatarKey
+
+	log.Println("Avatar ažuriran za korisnika:", user.Email)
+	return s.newProfileRes(user), nil
+}
+
+// deleteAvatar briše sve veličine avatara; greške se samo logiraju.
+func (s *service) deleteAvatar(ctx context.Context, avatarKey string) {
+	if avatarKey == "" {
+		return
+	}
+	for _, size := range avatarSizes {
+		if err := s.avatars.Delete(ctx, avatarObjectKey(avatarKey, size)); err != nil {
+			log.Println("Greška pri brisanju starog avatara:", err)
+		}
+	}
+}
+
+// avatarObjectKey vraća ključ objekta za zadanu veličinu avatara.
+func avatarObjectKey(avatarKey string, size int) string {
+	return fmt.Sprintf("%s-%d.png", avatarKey, size)
+}
+
+// avatarURLs vraća URL zadane veličine i URL-ove svih veličina (prazno ako korisnik nema avatar).
+func (s *service) avatarURLs(user *User) (string, map[string]string) {
+	if user.AvatarKey == "" {
+		return "", nil
+	}
+	urls := make(map[string]string, len(avatarSizes))
+	for _, size := range avatarSizes {
+		urls[strconv.Itoa(size)] = s.avatars.URL(avatarObjectKey(user.AvatarKey, size))
+	}
+	return urls[strconv.Itoa(defaultAvatarSize)], urls
+}
+
+// newPublicProfileRes gradi javni prikaz profila.
+func (s *service) newPublicProfileRes(user *User) *PublicProfileRes {
+	avatarURL, avatarURLs := s.avatarURLs(user)
+	return &PublicProfileRes{
+		ID:          strconv.Itoa(int(user.ID)),
+		Username:    user.Username,
+		DisplayName: user.DisplayName,
+		Bio:         user.Bio,
+		StatusText:  user.StatusText,
+		AvatarURL:   avatarURL,
+		AvatarURLs:  avatarURLs,
+	}
+}
+
+// newProfileRes gradi prikaz vlastitog profila.
+func (s *service) newProfileRes(user *User) *ProfileRes {
+	avatarURL, avatarURLs := s.avatarURLs(user)
+	return &ProfileRes{
+		ID:           strconv.Itoa(int(user.ID)),
+		Username:     user.Username,
+		Email:        user.Email,
+		DisplayName:  user.DisplayName,
+		Bio:          user.Bio,
+		StatusText:   user.StatusText,
+		TOTPEnabled:  user.TOTPEnabled,
+		Discoverable: user.Discoverable,
+		ContactsOnly: user.ContactsOnly,
+		Presence:     user.PresenceStatus,
+		CreatedAt:    user.CreatedAt,
+		AvatarURL:    avatarURL,
+		AvatarURLs:   avatarURLs,
+	}
+}
+
 // MYJWTClaims definira dodatne podatke unutar JWT tokena.
 type MYJWTClaims struct {
-	Username string `json:"username"`
-	ID       string `json:"id"`
+	Username     string `json:"username"`
+	ID           string `json:"id"`
+	TokenVersion int    `json:"ver"` // mora odgovarati users.token_version, inače je token opozvan
 	jwt.RegisteredClaims
 }
 
@@ -111,6 +529,12 @@ func (s *service) Login(c context.Context, req *LoginUserReq) (*LoginUserRes, er
 	req.Email = strings.ToLower(strings.TrimSpace(req.Email))
 	log.Println("Login pokušaj s emailom:", req.Email)
 
+	// Pokušaj se broji prije provjere lozinke; vraća se tek ako je lozinka ispravna
+	if err := s.limiter.Reserve(ctx, req.Email, req.IP); err != nil {
+		log.Println("Prijava blokirana:", req.Email, req.IP, err)
+		return nil, err
+	}
+
 	user, err := s.Repository.GetUserByEmail(ctx, req.Email)
 	if err != nil || user == nil {
 		log.Println("Greška pri dohvaćanju korisnika:", err)
@@ -123,19 +547,370 @@ func (s *service) Login(c context.Context, req *LoginUserReq) (*LoginUserRes, er
 		log.Println("Neispravna lozinka za korisnika:", user.Email)
 		return nil, fmt.Errorf("pogrešan email ili lozinka")
 	}
+	s.releaseAttempt(ctx, req.Email, req.IP)
+
+	s.rehashPassword(ctx, user, req.Password)
+
+	return s.loginOrChallenge(ctx, user)
+}
+
+// loginOrChallenge završava prijavu korisnika čiji je prvi faktor provjeren.
+// Korisnik s uključenim 2FA dobiva samo challenge token za VerifyLoginTOTP.
+func (s *service) loginOrChallenge(ctx context.Context, user *User) (*LoginUserRes, error) {
+	if !user.TOTPEnabled {
+		return s.completeLogin(ctx, user)
+	}
+
+	log.Println("Korisnik ima uključen 2FA. Izdajem challenge token...")
+	challenge, err := generateChallengeToken(user)
+	if err != nil {
+		log.Println("Greška pri potpisivanju challenge tokena:", err)
+		return nil, fmt.Errorf("nešto je pošlo po zlu s prijavom")
+	}
+	return &LoginUserRes{
+		TwoFactorRequired: true,
+		ChallengeToken:    challenge,
+	}, nil
+}
+
+// rehashPassword ponovno hashira lozinku ako je spremljena bcryptom ili zastarjelim argon2id parametrima.
+// Lozinka je u ovom trenutku već provjerena; greška se samo logira jer ne smije spriječiti prijavu.
+func (s *service) rehashPassword(ctx context.Context, user *User, password string) {
+	if !util.NeedsRehash(user.Password) {
+		return
+	}
+
+	hashedPassword, err := util.HashPassword(password)
+	if err != nil {
+		log.Println("Greška pri ponovnom hashiranju lozinke:", err)
+		return
+	}
+	if err := s.Repository.UpdatePasswordHash(ctx, user.ID, hashedPassword); err != nil {
+		log.Println("Greška pri spremanju novog hasha lozinke:", err)
+		return
+	}
+
+	user.Password = hashedPassword
+	log.Println("Lozinka ponovno hashirana za korisnika:", user.Email)
+}
+
+// releaseAttempt vraća unaprijed izbrojani pokušaj nakon ispravne lozinke ili koda;
+// greška storea ne smije srušiti prijavu.
+func (s *service) releaseAttempt(ctx context.Context, account, ip string) {
+	if err := s.limiter.Release(ctx, account, ip); err != nil {
+		log.Println("Greška pri vraćanju pokušaja prijave:", err)
+	}
+}
+
+// recordLoginSuccess resetira brojač računa nakon potpune prijave.
+func (s *service) recordLoginSuccess(ctx context.Context, account string) {
+	if err := s.limiter.Succeed(ctx, account); err != nil {
+		log.Println("Greška pri resetiranju brojača prijava:", err)
+	}
+}
+
+// VerifyLoginTOTP je drugi korak prijave za korisnike s uključenim 2FA.
+// Prihvaća TOTP kod iz autentikatora ili jedan od neiskorištenih recovery kodova.
+func (s *service) VerifyLoginTOTP(c context.Context, req *VerifyTOTPReq) (*LoginUserRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	claims := &challengeClaims{}
+	_, err := jwt.ParseWithClaims(req.ChallengeToken, claims, func(t *jwt.Token) (interface{}, error) {
+		return secretKey, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil || !claims.VerifyAudience(challengeAudience, true) {
+		log.Println("Neispravan challenge token:", err)
+		return nil, fmt.Errorf("prijava je istekla, pokušajte ponovno")
+	}
+
+	userID, err := strconv.ParseInt(claims.ID, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("prijava je istekla, pokušajte ponovno")
+	}
+
+	user, err := s.Repository.GetUserByID(ctx, userID)
+	if err != nil || user == nil || !user.TOTPEnabled {
+		log.Println("Greška pri dohvaćanju korisnika:", err)
+		return nil, fmt.Errorf("prijava je istekla, pokušajte ponovno")
+	}
+
+	// Isti limit kao za lozinku — inače bi se 6-znamenkasti kod mogao pogađati
+	if err := s.limiter.Reserve(ctx, user.Email, req.IP); err != nil {
+		log.Println("2FA prijava blokirana:", user.Email, req.IP, err)
+		return nil, err
+	}
+
+	if step, ok := util.MatchTOTP(user.TOTPSecret, req.Code, time.Now()); ok {
+		// Kod vrijedi cijeli korak (uz toleranciju), pa se isti kod ne smije prihvatiti dvaput
+		fresh, err := s.Repository.UseTOTPStep(ctx, user.ID, step)
+		if err != nil {
+			log.Println("Greška pri bilježenju TOTP koraka:", err)
+			return nil, fmt.Errorf("nešto je pošlo po zlu s prijavom")
+		}
+		if fresh {
+			log.Println("TOTP kod ispravan za korisnika:", user.Email)
+			s.releaseAttempt(ctx, user.Email, req.IP)
+			return s.completeLogin(ctx, user)
+		}
+		log.Println("TOTP kod već iskorišten za korisnika:", user.Email)
+		return nil, fmt.Errorf("neispravan kod")
+	}
+
+	codes, err := s.Repository.GetRecoveryCodes(ctx, user.ID)
+	if err != nil {
+		log.Println("Greška pri dohvaćanju recovery kodova:", err)
+		return nil, fmt.Errorf("nešto je pošlo po zlu s prijavom")
+	}
+	code := strings.ToLower(strings.TrimSpace(req.Code))
+	for _, rc := range codes {
+		if !util.CheckRecoveryCode(code, rc.CodeHash) {
+			continue
+		}
+		if err := s.Repository.UseRecoveryCode(ctx, rc.ID); err != nil {
+			log.Println("Recovery kod već iskorišten:", err)
+			break
+		}
+		log.Println("Korisnik se prijavio recovery kodom:", user.Email)
+		s.releaseAttempt(ctx, user.Email, req.IP)
+		return s.completeLogin(ctx, user)
+	}
+
+	log.Println("Neispravan 2FA kod za korisnika:", user.Email)
+	return nil, fmt.Errorf("neispravan kod")
+}
+
+// EnrollTOTP generira novi tajni ključ za korisnika i vraća otpauth URI.
+// 2FA nije uključen dok korisnik ne potvrdi prvi kod (ConfirmTOTP).
+func (s *service) EnrollTOTP(c context.Context, userID int64) (*EnrollTOTPRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	user, err := s.Repository.GetUserByID(ctx, userID)
+	if err != nil {
+		log.Println("Greška pri dohvaćanju korisnika:", err)
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	if user.TOTPEnabled {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+
+	secret, err := util.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Repository.SetTOTPSecret(ctx, user.ID, secret); err != nil {
+		log.Println("Greška pri spremanju TOTP ključa:", err)
+		return nil, err
+	}
+
+	return &EnrollTOTPRes{
+		Secret: secret,
+		URI:    util.TOTPURI(totpIssuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmTOTP provjerava prvi kod iz autentikatora, uključuje 2FA i vraća recovery kodove.
+func (s *service) ConfirmTOTP(c context.Context, userID int64, req *ConfirmTOTPReq) (*ConfirmTOTPRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	user, err := s.Repository.GetUserByID(ctx, userID)
+	if err != nil {
+		log.Println("Greška pri dohvaćanju korisnika:", err)
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	if user.TOTPEnabled {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrTOTPNotEnrolled
+	}
+	step, ok := util.MatchTOTP(user.TOTPSecret, req.Code, time.Now())
+	if !ok {
+		return nil, ErrInvalidTOTPCode
+	}
+
+	codes, err := util.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]string, 0, len(codes))
+	for _, code := range codes {
+		hash, err := util.HashRecoveryCode(code)
+		if err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, hash)
+	}
+
+	if err := s.Repository.EnableTOTP(ctx, user.ID, hashes); err != nil {
+		log.Println("Greška pri uključivanju 2FA:", err)
+		return nil, err
+	}
+	// Kod kojim je 2FA potvrđen ne smije poslužiti i za prijavu
+	if _, err := s.Repository.UseTOTPStep(ctx, user.ID, step); err != nil {
+		log.Println("Greška pri bilježenju TOTP koraka:", err)
+	}
+
+	log.Println("2FA uključen za korisnika:", user.Email)
+	return &ConfirmTOTPRes{RecoveryCodes: codes}, nil
+}
+
+// ParseAccessToken validira JWT pristupni token i vraća njegove claimove.
+// Challenge tokeni iz prvog koraka 2FA prijave ovdje se odbijaju, kao i tokeni
+// opozvani povećanjem token_version ili tokeni računa zakazanih za brisanje.
+func (s *service) ParseAccessToken(c context.Context, token string) (*MYJWTClaims, error) {
+	claims := &MYJWTClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		return secretKey, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return nil, err
+	}
+	if claims.VerifyAudience(challengeAudience, true) {
+		return nil, fmt.Errorf("challenge token nije pristupni token")
+	}
+
+	userID, err := strconv.ParseInt(claims.ID, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("neispravan ID u tokenu")
+	}
+
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	user, err := s.Repository.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || user.DeletionScheduledAt != nil || user.TokenVersion != claims.TokenVersion {
+		return nil, fmt.Errorf("token je opozvan")
+	}
+	return claims, nil
+}
+
+// LoginWithIdentity prijavljuje korisnika verificiranog kod vanjskog OIDC pružatelja:
+// - ako je identitet već povezan, koristi tog korisnika,
+// - inače povezuje postojećeg korisnika s istim (verificiranim) emailom,
+// - inače kreira novog korisnika s nasumičnom (neupotrebljivom) lozinkom.
+// Vanjski pružatelj zamjenjuje samo lozinku: korisnik s uključenim 2FA i dalje mora unijeti TOTP kod.
+func (s *service) LoginWithIdentity(c context.Context, identity *ExternalIdentity) (*LoginUserRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	user, err := s.Repository.GetUserByIdentity(ctx, identity.Provider, identity.Subject)
+	if err != nil {
+		log.Println("Greška pri dohvaćanju korisnika po identitetu:", err)
+		return nil, fmt.Errorf("nešto je pošlo po zlu s prijavom")
+	}
+	if user != nil {
+		log.Println("SSO prijava postojećeg korisnika:", user.Email)
+		return s.loginOrChallenge(ctx, user)
+	}
+
+	if identity.Email == "" || !identity.EmailVerified {
+		log.Println("SSO prijava odbijena — email nije verificiran:", identity.Email)
+		return nil, fmt.Errorf("email kod pružatelja identiteta nije verificiran")
+	}
+
+	user, err = s.Repository.GetUserByEmail(ctx, identity.Email)
+	if err != nil {
+		log.Println("Greška pri dohvaćanju korisnika:", err)
+		return nil, fmt.Errorf("nešto je pošlo po zlu s prijavom")
+	}
+
+	if user == nil {
+		log.Println("SSO prijava — kreiram novog korisnika:", identity.Email)
+		randomPassword, err := randomToken(32)
+		if err != nil {
+			return nil, err
+		}
+		hashedPassword, err := util.HashPassword(randomPassword)
+		if err != nil {
+			return nil, err
+		}
+		hint := identity.Username
+		if hint == "" {
+			hint = strings.SplitN(identity.Email, "@", 2)[0]
+		}
+		user, err = s.createUserWithFreeUsername(ctx, usernameFromHint(hint), &User{
+			Email:    identity.Email,
+			Password: hashedPassword,
+		})
+		if err != nil {
+			log.Println("Greška pri spremanju korisnika:", err)
+			return nil, fmt.Errorf("nešto je pošlo po zlu s prijavom")
+		}
+	}
+
+	if err := s.Repository.LinkIdentity(ctx, user.ID, identity.Provider, identity.Subject); err != nil {
+		log.Println("Greška pri povezivanju identiteta:", err)
+		return nil, fmt.Errorf("nešto je pošlo po zlu s prijavom")
+	}
+
+	log.Println("SSO identitet povezan s korisnikom:", user.Email)
+	return s.loginOrChallenge(ctx, user)
+}
+
+// createUserWithFreeUsername sprema korisnika pod prvim slobodnim imenom (base, base2, base3...).
+func (s *service) createUserWithFreeUsername(ctx context.Context, base string, user *User) (*User, error) {
+	const maxAttempts = 20
+	for i := 1; i <= maxAttempts; i++ {
+		user.Username = base
+		if i > 1 {
+			user.Username = fmt.Sprintf("%s%d", base, i)
+		}
+		created, err := s.Repository.CreateUser(ctx, user)
+		var conflict *ConflictError
+		if errors.As(err, &conflict) && conflict.Field == "username" {
+			continue
+		}
+		return created, err
+	}
+	return nil, fmt.Errorf("nema slobodnog korisničkog imena za %s", base)
+}
+
+// challengeClaims su claimovi kratkotrajnog tokena između dva koraka 2FA prijave.
+type challengeClaims struct {
+	ID string `json:"id"`
+	jwt.RegisteredClaims
+}
+
+// generateChallengeToken izdaje token koji vrijedi challengeTTL i služi samo za VerifyLoginTOTP.
+func generateChallengeToken(user *User) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, challengeClaims{
+		ID: strconv.Itoa(int(user.ID)),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    strconv.Itoa(int(user.ID)),
+			Audience:  jwt.ClaimStrings{challengeAudience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(challengeTTL)),
+		},
+	})
+	return token.SignedString(secretKey)
+}
 
-	log.Println("Lozinka ispravna. Generiram JWT token...")
+// issueLogin generira pravi JWT token i gradi odgovor uspješne prijave.
+func issueLogin(user *User) (*LoginUserRes, error) {
+	log.Println("Generiram JWT token...")
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, MYJWTClaims{
-		Username: user.Username,
-		ID:       strconv.Itoa(int(user.ID)),
+		Username:     user.Username,
+		ID:           strconv.Itoa(int(user.ID)),
+		TokenVersion: user.TokenVersion,
 		RegisteredClaims: jwt.RegisteredClaims{
 			Issuer:    strconv.Itoa(int(user.ID)),
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
 		},
 	})
 
-	signedToken, err := token.SignedString([]byte(secretKey))
+	signedToken, err := token.SignedString(secretKey)
 	if err != nil {
 		log.Println("Greška pri potpisivanju tokena:", err)
 		return nil, fmt.Errorf("nešto je pošlo po zlu s prijavom")
@@ -0,0 +1,79 @@
+// Package user - pravila za korisnička imena (handle):
+// - duljina i dopušteni znakovi,
+// - lista rezerviranih imena koja se ne mogu registrirati,
+// - generiranje ispravnog imena iz podataka vanjskog pružatelja identiteta (SSO).
+
+package user
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// usernamePattern dopušta slova, znamenke, točku, crticu i podvlaku; ime počinje slovom ili znamenkom.
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// reservedUsernames su imena rezervirana za sustav, podršku i posebne oznake u chatu (npr. @room, @here).
+// Uspoređuju se bez obzira na velika/mala slova.
+var reservedUsernames = map[string]struct{}{
+	"admin": {}, "administrator": {}, "root": {}, "system": {}, "sustav": {},
+	"support": {}, "podrska": {}, "help": {}, "moderator": {}, "mod": {},
+	"staff": {}, "security": {}, "official": {}, "gochat": {},
+	"me": {}, "api": {}, "auth": {}, "login": {}, "logout": {}, "signup": {},
+	"null": {}, "undefined": {}, "anonymous": {}, "deleted": {},
+	"everyone": {}, "here": {}, "room": {}, "channel": {},
+}
+
+// IsReservedUsername vraća true ako je ime rezervirano.
+func IsReservedUsername(username string) bool {
+	_, reserved := reservedUsernames[strings.ToLower(username)]
+	return reserved
+}
+
+// validateUsername provjerava duljinu, znakove i rezervirana imena.
+func validateUsername(username string) []FieldError {
+	if username == "" {
+		return []FieldError{{Field: "username", Code: "required", Message: "korisničko ime je obavezno"}}
+	}
+	if n := utf8.RuneCountInString(username); n < usernameMinLength || n > usernameMaxLength {
+		return []FieldError{{
+			Field:   "username",
+			Code:    "invalid_length",
+			Message: fmt.Sprintf("korisničko ime mora imati od %d do %d znakova", usernameMinLength, usernameMaxLength),
+		}}
+	}
+	if !usernamePattern.MatchString(username) {
+		return []FieldError{{
+			Field:   "username",
+			Code:    "invalid_characters",
+			Message: "korisničko ime smije sadržavati samo slova, znamenke, točku, crticu i podvlaku",
+		}}
+	}
+	if IsReservedUsername(username) {
+		return []FieldError{{Field: "username", Code: "reserved", Message: "korisničko ime je rezervirano"}}
+	}
+	return nil
+}
+
+// usernameFromHint pretvara ime iz vanjskog izvora (npr. "Ivan Horvat") u ispravan handle ("ivan.horvat").
+func usernameFromHint(hint string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(strings.TrimSpace(hint)) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+			b.WriteRune(r)
+		case r == ' ':
+			b.WriteRune('.')
+		}
+		if b.Len() >= usernameMaxLength-4 { // mjesto za brojčani sufiks
+			break
+		}
+	}
+	username := strings.TrimLeft(b.String(), "._-")
+	if utf8.RuneCountInString(username) < usernameMinLength || IsReservedUsername(username) {
+		username = "user" + username
+	}
+	return username
+}
@@ -0,0 +1,117 @@
+// Package websocket - privici chat poruka.
+// Datoteka se prvo uploada u sobu (POST /rooms/:roomID/attachments, multipart polje "file"),
+// a zatim šalje u chat poruci: {"type": "chat", "content": "...", "attachmentIds": [<ID privitka>]}.
+// Vrsta datoteke prepoznaje se iz sadržaja, a za slike se sprema i sličica.
+// Datoteke se ne poslužuju javno: svaki privitak nosi potpisane linkove s rokom trajanja
+// (GET /attachments/:attachmentID), vezane uz prijavljenog korisnika kojem su izdani i provjerene prema članstvu u sobi.
+// Upload koji nije poslan u poruci unutar 24 sata periodično se briše.
+
+package websocket
+
+import (
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"server/internal/user"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// thumbnailVariant je vrijednost parametra variant za preuzimanje sličice slike.
+const thumbnailVariant = "thumbnail"
+
+// attachmentPath vraća putanju pod kojom se preuzima privitak.
+func attachmentPath(id int64) string {
+	return "/attachments/" + strconv.FormatInt(id, 10)
+}
+
+// signAttachments vraća poruku s linkovima privitaka potpisanima za ovog klijenta.
+// Poruka se dijeli među svim klijentima sobe pa se mijenja samo kopija.
+func (client *Client) signAttachments(message *Message) *Message {
+	if len(message.Attachments) == 0 || client.rooms == nil {
+		return message
+	}
+	signed := *message
+	signed.Attachments = client.rooms.SignAttachments(message.Attachments, client.userID)
+	return &signed
+}
+
+// UploadAttachment prima datoteku za slanje u sobu (POST /rooms/:roomID/attachments).
+func (h *Handler) UploadAttachment(c *gin.Context) {
+	// Mala rezerva za multipart zaglavlja; veće tijelo zahtjeva se prekida
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, attachmentMaxBytes+64<<10)
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "privitak je prevelik (najviše 25 MB)"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "nedostaje datoteka privitka"})
+		return
+	}
+	if header.Size > attachmentMaxBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "privitak je prevelik (najviše 25 MB)"})
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, attachmentMaxBytes))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	attachment, err := h.rooms.UploadAttachment(c.Request.Context(), c.Param("roomID"), user.CurrentUserID(c), header.Filename, data)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, attachment)
+}
+
+// DownloadAttachment šalje datoteku privitka ili njenu sličicu (GET /attachments/:attachmentID).
+// Ne traži prijavu — pristup je određen potpisom linka (vidi Service.SignAttachments).
+func (h *Handler) DownloadAttachment(c *gin.Context) {
+	attachmentID, err := strconv.ParseInt(c.Param("attachmentID"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "neispravan ID privitka"})
+		return
+	}
+
+	query := c.Request.URL.Query()
+	attachment, content, err := h.rooms.OpenAttachment(c.Request.Context(), attachmentID, query)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	defer content.Close()
+
+	contentType, size := attachment.ContentType, attachment.Size
+	if query.Get("variant") == thumbnailVariant {
+		contentType, size = "image/png", -1
+	}
+	// Preglednik prikazuje samo slike; ostale datoteke se preuzimaju
+	disposition := "attachment"
+	if strings.HasPrefix(contentType, "image/") {
+		disposition = "inline"
+	}
+
+	c.DataFromReader(http.StatusOK, size, contentType, content, map[string]string{
+		"Content-Disposition":    mime.FormatMediaType(disposition, map[string]string{"filename": attachment.Filename}),
+		"X-Content-Type-Options": "nosniff",
+		"Cache-Control":          "private, max-age=300",
+	})
+	log.Printf("Preuzet privitak %d (%s)", attachment.ID, contentType)
+}
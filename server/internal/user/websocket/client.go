@@ -8,8 +8,11 @@
 package websocket
 
 import (
+	"context"
 	"encoding/json"
 	"log"
+	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
@@ -21,40 +24,151 @@ type Client struct {
 	ID         string          `json:"id"`
 	RoomID     string          `json:"roomID"`
 	Username   string          `json:"username"`
+	AvatarURL  string          `json:"avatarUrl,omitempty"`
+
+	key          string  // ključ veze u Room.Clients; jedinstven po vezi jer korisnik može imati više veza u sobi
+	userID       int64   // ID prijavljenog korisnika (0 ako klijent nije prijavljen)
+	contactsOnly bool    // prima li korisnik pozive samo od kontakata (stanje pri ulasku u sobu)
+	status       string  // ručno postavljen status prisutnosti (online, away, dnd)
+	rooms        Service // za spremanje poruka
+	typing       typingState
+
+	done      chan struct{} // zatvara se kad klijent napusti hub (Message kanal se ne zatvara)
+	closeOnce sync.Once
 }
 
 // Message predstavlja format poruke koji se koristi u komunikaciji.
 type Message struct {
-	Type     string          `json:"type"`           // npr. "chat", "join"
-	Data     json.RawMessage `json:"data,omitempty"` // opcionalni dodatni podaci
-	Content  string          `json:"content"`        // glavni tekst poruke
-	RoomID   string          `json:"roomId"`         // soba kojoj poruka pripada
-	Username string          `json:"username"`       // korisnik koji šalje poruku
+	ID        int64           `json:"id,omitempty"`        // ID spremljene poruke (samo chat poruke)
+	Type      string          `json:"type"`                // npr. "chat", "join"
+	Data      json.RawMessage `json:"data,omitempty"`      // opcionalni dodatni podaci
+	Content   string          `json:"content"`             // glavni tekst poruke
+	RoomID    string          `json:"roomId"`              // soba kojoj poruka pripada
+	Username  string          `json:"username"`            // korisnik koji šalje poruku
+	From      string          `json:"from,omitempty"`      // pošiljatelj signal poruke (vidi Hub.Run)
+	AvatarURL string          `json:"avatarUrl,omitempty"` // avatar pošiljatelja
+	CreatedAt *time.Time      `json:"createdAt,omitempty"` // vrijeme spremanja poruke
+	senderID  int64           // ID prijavljenog pošiljatelja (0 za sustav i neprijavljene)
+	sender    *Client         // klijent koji je poslao poruku (nil za sustav)
+
+	// Potvrda isporuke: klijent dodjeljuje chat poruci clientMsgId, a server ga vraća u "ack" poruci
+	ClientMsgID string `json:"clientMsgId,omitempty"`
+	Error       string `json:"error,omitempty"` // razlog odbijanja (samo ack poruke)
+
+	// Redni broj promjene u sobi (vidi resume.go); prolazne poruke ga nemaju
+	Seq int64 `json:"seq,omitempty"`
+
+	// Uređivanje i brisanje (vidi message_edit.go)
+	EditedAt  *time.Time `json:"editedAt,omitempty"`
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+
+	// Reakcije (vidi reaction.go): emoji koji je korisnik dodao ili uklonio i novi zbroj reakcija poruke
+	Emoji     string          `json:"emoji,omitempty"`
+	Reactions []ReactionCount `json:"reactions,omitempty"`
+
+	// Nit (vidi thread.go): početna poruka niti na koju chat poruka odgovara
+	ParentID int64 `json:"parentId,omitempty"`
+
+	// Privici (vidi attachment.go): klijent šalje ID-eve uploadanih privitaka, a sobi se šalju njihovi podaci
+	AttachmentIDs []int64       `json:"attachmentIds,omitempty"`
+	Attachments   []*Attachment `json:"attachments,omitempty"`
 }
 
-// WriteMessage šalje poruke iz Message kanala prema klijentu preko WebSocketa.
-func (client *Client) WriteMessage() {
-	defer client.Connection.Close()
+const (
+	readType = "read" // klijent javlja do koje je poruke pročitao sobu
+	ackType  = "ack"  // server potvrđuje (ili odbija) chat poruku pošiljatelju
+)
 
+// Održavanje veze: server šalje ping svakih pingPeriod, a veza bez ikakvog odgovora (pong ili poruka)
+// unutar pongWait smatra se prekinutom i klijent se odjavljuje iz huba. Tako poluotvorene veze
+// (npr. nakon promjene mreže na mobitelu) ne ostaju registrirane do isteka TCP-a.
+const (
+	writeWait  = 10 * time.Second    // najdulje trajanje jednog slanja klijentu
+	pongWait   = 60 * time.Second    // najdulje čekanje na pong ili poruku klijenta
+	pingPeriod = (pongWait * 9) / 10 // razmak između pingova (kraći od pongWait)
+)
+
+// WriteMessage šalje klijentu propuštene poruke (missed), a zatim poruke iz Message kanala preko WebSocketa.
+// Propuštene poruke idu prve jer su spremljene prije poruka koje su u sobu stigle nakon ulaska (vidi resume.go).
+// Usput šalje ping (vidi pingPeriod); ako slanje ne uspije, zatvara vezu pa ReadMessage odjavljuje klijenta.
+func (client *Client) WriteMessage(missed []*Message) {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		client.Connection.Close()
+	}()
+
+	for _, message := range missed {
+		if err := client.write(message); err != nil {
+			return
+		}
+	}
 	for {
-		message, ok := <-client.Message
-		if !ok {
-			// Kanal zatvoren — prekidamo slanje
+		select {
+		case message := <-client.Message:
+			log.Printf("Slanje [%s] poruke \"%s\" korisniku %s", message.Type, message.Content, client.Username)
+			if err := client.write(message); err != nil {
+				return
+			}
+		case <-ticker.C:
+			client.Connection.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := client.Connection.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case <-client.done:
+			// Klijent je napustio hub — prekidamo slanje
 			return
 		}
+	}
+}
 
-		log.Printf("Slanje [%s] poruke \"%s\" korisniku %s", message.Type, message.Content, client.Username)
-		client.Connection.WriteJSON(message)
+// write šalje jednu poruku klijentu s potpisanim linkovima privitaka i rokom za slanje (writeWait).
+func (client *Client) write(message *Message) error {
+	client.Connection.SetWriteDeadline(time.Now().Add(writeWait))
+	if err := client.Connection.WriteJSON(client.signAttachments(message)); err != nil {
+		log.Printf("Greška pri slanju poruke klijentu %s (ID: %s): %v", client.Username, client.ID, err)
+		return err
 	}
+	return nil
+}
+
+// deliver stavlja poruku u red klijenta bez blokiranja i vraća je li poruka prihvaćena.
+// Smije se pozvati bez ikakvog locka huba; klijent koji je napustio hub poruku samo odbacuje.
+// Klijent čiji je red pun ne prati poruke pa se odspaja, kako ne bi zaustavio hub ni pošiljatelja.
+func (client *Client) deliver(message *Message) bool {
+	select {
+	case <-client.done:
+		return false
+	default:
+	}
+	select {
+	case client.Message <- message:
+		return true
+	default:
+		log.Printf("Red poruka klijenta %s (ID: %s) je pun — odspajam ga", client.Username, client.ID)
+		client.Connection.Close() // ReadMessage tada završava i odjavljuje klijenta iz huba
+		return false
+	}
+}
+
+// close zaustavlja slanje poruka klijentu; poziva ga hub kad klijent napusti sobu.
+func (client *Client) close() {
+	client.closeOnce.Do(func() { close(client.done) })
 }
 
-// ReadMessage čita poruke s WebSocketa, dešifrira ih i prosljeđuje hubu za broadcast.
+// ReadMessage čita poruke s WebSocketa, dešifrira ih, sprema chat poruke i prosljeđuje hubu za broadcast.
 func (client *Client) ReadMessage(hub *Hub) {
 	defer func() {
+		client.stopTyping(hub)
 		hub.UnRegister <- client
 		client.Connection.Close()
 	}()
 
+	client.Connection.SetReadDeadline(time.Now().Add(pongWait))
+	client.Connection.SetPongHandler(func(string) error {
+		return client.Connection.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
 	for {
 		_, messageReceived, err := client.Connection.ReadMessage()
 		if err != nil {
@@ -66,6 +180,7 @@ func (client *Client) ReadMessage(hub *Hub) {
 			break
 		}
 
+		client.Connection.SetReadDeadline(time.Now().Add(pongWait))
 		log.Printf("Primljena poruka od %s: %s", client.Username, string(messageReceived))
 
 		var msg Message
@@ -78,13 +193,148 @@ func (client *Client) ReadMessage(hub *Hub) {
 		if msg.Type == "" {
 			msg.Type = "chat"
 		}
-		if msg.RoomID == "" {
-			msg.RoomID = client.RoomID
-		}
-		if msg.Username == "" {
+		// Klijent smije pisati samo u sobu u koju je ušao (DM sobe su privatne)
+		msg.RoomID = client.RoomID
+		// Prijavljeni korisnici uvijek pišu pod svojim imenom
+		if msg.Username == "" || client.userID != 0 {
 			msg.Username = client.Username
 		}
+		msg.AvatarURL = client.AvatarURL
+		msg.senderID = client.userID
+		msg.sender = client
+		// Seq dodjeljuje samo server pri spremanju poruke, a from hub pri slanju signala
+		msg.Seq = 0
+		msg.From = ""
+
+		// Tipkanje se ne sprema; hub ga prosljeđuje uz ograničenje učestalosti
+		if isTypingType(msg.Type) {
+			client.handleTyping(hub, msg.Type)
+			continue
+		}
 
+		// Uređivanje i brisanje mijenjaju spremljenu poruku umjesto slanja nove
+		if isMessageUpdateType(msg.Type) {
+			client.updateMessage(hub, &msg)
+			continue
+		}
+
+		// Reakcije se spremaju i javljaju sobi sa zbrojem reakcija poruke
+		if isReactionType(msg.Type) {
+			client.react(hub, &msg)
+			continue
+		}
+
+		// Prikvačivanje (samo moderatori) javlja se cijeloj sobi
+		if isPinType(msg.Type) {
+			client.pin(hub, &msg)
+			continue
+		}
+
+		// Oznaka pročitanosti se sprema i javlja ostalim članovima sobe
+		if msg.Type == readType {
+			client.markRead(hub, msg.ID)
+			continue
+		}
+
+		if msg.Type == persistedType {
+			if client.sendChat(hub, &msg) {
+				if msg.ParentID != 0 {
+					client.notifyThread(hub, &msg)
+				}
+				client.notifyMentions(hub, &msg)
+			}
+			continue
+		}
+
+		// Pozivi se bilježe u povijest poziva (izvoz podataka korisnika)
+		if msg.Type == callRequestType && client.rooms != nil {
+			if err := client.rooms.RecordCall(context.Background(), client.RoomID, client.userID); err != nil {
+				log.Println("Poziv nije zabilježen:", err)
+			}
+		}
 		hub.Broadcast <- &msg
 	}
 }
+
+// sendChat sprema chat poruku prije slanja kako bi dobila ID i seq i ostala u povijesti.
+// Pošiljatelj dobiva ack, a ponovno poslana poruka (isti clientMsgId) se ne sprema ni šalje dvaput.
+// Spremanje drži room.send kako bi poruke stizale redom po seq; isporuka i ack ga ne drže (vidi Hub.publish).
+// Vraća true ako je poruka poslana sobi.
+func (client *Client) sendChat(hub *Hub, msg *Message) bool {
+	room := hub.room(client.RoomID)
+	if room == nil {
+		return false
+	}
+
+	room.send.Lock()
+	if client.rooms != nil {
+		duplicate, err := client.rooms.SaveMessage(context.Background(), client.userID, msg)
+		if err != nil || duplicate {
+			room.send.Unlock()
+			if err != nil {
+				log.Println("Poruka nije spremljena:", err)
+			}
+			client.ack(msg, err)
+			return false
+		}
+	}
+	hub.publish(room, msg)
+
+	client.ack(msg, nil)
+	client.stopTyping(hub)
+	return true
+}
+
+// markRead pomiče oznaku pročitanosti klijenta i javlja je ostalim članovima sobe (ako se pomaknula).
+func (client *Client) markRead(hub *Hub, messageID int64) {
+	if client.userID == 0 || client.rooms == nil {
+		return
+	}
+	err := hub.publishSaved(client.RoomID, func() (*Message, error) {
+		lastRead, seq, err := client.rooms.MarkRoomRead(context.Background(), client.RoomID, client.userID, messageID)
+		if err != nil || seq == 0 {
+			return nil, err
+		}
+		marker := readMarker(client.RoomID, client.Username, client.userID, lastRead, seq)
+		marker.sender = client
+		return marker, nil
+	})
+	if err != nil {
+		log.Println("Oznaka pročitanosti nije spremljena:", err)
+	}
+}
+
+// readMarker gradi "read" poruku kojom se ostalim članovima javlja oznaka pročitanosti korisnika.
+// seq je seq pomaka oznake (vidi resume.go).
+func readMarker(roomID, username string, userID, lastRead, seq int64) *Message {
+	return &Message{
+		ID:       lastRead,
+		Type:     readType,
+		RoomID:   roomID,
+		Username: username,
+		Seq:      seq,
+		senderID: userID,
+	}
+}
+
+// ack javlja pošiljatelju je li chat poruka spremljena: ID, seq i vrijeme spremanja ili razlog odbijanja.
+// Šalje se samo za poruke s clientMsgId, izravno pošiljatelju (nije dio toka sobe, vidi resume.go).
+func (client *Client) ack(msg *Message, err error) {
+	if msg.ClientMsgID == "" || msg.Type != persistedType {
+		return
+	}
+
+	ack := &Message{
+		Type:        ackType,
+		RoomID:      msg.RoomID,
+		ClientMsgID: msg.ClientMsgID,
+	}
+	if err != nil {
+		ack.Error = clientError(err, "poruka nije spremljena")
+	} else {
+		ack.ID = msg.ID
+		ack.Seq = msg.Seq
+		ack.CreatedAt = msg.CreatedAt
+	}
+	client.deliver(ack)
+}
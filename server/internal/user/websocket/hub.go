@@ -1,96 +1,379 @@
 // Package websocket definira Hub koji koordinira sve sobe i klijente u aplikaciji.
 // Hub:
 // - drži mapirane sobe (RoomID → Room),
-// - prima nove klijente (Register),
+// - prima nove klijente (join),
 // - upravlja odlascima klijenata (UnRegister),
-// - distribuira poruke putem Broadcast kanala.
+// - distribuira poruke putem Broadcast kanala,
+// - prati prisutnost korisnika kroz sve sobe (vidi presence.go),
+// - spremljene poruke isporučuje redom po seq kako bi klijent nakon reconnecta mogao nastaviti (vidi resume.go).
 //
-// Poseban slučaj je "signal" poruka (npr. WebRTC), koja se šalje direktno svim klijentima osim pošiljatelja.
+// Hub klijentima nikad ne šalje blokirajuće (vidi Client.deliver), pa spor klijent ne zaustavlja hub ni pošiljatelja.
+//
+// Poseban slučaj je "signal" poruka (npr. WebRTC), koja se šalje svim klijentima osim pošiljatelja,
+// s imenom pošiljatelja u polju from.
+// Poruke korisnika (chat, signal, pozivi) ne isporučuju se primateljima s kojima pošiljatelj ima blokadu,
+// a pozivi se ne isporučuju korisnicima koji primaju pozive samo od kontakata.
 
 package websocket
 
 import (
-	"encoding/json"
 	"log"
 	"sync"
+)
 
-	"github.com/gorilla/websocket"
+const (
+	callRequestType = "call-request" // korisnik poziva ostale u sobi na poziv
+	signalType      = "signal"       // WebRTC signalizacija između sudionika poziva
 )
 
 // Room predstavlja jednu chat sobu i sve klijente unutar nje.
 type Room struct {
 	ID      string             `json:"id"`
 	Name    string             `json:"name"`
-	Clients map[string]*Client `json:"clients"` // Klijenti u sobi (po ID-u)
+	Kind    string             `json:"kind"`    // RoomKindGroup ili RoomKindDirect
+	Clients map[string]*Client `json:"clients"` // Veze klijenata u sobi (po ključu veze, vidi Client.key)
+
+	send sync.Mutex // Serializira spremanje poruka sobe kako bi seq rastao redom kojim se poruke isporučuju
+	out  sync.Mutex // Serializira isporuku spremljenih poruka i ulazak klijenata; drži se samo preko neblokirajućih slanja
+	seq  int64      // Seq zadnje isporučene poruke sobe (zaštićeno s out)
 }
 
 // Hub centralno upravlja svim sobama i porukama između njih.
 type Hub struct {
-	Rooms      map[string]*Room // Sobe: roomID → *Room
-	Register   chan *Client     // Kanal za registraciju novih klijenata
-	UnRegister chan *Client     // Kanal za odjavu klijenata
-	Broadcast  chan *Message    // Poruke koje treba poslati svim klijentima u sobi
-	mu         sync.RWMutex     // Zaštita pristupa mapama soba
+	Rooms      map[string]*Room  // Sobe: roomID → *Room
+	UnRegister chan *Client      // Kanal za odjavu klijenata
+	Broadcast  chan *Message     // Poruke koje treba poslati svim klijentima u sobi
+	blocks     map[[2]int64]bool // Parovi korisnika (manji ID, veći ID) između kojih postoji blokada
+	contacts   map[[2]int64]bool // Parovi korisnika koji su kontakti
+	mu         sync.RWMutex      // Zaštita pristupa mapama soba, blokada i prisutnosti
+
+	presence      map[int64]*userPresence // Spojeni korisnici: userID → stanje (zaštićeno s mu)
+	presenceStore PresenceStore           // Spremište vremena zadnje aktivnosti (nil = ne sprema se)
 }
 
 // NewHub inicijalizira novi WebSocket hub.
 func NewHub() *Hub {
 	return &Hub{
 		Rooms:      make(map[string]*Room),
-		Register:   make(chan *Client),
 		UnRegister: make(chan *Client),
 		Broadcast:  make(chan *Message, 5),
+		blocks:     make(map[[2]int64]bool),
+		contacts:   make(map[[2]int64]bool),
+		presence:   make(map[int64]*userPresence),
+	}
+}
+
+// AddRoom dodaje sobu u hub ako već nije učitana i vraća sobu iz huba.
+// lastSeq je seq zadnje spremljene promjene sobe u bazi; hub ga koristi ako sam još ne zna seq sobe.
+func (h *Hub) AddRoom(id, name, kind string, lastSeq int64) *Room {
+	h.mu.Lock()
+	room, ok := h.Rooms[id]
+	if !ok {
+		room = &Room{
+			ID:      id,
+			Name:    name,
+			Kind:    kind,
+			Clients: make(map[string]*Client),
+		}
+		h.Rooms[id] = room
+	}
+	h.mu.Unlock()
+
+	// Poruka spremljena prije čitanja lastSeq je isporučena dok se čekaju send i out
+	room.send.Lock()
+	room.out.Lock()
+	if lastSeq > room.seq {
+		room.seq = lastSeq
+	}
+	room.out.Unlock()
+	room.send.Unlock()
+	return room
+}
+
+// room vraća sobu iz huba ili nil ako soba nije učitana.
+func (h *Hub) room(id string) *Room {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.Rooms[id]
+}
+
+// SetBlocked bilježi postoji li blokada između dva korisnika (u bilo kojem smjeru).
+func (h *Hub) SetBlocked(userA, userB int64, blocked bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if blocked {
+		h.blocks[blockKey(userA, userB)] = true
+	} else {
+		delete(h.blocks, blockKey(userA, userB))
+	}
+}
+
+// SetContact bilježi jesu li dva korisnika kontakti.
+func (h *Hub) SetContact(userA, userB int64, contacts bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if contacts {
+		h.contacts[blockKey(userA, userB)] = true
+	} else {
+		delete(h.contacts, blockKey(userA, userB))
+	}
+}
+
+// suppressed vraća true ako se poruka ne smije isporučiti klijentu zbog blokade s pošiljateljem
+// ili zato što klijent prima pozive samo od kontakata.
+func (h *Hub) suppressed(message *Message, c *Client) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.suppressedLocked(message, c)
+}
+
+// suppressedLocked je suppressed za pozive dok je h.mu zaključan.
+func (h *Hub) suppressedLocked(message *Message, c *Client) bool {
+	if message.senderID == 0 || c.userID == 0 {
+		return false
+	}
+	key := blockKey(message.senderID, c.userID)
+	if h.blocks[key] {
+		return true
+	}
+	return message.Type == callRequestType && c.contactsOnly && !h.contacts[key]
+}
+
+// echoedToSender vraća false za poruke koje se ne vraćaju pošiljatelju (tipkanje, oznake pročitanosti, signal).
+func echoedToSender(messageType string) bool {
+	return !isTypingType(messageType) && messageType != readType && messageType != signalType
+}
+
+// sendToUsers šalje poruku svim vezama zadanih korisnika, osim veza u sobi excludeRoomID.
+// Pošiljatelj (senderID) i korisnici s kojima ima blokadu se preskaču.
+// Veze se prikupljaju pod lockom huba, a poruka se šalje nakon otključavanja bez blokiranja (vidi deliverAll).
+func (h *Hub) sendToUsers(userIDs []int64, senderID int64, excludeRoomID string, message *Message) {
+	deliverAll(h.userDeliveries(userIDs, senderID, excludeRoomID, message))
+}
+
+// userDeliveries vraća isporuke poruke vezama korisnika za sendToUsers.
+func (h *Hub) userDeliveries(userIDs []int64, senderID int64, excludeRoomID string, message *Message) []delivery {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	recipients := make(map[int64]bool, len(userIDs))
+	for _, id := range userIDs {
+		if id != senderID && !h.blocks[blockKey(id, senderID)] {
+			recipients[id] = true
+		}
+	}
+
+	var deliveries []delivery
+	for _, room := range h.Rooms {
+		if room.ID == excludeRoomID {
+			continue
+		}
+		for _, c := range room.Clients {
+			if c.userID != 0 && recipients[c.userID] {
+				deliveries = append(deliveries, delivery{client: c, message: message})
+			}
+		}
+	}
+	return deliveries
+}
+
+// roomUserIDs vraća ID-eve prijavljenih korisnika spojenih u sobu.
+func (h *Hub) roomUserIDs(roomID string) []int64 {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	room, ok := h.Rooms[roomID]
+	if !ok {
+		return nil
+	}
+	ids := make([]int64, 0, len(room.Clients))
+	for _, c := range room.Clients {
+		if c.userID != 0 {
+			ids = append(ids, c.userID)
+		}
+	}
+	return ids
+}
+
+// messageNotice gradi obavijest (npr. spominjanje, odgovor u niti) o spremljenoj chat poruci.
+// RoomID obavijesti je soba poruke, neovisno o sobi u kojoj je primatelj spojen.
+func messageNotice(noticeType string, message *Message) *Message {
+	return &Message{
+		ID:        message.ID,
+		Type:      noticeType,
+		Content:   message.Content,
+		RoomID:    message.RoomID,
+		Username:  message.Username,
+		AvatarURL: message.AvatarURL,
+		CreatedAt: message.CreatedAt,
+		ParentID:  message.ParentID,
+
+		Attachments: message.Attachments,
 	}
 }
 
+// delivery je poruka za jednog klijenta, prikupljena pod lockom huba i poslana nakon otključavanja.
+type delivery struct {
+	client  *Client
+	message *Message
+}
+
+// roomDeliveriesLocked vraća isporuke poruke klijentima u sobi, bez klijenata kojima je poruka potisnuta
+// (vidi suppressed) i bez pošiljatelja za poruke koje mu se ne vraćaju. Poziva se dok je h.mu zaključan.
+func (h *Hub) roomDeliveriesLocked(room *Room, message *Message) []delivery {
+	deliveries := make([]delivery, 0, len(room.Clients))
+	for _, c := range room.Clients {
+		if h.suppressedLocked(message, c) {
+			continue
+		}
+		if c == message.sender && !echoedToSender(message.Type) {
+			continue
+		}
+		deliveries = append(deliveries, delivery{client: c, message: message})
+	}
+	return deliveries
+}
+
+// roomDeliveries je roomDeliveriesLocked za pozive bez locka huba.
+func (h *Hub) roomDeliveries(room *Room, message *Message) []delivery {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.roomDeliveriesLocked(room, message)
+}
+
+// publish isporučuje spremljenu poruku (sa seq) sobi i pomiče seq isporučenih poruka sobe.
+// Poziva se dok je room.send zaključan i otključava ga: room.out se zaključava prije otključavanja
+// room.send, pa poruke stižu redom kojim su spremljene, a sljedeće spremanje ne čeka isporuku.
+func (h *Hub) publish(room *Room, message *Message) {
+	room.out.Lock()
+	room.send.Unlock()
+	defer room.out.Unlock()
+
+	if message.Seq > room.seq {
+		room.seq = message.Seq
+	}
+	deliverAll(h.roomDeliveries(room, message))
+}
+
+// publishSaved sprema poruku sobe funkcijom save dok je room.send zaključan, kako bi dobila seq redom,
+// i isporučuje vraćenu poruku sobi (vidi publish). Ako soba nije učitana u hub, poruka se samo sprema.
+// Ako save ne vrati poruku (npr. ništa se nije promijenilo), sobi se ništa ne šalje.
+func (h *Hub) publishSaved(roomID string, save func() (*Message, error)) error {
+	room := h.room(roomID)
+	if room == nil {
+		_, err := save()
+		return err
+	}
+
+	room.send.Lock()
+	message, err := save()
+	if err != nil || message == nil {
+		room.send.Unlock()
+		return err
+	}
+	h.publish(room, message)
+	return nil
+}
+
+// join registrira klijenta u sobi i vraća seq zadnje isporučene poruke sobe:
+// spremljene poruke do tog seq klijent dobiva iz povijesti (vidi resume.go), a novije stižu u Message kanal.
+// Korisnik može imati više veza u istoj sobi (više uređaja ili reconnect prije nego što se stara veza
+// zatvori); sobi se javlja samo njegov prvi ulazak. Vraća false ako soba nije učitana.
+func (h *Hub) join(client *Client) (int64, bool) {
+	room := h.room(client.RoomID)
+	if room == nil {
+		log.Printf("Soba %s ne postoji — klijent %s nije registriran.", client.RoomID, client.Username)
+		return 0, false
+	}
+
+	room.out.Lock()
+	defer room.out.Unlock()
+
+	h.mu.Lock()
+	var notice []delivery
+	if !room.hasUserLocked(client) {
+		notice = h.roomDeliveriesLocked(room, &Message{
+			Type:     "notification",
+			Content:  client.Username + " se pridružio sobi.",
+			Username: "sustav",
+			RoomID:   client.RoomID,
+		})
+	}
+	room.Clients[client.key] = client
+	log.Printf("Klijent %s (ID: %s) ušao u sobu %s", client.Username, client.ID, client.RoomID)
+	presence := h.connected(client)
+	h.mu.Unlock()
+
+	deliverAll(notice)
+	deliverAll(presence)
+	return room.seq, true
+}
+
+// hasUserLocked vraća true ako je korisnik klijenta već spojen u sobu drugom vezom.
+// Neprijavljeni klijenti nemaju drugih veza. Poziva se dok je h.mu zaključan.
+func (room *Room) hasUserLocked(client *Client) bool {
+	if client.userID == 0 {
+		return false
+	}
+	for _, c := range room.Clients {
+		if c != client && c.userID == client.userID {
+			return true
+		}
+	}
+	return false
+}
+
+// deliverAll šalje prikupljene poruke bez blokiranja (vidi Client.deliver); poziva se bez locka huba.
+func deliverAll(deliveries []delivery) {
+	for _, d := range deliveries {
+		d.client.deliver(d.message)
+	}
+}
+
+// blockKey vraća ključ para korisnika neovisan o redoslijedu.
+func blockKey(a, b int64) [2]int64 {
+	if a > b {
+		a, b = b, a
+	}
+	return [2]int64{a, b}
+}
+
 // Run pokreće glavni loop koji obrađuje sve WebSocket događaje.
 func (h *Hub) Run() {
 	for {
 		select {
 
-		// Novi klijent želi ući u sobu
-		case newClient := <-h.Register:
-			h.mu.Lock()
-			room, ok := h.Rooms[newClient.RoomID]
-			if ok {
-				if _, exists := room.Clients[newClient.ID]; !exists {
-					room.Clients[newClient.ID] = newClient
-					log.Printf("Klijent %s (ID: %s) ušao u sobu %s",
-						newClient.Username, newClient.ID, newClient.RoomID)
-
-					h.Broadcast <- &Message{
-						Type:     "notification",
-						Content:  newClient.Username + " se pridružio sobi.",
-						Username: "sustav",
-						RoomID:   newClient.RoomID,
-					}
-				}
-			} else {
-				log.Printf("Soba %s ne postoji — klijent %s nije registriran.",
-					newClient.RoomID, newClient.Username)
-			}
-			h.mu.Unlock()
-
 		// Klijent napušta sobu
 		case leavingClient := <-h.UnRegister:
+			var notice, presence []delivery
 			h.mu.Lock()
 			if room, ok := h.Rooms[leavingClient.RoomID]; ok {
-				if _, exists := room.Clients[leavingClient.ID]; exists {
+				if room.Clients[leavingClient.key] == leavingClient {
 					log.Printf("Klijent %s (ID: %s) napustio sobu %s",
 						leavingClient.Username, leavingClient.ID, leavingClient.RoomID)
 
-					h.Broadcast <- &Message{
-						Type:     "notification",
-						Content:  leavingClient.Username + " je napustio sobu.",
-						Username: "sustav",
-						RoomID:   leavingClient.RoomID,
-					}
+					presence = h.disconnected(leavingClient)
+					delete(room.Clients, leavingClient.key)
+					leavingClient.close()
 
-					delete(room.Clients, leavingClient.ID)
-					close(leavingClient.Message)
+					if !room.hasUserLocked(leavingClient) {
+						notice = h.roomDeliveriesLocked(room, &Message{
+							Type:     "notification",
+							Content:  leavingClient.Username + " je napustio sobu.",
+							Username: "sustav",
+							RoomID:   leavingClient.RoomID,
+						})
+					}
 				}
 			}
 			h.mu.Unlock()
+			deliverAll(notice)
+			deliverAll(presence)
 
 		// Obrada poruka koje dolaze na Broadcast kanal
 		case message := <-h.Broadcast:
@@ -106,42 +389,12 @@ func (h *Hub) Run() {
 			log.Printf("Broadcast u sobu %s: \"%s\" od %s",
 				message.RoomID, message.Content, message.Username)
 
-			if message.Type == "signal" {
-				// Signal poruke se šalju direktno kao JSON
-				payload := struct {
-					Type   string          `json:"type"`
-					RoomID string          `json:"roomId"`
-					From   string          `json:"from"`
-					Data   json.RawMessage `json:"data"`
-				}{
-					Type:   message.Type,
-					RoomID: message.RoomID,
-					From:   message.Username,
-					Data:   message.Data,
-				}
-
-				bts, err := json.Marshal(payload)
-				if err != nil {
-					log.Printf("Greška kod signal poruke (marshal): %v", err)
-					continue
-				}
-
-				for _, c := range room.Clients {
-					if c.Username == message.Username {
-						continue // ne šaljemo samom sebi
-					}
-					log.Printf("Slanje SIGNAL poruke korisniku %s (ID: %s)",
-						c.Username, c.ID)
-					c.Connection.WriteMessage(websocket.TextMessage, bts)
-				}
-			} else {
-				// Chat i notifikacijske poruke — idu kroz kanal
-				for _, c := range room.Clients {
-					log.Printf("Slanje PORUKE korisniku %s (ID: %s)",
-						c.Username, c.ID)
-					c.Message <- message
-				}
+			if message.Type == signalType {
+				// Primatelji signala prepoznaju pošiljatelja po from
+				message.From = message.Username
 			}
+			// Prolazne poruke (bez seq) — idu kroz kanal klijenta; spremljene poruke šalje publish
+			deliverAll(h.roomDeliveries(room, message))
 		}
 	}
 }
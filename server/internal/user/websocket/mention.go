@@ -0,0 +1,82 @@
+// Package websocket - spominjanja korisnika (@mentions).
+// Iz sadržaja spremljene chat poruke čitaju se:
+// - @korisnik — član sobe s tim korisničkim imenom,
+// - @room — svi članovi sobe,
+// - @here — korisnici koji su trenutno spojeni u sobu.
+// Spominjanja se spremaju, a spomenuti korisnici dobivaju "mention" obavijest na sve svoje veze
+// (i u drugim sobama). Popis spominjanja dostupan je na GET /me/mentions.
+// Spominjati smiju samo prijavljeni korisnici, a @room i @here samo članovi sobe.
+
+package websocket
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"regexp"
+	"server/internal/user"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// mentionType je vrsta obavijesti o spominjanju korisnika.
+const mentionType = "mention"
+
+// Posebna spominjanja (rezervirana korisnička imena, vidi user.IsReservedUsername).
+const (
+	mentionRoom = "room" // svi članovi sobe
+	mentionHere = "here" // korisnici spojeni u sobu
+)
+
+// mentionPattern pronalazi @ime koje ne slijedi slovo, znamenku ili @ (npr. u e-mail adresi).
+var mentionPattern = regexp.MustCompile(`(?:^|[^A-Za-z0-9._@-])@([A-Za-z0-9][A-Za-z0-9._-]*)`)
+
+// parseMentions vraća korisnička imena spomenuta u sadržaju (malim slovima, bez ponavljanja)
+// te jesu li spomenuti @room i @here.
+func parseMentions(content string) (usernames []string, room, here bool) {
+	seen := make(map[string]bool)
+	for _, match := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		// Interpunkcija na kraju rečenice nije dio imena ("pozdrav @ivan.")
+		name := strings.ToLower(strings.TrimRight(match[1], ".-"))
+		switch {
+		case name == mentionRoom:
+			room = true
+		case name == mentionHere:
+			here = true
+		case name != "" && !seen[name]:
+			seen[name] = true
+			usernames = append(usernames, name)
+		}
+	}
+	return usernames, room, here
+}
+
+// notifyMentions sprema spominjanja u poslanoj chat poruci i šalje obavijest spomenutim korisnicima.
+func (client *Client) notifyMentions(hub *Hub, msg *Message) {
+	if client.rooms == nil || client.userID == 0 {
+		return
+	}
+	mentioned, err := client.rooms.SaveMentions(context.Background(), msg, hub.roomUserIDs(msg.RoomID))
+	if err != nil {
+		log.Println("Greška pri spremanju spominjanja:", err)
+		return
+	}
+	if len(mentioned) > 0 {
+		hub.sendToUsers(mentioned, msg.senderID, "", messageNotice(mentionType, msg))
+	}
+}
+
+// GetMentions vraća spominjanja prijavljenog korisnika (GET /me/mentions, ?limit=, ?offset=).
+func (h *Handler) GetMentions(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	offset, _ := strconv.Atoi(c.Query("offset"))
+
+	res, err := h.rooms.GetMentions(c.Request.Context(), user.CurrentUserID(c), limit, offset)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
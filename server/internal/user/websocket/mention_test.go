@@ -0,0 +1,45 @@
+package websocket
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMentions(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		usernames []string
+		room      bool
+		here      bool
+	}{
+		{"none", "dobro jutro svima", nil, false, false},
+		{"single", "@ivan dobro jutro", []string{"ivan"}, false, false},
+		{"lowercase", "pozdrav @Ivan i @ANA", []string{"ivan", "ana"}, false, false},
+		{"sentence end", "pozdrav @ivan.", []string{"ivan"}, false, false},
+		{"trailing dash", "hvala @ana-", []string{"ana"}, false, false},
+		{"dot inside name", "@ivan.horvat stiže", []string{"ivan.horvat"}, false, false},
+		{"punctuation", "(@ana), @ivan! @marko?", []string{"ana", "ivan", "marko"}, false, false},
+		{"adjacent mentions", "@ana,@ivan", []string{"ana", "ivan"}, false, false},
+		{"duplicates", "@ivan @ana @Ivan @ivan.", []string{"ivan", "ana"}, false, false},
+		{"email", "piši na ivan@example.com", nil, false, false},
+		{"email next to mention", "@ana piši na ivan@example.com", []string{"ana"}, false, false},
+		{"double at", "@@ivan", nil, false, false},
+		{"inside word", "ana@ivan i x.@marko", nil, false, false},
+		{"lone at", "@ i @. i @-ivan", nil, false, false},
+		{"room", "@room sastanak u 10", nil, true, false},
+		{"here", "tko je tu @here?", nil, false, true},
+		{"room and here", "@ROOM @Here @ana", []string{"ana"}, true, true},
+		{"room prefix", "@roomba i @herenow", []string{"roomba", "herenow"}, false, false},
+		{"room at sentence end", "javljam @room.", nil, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usernames, room, here := parseMentions(tt.content)
+			if !reflect.DeepEqual(usernames, tt.usernames) || room != tt.room || here != tt.here {
+				t.Fatalf("parseMentions(%q) = %q, %v, %v, want %q, %v, %v",
+					tt.content, usernames, room, here, tt.usernames, tt.room, tt.here)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+// Package websocket - uređivanje i brisanje poruka.
+// Klijent šalje kroz WebSocket:
+// - {"type": "message-edit", "id": <ID poruke>, "content": "novi sadržaj"},
+// - {"type": "message-delete", "id": <ID poruke>},
+// a isto je dostupno i kroz REST (PATCH i DELETE /rooms/:roomID/messages/:messageID).
+//
+// Poruku smiju mijenjati njen autor i moderator sobe. Izmjena se šalje svim članovima sobe
+// (i pošiljatelju) kako bi klijenti ažurirali poruku na mjestu; neuspjeh dobiva samo pošiljatelj.
+// Izmjena dobiva novi seq sobe pa je klijent koji nastavlja sesiju dobiva ponovno (vidi resume.go).
+
+package websocket
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"server/internal/user"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Vrste poruka za uređivanje i brisanje.
+const (
+	messageEditType   = "message-edit"
+	messageDeleteType = "message-delete"
+)
+
+// isMessageUpdateType vraća true za message-edit i message-delete poruke.
+func isMessageUpdateType(messageType string) bool {
+	return messageType == messageEditType || messageType == messageDeleteType
+}
+
+// updateMessage obrađuje message-edit ili message-delete poruku klijenta.
+func (client *Client) updateMessage(hub *Hub, msg *Message) {
+	if client.rooms == nil {
+		return
+	}
+
+	err := hub.publishSaved(client.RoomID, func() (*Message, error) {
+		var stored *StoredMessage
+		var err error
+		if msg.Type == messageEditType {
+			stored, err = client.rooms.EditMessage(context.Background(), client.RoomID, client.userID, msg.ID, msg.Content)
+		} else {
+			stored, err = client.rooms.DeleteMessage(context.Background(), client.RoomID, client.userID, msg.ID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return messageUpdate(msg.Type, stored), nil
+	})
+	if err != nil {
+		log.Println("Poruka nije izmijenjena:", err)
+		client.deliver(&Message{
+			Type:   msg.Type,
+			ID:     msg.ID,
+			RoomID: client.RoomID,
+			Error:  clientError(err, "poruka nije izmijenjena"),
+		})
+	}
+}
+
+// clientError vraća razlog neuspjele radnje koji se smije poslati klijentu;
+// za neočekivane greške vraća fallback.
+func clientError(err error, fallback string) string {
+	var validation *user.ValidationError
+	switch {
+	case errors.As(err, &validation):
+		return validation.Error()
+	case errors.Is(err, ErrMessageNotFound), errors.Is(err, ErrForbidden):
+		return err.Error()
+	}
+	return fallback
+}
+
+// messageUpdate gradi message-edit ili message-delete poruku sa seq izmjene.
+// Pošiljatelj je autor poruke, pa je ne dobivaju korisnici s kojima autor ima blokadu.
+func messageUpdate(messageType string, stored *StoredMessage) *Message {
+	return &Message{
+		ID:        stored.ID,
+		Type:      messageType,
+		Content:   stored.Content,
+		RoomID:    stored.RoomID,
+		Username:  stored.Username,
+		CreatedAt: &stored.CreatedAt,
+		EditedAt:  stored.EditedAt,
+		DeletedAt: stored.DeletedAt,
+		ParentID:  stored.ParentID,
+		Seq:       stored.UpdateSeq,
+		senderID:  stored.UserID,
+	}
+}
+
+// EditMessage mijenja sadržaj poruke (PATCH /rooms/:roomID/messages/:messageID).
+func (h *Handler) EditMessage(c *gin.Context) {
+	messageID, err := strconv.ParseInt(c.Param("messageID"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "neispravan ID poruke"})
+		return
+	}
+	var req EditMessageReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	roomID := c.Param("roomID")
+	var stored *StoredMessage
+	err = h.hub.publishSaved(roomID, func() (*Message, error) {
+		var err error
+		if stored, err = h.rooms.EditMessage(c.Request.Context(), roomID, user.CurrentUserID(c), messageID, req.Content); err != nil {
+			return nil, err
+		}
+		return messageUpdate(messageEditType, stored), nil
+	})
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, stored)
+}
+
+// DeleteMessage briše poruku (DELETE /rooms/:roomID/messages/:messageID).
+func (h *Handler) DeleteMessage(c *gin.Context) {
+	messageID, err := strconv.ParseInt(c.Param("messageID"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "neispravan ID poruke"})
+		return
+	}
+
+	roomID := c.Param("roomID")
+	var stored *StoredMessage
+	err = h.hub.publishSaved(roomID, func() (*Message, error) {
+		var err error
+		if stored, err = h.rooms.DeleteMessage(c.Request.Context(), roomID, user.CurrentUserID(c), messageID); err != nil {
+			return nil, err
+		}
+		return messageUpdate(messageDeleteType, stored), nil
+	})
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, stored)
+}
@@ -0,0 +1,135 @@
+// Package websocket - prikvačene poruke.
+// Moderator sobe prikvačuje i otkvačuje poruke kroz WebSocket ({"type": "pin", "id": <ID poruke>}
+// ili "unpin") ili REST (POST i DELETE /rooms/:roomID/pins/:messageID).
+// Promjena se šalje cijeloj sobi kao "pin" (s prikvačenom porukom) ili "unpin" poruka sa seq promjene;
+// klijent koji nastavlja sesiju nakon takve promjene dobiva resync (vidi resume.go),
+// a popis prikvačenih poruka dostupan je na GET /rooms/:roomID/pins.
+
+package websocket
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"server/internal/user"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Vrste poruka za prikvačivanje.
+const (
+	pinType   = "pin"
+	unpinType = "unpin"
+)
+
+// isPinType vraća true za pin i unpin poruke.
+func isPinType(messageType string) bool {
+	return messageType == pinType || messageType == unpinType
+}
+
+// pin obrađuje pin ili unpin poruku klijenta.
+func (client *Client) pin(hub *Hub, msg *Message) {
+	if client.rooms == nil {
+		return
+	}
+
+	err := hub.publishSaved(client.RoomID, func() (*Message, error) {
+		var pinned *Pin
+		var seq int64
+		var err error
+		if msg.Type == pinType {
+			pinned, seq, err = client.rooms.PinMessage(context.Background(), client.RoomID, client.userID, msg.ID)
+		} else {
+			seq, err = client.rooms.UnpinMessage(context.Background(), client.RoomID, client.userID, msg.ID)
+		}
+		if err != nil || seq == 0 {
+			return nil, err
+		}
+		return pinMessage(client.RoomID, msg.ID, pinned, seq), nil
+	})
+	if err != nil {
+		log.Println("Poruka nije prikvačena:", err)
+		client.deliver(&Message{
+			Type:   msg.Type,
+			ID:     msg.ID,
+			RoomID: client.RoomID,
+			Error:  clientError(err, "poruka nije prikvačena"),
+		})
+	}
+}
+
+// pinMessage gradi pin poruku s prikvačenom porukom ili unpin poruku (pinned == nil) sa seq promjene.
+func pinMessage(roomID string, messageID int64, pinned *Pin, seq int64) *Message {
+	if pinned == nil {
+		return &Message{Type: unpinType, ID: messageID, RoomID: roomID, Seq: seq}
+	}
+	return &Message{
+		ID:        pinned.Message.ID,
+		Type:      pinType,
+		Content:   pinned.Message.Content,
+		RoomID:    roomID,
+		Username:  pinned.Message.Username,
+		CreatedAt: &pinned.Message.CreatedAt,
+		ParentID:  pinned.Message.ParentID,
+		Seq:       seq,
+	}
+}
+
+// GetPins vraća prikvačene poruke sobe (GET /rooms/:roomID/pins).
+func (h *Handler) GetPins(c *gin.Context) {
+	pins, err := h.rooms.GetPins(c.Request.Context(), c.Param("roomID"), user.CurrentUserID(c))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, pins)
+}
+
+// PinMessage prikvačuje poruku (POST /rooms/:roomID/pins/:messageID).
+func (h *Handler) PinMessage(c *gin.Context) {
+	messageID, err := strconv.ParseInt(c.Param("messageID"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "neispravan ID poruke"})
+		return
+	}
+
+	roomID := c.Param("roomID")
+	var pinned *Pin
+	err = h.hub.publishSaved(roomID, func() (*Message, error) {
+		var seq int64
+		var err error
+		if pinned, seq, err = h.rooms.PinMessage(c.Request.Context(), roomID, user.CurrentUserID(c), messageID); err != nil || seq == 0 {
+			return nil, err
+		}
+		return pinMessage(roomID, messageID, pinned, seq), nil
+	})
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, pinned)
+}
+
+// UnpinMessage otkvačuje poruku (DELETE /rooms/:roomID/pins/:messageID).
+func (h *Handler) UnpinMessage(c *gin.Context) {
+	messageID, err := strconv.ParseInt(c.Param("messageID"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "neispravan ID poruke"})
+		return
+	}
+
+	roomID := c.Param("roomID")
+	err = h.hub.publishSaved(roomID, func() (*Message, error) {
+		seq, err := h.rooms.UnpinMessage(c.Request.Context(), roomID, user.CurrentUserID(c), messageID)
+		if err != nil || seq == 0 {
+			return nil, err
+		}
+		return pinMessage(roomID, messageID, nil, seq), nil
+	})
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "poruka otkvačena"})
+}
@@ -0,0 +1,168 @@
+// Package websocket - globalna prisutnost korisnika.
+// Hub broji veze svakog prijavljenog korisnika kroz sve sobe:
+// - prva veza korisnika znači da je online (ili u ručno postavljenom statusu away/dnd),
+// - kad se zatvori zadnja veza, korisnik je offline i sprema se vrijeme zadnje aktivnosti,
+// - svaka promjena šalje se kao "presence" poruka kontaktima i članovima soba u kojima je korisnik.
+
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"server/internal/user"
+	"strconv"
+	"time"
+)
+
+// presenceType je vrsta poruke kojom hub javlja promjenu prisutnosti.
+const presenceType = "presence"
+
+// PresenceStore sprema vrijeme zadnje aktivnosti korisnika (implementira ga user.Service).
+type PresenceStore interface {
+	UpdateLastSeen(ctx context.Context, userID int64, at time.Time) error
+}
+
+// userPresence je stanje jednog spojenog korisnika.
+type userPresence struct {
+	username    string
+	connections int    // broj otvorenih veza kroz sve sobe
+	status      string // ručno postavljen status (online, away, dnd)
+}
+
+// PresenceData su podaci "presence" poruke.
+type PresenceData struct {
+	UserID     string     `json:"userId"`
+	Status     string     `json:"status"` // online, away, dnd ili offline
+	LastSeenAt *time.Time `json:"lastSeenAt,omitempty"`
+}
+
+// SetPresenceStore postavlja spremište za vrijeme zadnje aktivnosti.
+// Poziva se pri pokretanju aplikacije, prije hub.Run.
+func (h *Hub) SetPresenceStore(store PresenceStore) {
+	h.presenceStore = store
+}
+
+// Presence vraća trenutnu prisutnost korisnika.
+func (h *Hub) Presence(userID int64) string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	p, ok := h.presence[userID]
+	if !ok {
+		return user.PresenceOffline
+	}
+	return p.status
+}
+
+// SetStatus mijenja ručno postavljen status spojenog korisnika i javlja promjenu.
+func (h *Hub) SetStatus(userID int64, status string) {
+	h.mu.Lock()
+	p, ok := h.presence[userID]
+	if !ok || p.status == status {
+		h.mu.Unlock()
+		return
+	}
+	p.status = status
+	presence := h.publishPresence(userID, p.username, PresenceData{Status: status})
+	h.mu.Unlock()
+
+	deliverAll(presence)
+}
+
+// connected bilježi novu vezu klijenta i vraća presence poruke za slanje nakon otključavanja.
+// Poziva se iz Run dok je h.mu zaključan.
+func (h *Hub) connected(client *Client) []delivery {
+	if client.userID == 0 {
+		return nil
+	}
+
+	p, ok := h.presence[client.userID]
+	if !ok {
+		status := client.status
+		if status == "" {
+			status = user.PresenceOnline
+		}
+		p = &userPresence{username: client.Username, status: status}
+		h.presence[client.userID] = p
+	}
+	p.connections++
+
+	if p.connections != 1 {
+		return nil
+	}
+	return h.publishPresence(client.userID, p.username, PresenceData{Status: p.status})
+}
+
+// disconnected bilježi zatvaranje veze klijenta i vraća presence poruke za slanje nakon otključavanja.
+// Poziva se iz Run dok je h.mu zaključan, prije nego što se klijent ukloni iz sobe.
+func (h *Hub) disconnected(client *Client) []delivery {
+	p, ok := h.presence[client.userID]
+	if client.userID == 0 || !ok {
+		return nil
+	}
+
+	p.connections--
+	if p.connections > 0 {
+		return nil
+	}
+	delete(h.presence, client.userID)
+
+	now := time.Now()
+	presence := h.publishPresence(client.userID, p.username, PresenceData{Status: user.PresenceOffline, LastSeenAt: &now})
+	if h.presenceStore != nil {
+		go func(userID int64) {
+			if err := h.presenceStore.UpdateLastSeen(context.Background(), userID, now); err != nil {
+				log.Println("Greška pri spremanju zadnje aktivnosti:", err)
+			}
+		}(client.userID)
+	}
+	return presence
+}
+
+// publishPresence gradi "presence" poruke za kontakte korisnika i članove soba u kojima je spojen.
+// Poziva se dok je h.mu zaključan; poruke se šalju (deliverAll) tek nakon otključavanja
+// kako spor primatelj ne bi držao lock huba.
+func (h *Hub) publishPresence(userID int64, username string, data PresenceData) []delivery {
+	data.UserID = strconv.FormatInt(userID, 10)
+	bts, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("Greška kod presence poruke (marshal): %v", err)
+		return nil
+	}
+
+	// Članovi soba u kojima je korisnik trenutno spojen
+	sharedRooms := make(map[string]bool)
+	for _, room := range h.Rooms {
+		for _, c := range room.Clients {
+			if c.userID == userID {
+				sharedRooms[room.ID] = true
+				break
+			}
+		}
+	}
+
+	var deliveries []delivery
+	sent := make(map[*Client]bool)
+	for _, room := range h.Rooms {
+		for _, c := range room.Clients {
+			if c.userID == userID || sent[c] {
+				continue
+			}
+			if !sharedRooms[room.ID] && (c.userID == 0 || !h.contacts[blockKey(userID, c.userID)]) {
+				continue
+			}
+			if c.userID != 0 && h.blocks[blockKey(userID, c.userID)] {
+				continue
+			}
+			sent[c] = true
+			deliveries = append(deliveries, delivery{client: c, message: &Message{
+				Type:     presenceType,
+				Data:     bts,
+				RoomID:   c.RoomID,
+				Username: username,
+			}})
+		}
+	}
+	return deliveries
+}
@@ -0,0 +1,82 @@
+// Package websocket - reakcije na poruke.
+// Klijent šalje {"type": "reaction-add", "id": <ID poruke>, "emoji": "👍"} ili "reaction-remove".
+// Svaki korisnik može isti emoji na poruku dodati samo jednom; promjena se šalje svim članovima sobe
+// zajedno s novim zbrojem reakcija poruke i seq promjene, a neuspjeh dobiva samo pošiljatelj.
+// Klijent koji nastavlja sesiju umjesto propuštenih promjena dobiva "reactions" poruku s trenutnim zbrojem
+// (vidi resume.go). Zbrojevi reakcija vraćaju se i uz povijest poruka (GET /rooms/:roomID/messages).
+
+package websocket
+
+import (
+	"context"
+	"log"
+	"strings"
+)
+
+// Vrste poruka za reakcije.
+const (
+	reactionAddType    = "reaction-add"
+	reactionRemoveType = "reaction-remove"
+	reactionsType      = "reactions" // trenutni zbroj reakcija poruke (samo pri nastavku sesije)
+)
+
+// isReactionType vraća true za reaction-add i reaction-remove poruke.
+func isReactionType(messageType string) bool {
+	return messageType == reactionAddType || messageType == reactionRemoveType
+}
+
+// react obrađuje reaction-add ili reaction-remove poruku klijenta.
+// Ako se reakcije nisu promijenile (ponovljeno dodavanje ili uklanjanje), ništa se ne šalje.
+func (client *Client) react(hub *Hub, msg *Message) {
+	if client.rooms == nil {
+		return
+	}
+
+	msg.Emoji = strings.TrimSpace(msg.Emoji)
+
+	err := hub.publishSaved(client.RoomID, func() (*Message, error) {
+		var counts []ReactionCount
+		var seq int64
+		var err error
+		if msg.Type == reactionAddType {
+			counts, seq, err = client.rooms.AddReaction(context.Background(), client.RoomID, client.userID, msg.ID, msg.Emoji)
+		} else {
+			counts, seq, err = client.rooms.RemoveReaction(context.Background(), client.RoomID, client.userID, msg.ID, msg.Emoji)
+		}
+		if err != nil || seq == 0 {
+			return nil, err
+		}
+		return &Message{
+			Type:      msg.Type,
+			ID:        msg.ID,
+			RoomID:    client.RoomID,
+			Username:  client.Username,
+			Emoji:     msg.Emoji,
+			Reactions: counts,
+			Seq:       seq,
+			senderID:  client.userID,
+			sender:    client,
+		}, nil
+	})
+	if err != nil {
+		log.Println("Reakcija nije spremljena:", err)
+		client.deliver(&Message{
+			Type:   msg.Type,
+			ID:     msg.ID,
+			RoomID: client.RoomID,
+			Emoji:  msg.Emoji,
+			Error:  clientError(err, "reakcija nije spremljena"),
+		})
+	}
+}
+
+// reactionsMessage gradi "reactions" poruku s trenutnim zbrojem reakcija spremljene poruke i seq zadnje promjene.
+func reactionsMessage(stored *StoredMessage) *Message {
+	return &Message{
+		ID:        stored.ID,
+		Type:      reactionsType,
+		RoomID:    stored.RoomID,
+		Reactions: stored.Reactions,
+		Seq:       stored.ReactionSeq,
+	}
+}
@@ -0,0 +1,136 @@
+// Package websocket - nastavak sesije nakon prekida veze.
+// Seq nose sve spremljene promjene u sobi; seq raste unutar sobe i poruke se isporučuju redom po seq:
+// - chat poruke dobivaju novi seq pri spremanju,
+// - izmjene i brisanja poruka (message-edit, message-delete) također dobivaju novi seq (update_seq poruke),
+// - promjena reakcija (reaction-add, reaction-remove) dobiva novi seq (reaction_seq poruke),
+// - pomak oznake pročitanosti člana ("read") dobiva novi seq (read_seq člana),
+// - prikvačivanje i otkvačivanje poruke (pin, unpin) dobiva novi seq (pin_seq sobe),
+// - notifikacije i tipkanje su prolazne: nemaju seq i ne šalju se ponovno nakon reconnecta,
+// - poruke poslane izravno jednom klijentu (ack, presence, mention, thread-reply) nisu dio toka sobe;
+//   ack nosi seq potvrđene poruke, a resync seq od kojeg klijent nastavlja.
+//
+// Klijent pamti najveći primljeni seq i pri ponovnom ulasku šalje ga kao JoinRoom?since=<seq>.
+// Server mu tada prije novih poruka pošalje propuštene poruke iz povijesti, trenutni zbroj reakcija
+// poruka čije su se reakcije promijenile ("reactions") i trenutne oznake pročitanosti članova koje su se
+// u međuvremenu pomaknule, a ako je promjena previše, seq nije poznat ili su se u međuvremenu
+// promijenile prikvačene poruke (otkvačivanje se ne može ponoviti iz povijesti), šalje
+// "resync" poruku nakon koje klijent ponovno učitava povijest i prikvačene poruke
+// (GET /rooms/:roomID/messages i /rooms/:roomID/pins).
+
+package websocket
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"strconv"
+)
+
+// resyncType je vrsta poruke kojom server javlja da propuštene poruke neće biti ponovno poslane.
+const resyncType = "resync"
+
+// parseSince čita since parametar JoinRoom zahtjeva; -1 znači da klijent ne nastavlja sesiju.
+func parseSince(value string) (int64, error) {
+	if value == "" {
+		return -1, nil
+	}
+	since, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || since < 0 {
+		return 0, errors.New("neispravan since parametar")
+	}
+	return since, nil
+}
+
+// missedMessages priprema poruke i izmjene sa seq u (since, delivered] koje klijent treba dobiti
+// prije novih poruka u sobi, poredane po seq. Poruka spremljena nakon since šalje se s trenutnim sadržajem,
+// starija poruka izmijenjena ili obrisana nakon since kao message-edit ili message-delete,
+// starija poruka s promijenjenim reakcijama kao "reactions" s trenutnim zbrojem,
+// a pomaknuta oznaka pročitanosti kao "read" s trenutnom oznakom člana.
+// delivered je seq zadnje poruke isporučene sobi pri ulasku klijenta (vidi Hub.join);
+// novije poruke klijent već dobiva kroz Message kanal.
+func (h *Handler) missedMessages(ctx context.Context, client *Client, since, delivered int64) []*Message {
+	if since < 0 {
+		return nil
+	}
+	if since > delivered {
+		return []*Message{resyncMessage(client.RoomID, delivered)}
+	}
+
+	missed, err := h.rooms.GetMissedMessages(ctx, client.RoomID, since)
+	if err != nil {
+		log.Println("Greška pri dohvaćanju propuštenih poruka:", err)
+		return []*Message{resyncMessage(client.RoomID, delivered)}
+	}
+	if missed.Resync {
+		return []*Message{resyncMessage(client.RoomID, delivered)}
+	}
+
+	messages := make([]*Message, 0, len(missed.Messages))
+	for _, stored := range missed.Messages {
+		var updates []*Message
+		switch {
+		case stored.Seq > since && stored.Seq <= delivered:
+			// Nova poruka već nosi trenutni zbroj reakcija
+			updates = append(updates, storedChat(stored))
+		case stored.UpdateSeq > since && stored.UpdateSeq <= delivered:
+			updateType := messageEditType
+			if stored.DeletedAt != nil {
+				updateType = messageDeleteType
+			}
+			updates = append(updates, messageUpdate(updateType, stored))
+			fallthrough
+		default:
+			if stored.ReactionSeq > since && stored.ReactionSeq <= delivered && stored.DeletedAt == nil {
+				updates = append(updates, reactionsMessage(stored))
+			}
+		}
+		for _, message := range updates {
+			if !h.hub.suppressed(message, client) {
+				messages = append(messages, message)
+			}
+		}
+	}
+	for _, marker := range missed.ReadMarkers {
+		if marker.Seq <= since || marker.Seq > delivered {
+			continue
+		}
+		message := readMarker(client.RoomID, marker.Username, marker.UserID, marker.LastReadMessageID, marker.Seq)
+		if h.hub.suppressed(message, client) {
+			continue
+		}
+		messages = append(messages, message)
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].Seq < messages[j].Seq })
+	return messages
+}
+
+// storedChat gradi poruku sobe iz spremljene poruke, s trenutnim sadržajem, reakcijama i privicima.
+func storedChat(stored *StoredMessage) *Message {
+	return &Message{
+		ID:        stored.ID,
+		Type:      stored.Type,
+		Content:   stored.Content,
+		RoomID:    stored.RoomID,
+		Username:  stored.Username,
+		CreatedAt: &stored.CreatedAt,
+		Seq:       stored.Seq,
+		EditedAt:  stored.EditedAt,
+		DeletedAt: stored.DeletedAt,
+		Reactions: stored.Reactions,
+		ParentID:  stored.ParentID,
+		senderID:  stored.UserID,
+
+		Attachments: stored.Attachments,
+	}
+}
+
+// resyncMessage gradi "resync" poruku sa seq od kojeg klijent nastavlja nakon ponovnog učitavanja povijesti.
+func resyncMessage(roomID string, lastSeq int64) *Message {
+	return &Message{
+		Type:     resyncType,
+		RoomID:   roomID,
+		Username: "sustav",
+		Seq:      lastSeq,
+	}
+}
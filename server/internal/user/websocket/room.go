@@ -0,0 +1,355 @@
+// Package websocket definira trajni model soba i poruka te interfejse za rad s njima.
+// Ovaj fajl sadrži:
+// - strukture za spremljene sobe, članove i poruke,
+// - modele zahtjeva/odgovora za direktne poruke (DM),
+// - Repository interface za rad s bazom,
+// - Service interface za aplikacijsku logiku soba.
+//
+// Hub i dalje drži aktivne klijente u memoriji; ovdje je ono što mora preživjeti restart.
+
+package websocket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"server/internal/user"
+	"time"
+)
+
+// Vrste soba.
+const (
+	RoomKindGroup  = "group"  // imenovana soba kreirana kroz CreateRoom
+	RoomKindDirect = "direct" // privatna soba za razgovor dvaju korisnika
+)
+
+// Uloge članova sobe.
+const (
+	RoleMember    = "member"
+	RoleModerator = "moderator" // smije uređivati i brisati tuđe poruke (autor grupne sobe)
+)
+
+// StoredRoom predstavlja sobu spremljenu u bazi.
+type StoredRoom struct {
+	ID        string    `json:"id" db:"id"`
+	Name      string    `json:"name" db:"name"`
+	Kind      string    `json:"kind" db:"kind"`
+	LastSeq   int64     `json:"lastSeq" db:"last_seq"` // seq zadnje spremljene promjene u sobi (vidi resume.go)
+	PinSeq    int64     `json:"-" db:"pin_seq"`        // seq zadnjeg prikvačivanja ili otkvačivanja poruke
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+}
+
+// StoredMessage predstavlja poruku spremljenu u bazi.
+type StoredMessage struct {
+	ID          int64     `json:"id" db:"id"`
+	RoomID      string    `json:"roomId" db:"room_id"`
+	UserID      int64     `json:"userId,omitempty" db:"user_id"` // 0 ako je autor obrisan
+	Username    string    `json:"username" db:"username"`
+	Type        string    `json:"type" db:"type"`
+	Content     string    `json:"content" db:"content"`
+	ParentID    int64     `json:"parentId,omitempty" db:"parent_id"`        // početna poruka niti (0 ako nije odgovor)
+	ClientMsgID string    `json:"clientMsgId,omitempty" db:"client_msg_id"` // ID koji je poruci dodijelio klijent
+	Seq         int64     `json:"seq" db:"seq"`                             // redni broj poruke unutar sobe
+	CreatedAt   time.Time `json:"createdAt" db:"created_at"`
+
+	EditedAt  *time.Time `json:"editedAt,omitempty" db:"edited_at"`   // vrijeme zadnje izmjene
+	DeletedAt *time.Time `json:"deletedAt,omitempty" db:"deleted_at"` // obrisana poruka ostaje bez sadržaja
+	UpdateSeq int64      `json:"updateSeq,omitempty" db:"update_seq"` // seq zadnje izmjene ili brisanja (vidi resume.go)
+
+	Reactions   []ReactionCount `json:"reactions,omitempty" db:"-"` // zbroj reakcija po emojiju
+	ReactionSeq int64           `json:"-" db:"reaction_seq"`        // seq zadnje promjene reakcija (vidi resume.go)
+
+	// Sažetak niti (samo za početne poruke niti)
+	ReplyCount  int        `json:"replyCount,omitempty" db:"-"`
+	LastReplyAt *time.Time `json:"lastReplyAt,omitempty" db:"-"`
+
+	Attachments []*Attachment `json:"attachments,omitempty" db:"-"`
+}
+
+// Attachment je datoteka priložena chat poruci.
+// URL-ovi su potpisani za korisnika kojem se privitak vraća i vrijede ograničeno vrijeme.
+type Attachment struct {
+	ID           int64     `json:"id" db:"id"`
+	RoomID       string    `json:"roomId" db:"room_id"`
+	UserID       int64     `json:"userId,omitempty" db:"user_id"`       // 0 ako je autor obrisan
+	MessageID    int64     `json:"messageId,omitempty" db:"message_id"` // 0 dok privitak nije poslan u poruci
+	Filename     string    `json:"filename" db:"filename"`
+	ContentType  string    `json:"contentType" db:"content_type"` // prepoznat iz sadržaja datoteke
+	Size         int64     `json:"size" db:"size"`
+	Width        int       `json:"width,omitempty" db:"width"` // dimenzije (samo slike)
+	Height       int       `json:"height,omitempty" db:"height"`
+	CreatedAt    time.Time `json:"createdAt" db:"created_at"`
+	StorageKey   string    `json:"-" db:"storage_key"`
+	ThumbnailKey string    `json:"-" db:"thumbnail_key"` // prazno ako privitak nije slika
+
+	URL          string `json:"url,omitempty" db:"-"`
+	ThumbnailURL string `json:"thumbnailUrl,omitempty" db:"-"`
+}
+
+// ThreadSummary je broj odgovora i vrijeme zadnjeg odgovora u niti.
+type ThreadSummary struct {
+	ReplyCount  int
+	LastReplyAt time.Time
+}
+
+// ThreadRes je nit poruke (GET /messages/:messageID/thread).
+type ThreadRes struct {
+	Parent  *StoredMessage   `json:"parent"`
+	Replies []*StoredMessage `json:"replies"` // poredani po seq
+}
+
+// ReactionCount je zbroj jedne vrste reakcije na poruci.
+type ReactionCount struct {
+	Emoji   string `json:"emoji"`
+	Count   int    `json:"count"`
+	Reacted bool   `json:"reacted,omitempty"` // je li reakciju dodao korisnik koji dohvaća poruke
+}
+
+// MessagesRes je stranica povijesti poruka sobe (GET /rooms/:roomID/messages).
+type MessagesRes struct {
+	Messages   []*StoredMessage `json:"messages"`             // poredane po seq
+	NextBefore *int64           `json:"nextBefore,omitempty"` // before za stariju stranicu; nil ako nema više poruka
+}
+
+// Mention je spominjanje korisnika u poruci.
+type Mention struct {
+	Message     *StoredMessage `json:"message"`
+	MentionedAt time.Time      `json:"mentionedAt"`
+}
+
+// MentionsRes je stranica spominjanja korisnika, od najnovijeg (GET /me/mentions).
+type MentionsRes struct {
+	Results    []*Mention `json:"results"`
+	NextOffset *int       `json:"nextOffset,omitempty"` // nil ako nema više rezultata
+}
+
+// Pin je prikvačena poruka sobe (GET /rooms/:roomID/pins).
+type Pin struct {
+	Message  *StoredMessage `json:"message"`
+	PinnedBy int64          `json:"pinnedBy,omitempty"` // moderator koji je prikvačio poruku (0 ako je obrisan)
+	PinnedAt time.Time      `json:"pinnedAt"`
+	Seq      int64          `json:"-"` // seq prikvačivanja (vidi resume.go)
+}
+
+// CallRecord je jedan poziv iz povijesti poziva korisnika (za izvoz podataka).
+type CallRecord struct {
+	RoomID    string    `json:"roomId"`
+	RoomName  string    `json:"roomName,omitempty"`
+	CallerID  int64     `json:"callerId,omitempty"` // 0 za neprijavljene i obrisane korisnike
+	Direction string    `json:"direction"`          // "outgoing" ili "incoming"
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// RoomMembership je članstvo korisnika u sobi (za izvoz podataka).
+type RoomMembership struct {
+	RoomID            string    `json:"roomId"`
+	RoomName          string    `json:"roomName,omitempty"`
+	Kind              string    `json:"kind"` // RoomKindGroup ili RoomKindDirect
+	Role              string    `json:"role"` // RoleMember ili RoleModerator
+	JoinedAt          time.Time `json:"joinedAt"`
+	LastReadMessageID int64     `json:"lastReadMessageId"`
+}
+
+// MessageSearchReq su parametri pretrage poruka (GET /search/messages).
+type MessageSearchReq struct {
+	Query  string // ?q= — riječi, "fraza", -isključena riječ, or
+	RoomID string // ?room= — samo poruke iz te sobe
+	From   string // ?from= — samo poruke korisnika s tim korisničkim imenom
+	Before int64  // ?before= — samo poruke s manjim ID-em (0 = od najnovije)
+	Limit  int    // ?limit=
+}
+
+// MessageSearchResult je poruka pronađena pretragom.
+type MessageSearchResult struct {
+	Message *StoredMessage `json:"message"`
+	Snippet string         `json:"snippet"` // HTML-escapiran isječak sadržaja; pogoci su omotani u <mark></mark>
+}
+
+// MessageSearchRes je stranica rezultata pretrage poruka, od najnovije poruke.
+type MessageSearchRes struct {
+	Results    []*MessageSearchResult `json:"results"`
+	NextBefore *int64                 `json:"nextBefore,omitempty"` // before za sljedeću stranicu; nil ako nema više rezultata
+}
+
+// DirectConversation je DM razgovor iz perspektive jednog člana.
+type DirectConversation struct {
+	RoomID      string
+	PeerID      int64
+	CreatedAt   time.Time
+	LastMessage *StoredMessage // nil ako u razgovoru još nema poruka
+	UnreadCount int
+}
+
+// DirectRoomRes vraća se nakon POST /dm/:userID.
+type DirectRoomRes struct {
+	RoomID string                 `json:"roomId"`
+	Peer   *user.PublicProfileRes `json:"peer"`
+}
+
+// DirectConversationRes je jedan DM razgovor u listi (GET /dm).
+type DirectConversationRes struct {
+	RoomID      string                 `json:"roomId"`
+	Peer        *user.PublicProfileRes `json:"peer"`
+	LastMessage *StoredMessage         `json:"lastMessage,omitempty"`
+	UnreadCount int                    `json:"unreadCount"`
+}
+
+// EditMessageReq koristi se za PATCH /rooms/:roomID/messages/:messageID.
+type EditMessageReq struct {
+	Content string `json:"content"`
+}
+
+// MarkReadReq koristi se za POST /rooms/:roomID/read.
+type MarkReadReq struct {
+	MessageID int64 `json:"messageId"` // zadnja pročitana poruka (0 = sve poruke u sobi)
+}
+
+// MarkReadRes vraća novu oznaku zadnje pročitane poruke.
+type MarkReadRes struct {
+	RoomID            string `json:"roomId"`
+	LastReadMessageID int64  `json:"lastReadMessageId"`
+}
+
+// ReadMarker je oznaka pročitanosti člana sobe sa seq zadnjeg pomaka (vidi resume.go).
+type ReadMarker struct {
+	UserID            int64
+	Username          string
+	LastReadMessageID int64
+	Seq               int64
+}
+
+// MissedMessages su poruke koje je klijent propustio dok nije bio spojen (JoinRoom sa since=).
+type MissedMessages struct {
+	Messages    []*StoredMessage
+	ReadMarkers []*ReadMarker // oznake pročitanosti pomaknute nakon since
+	LastSeq     int64         // seq zadnje spremljene promjene u sobi (vidi resume.go)
+	Resync      bool          // razmak je prevelik (ili seq nepoznat) — klijent mora ponovno učitati sobu
+}
+
+// ErrRoomNotFound vraća se kad soba ne postoji.
+var ErrRoomNotFound = errors.New("soba ne postoji")
+
+// ErrMessageNotFound vraća se kad poruka ne postoji (ili je obrisana).
+var ErrMessageNotFound = errors.New("poruka ne postoji")
+
+// ErrAttachmentNotFound vraća se kad privitak ne postoji.
+var ErrAttachmentNotFound = errors.New("privitak ne postoji")
+
+// ErrAttachmentLink vraća se kad link za preuzimanje privitka nije ispravno potpisan ili je istekao.
+var ErrAttachmentLink = errors.New("link za preuzimanje privitka je neispravan ili je istekao")
+
+// ErrRoomExists vraća se kad soba s traženim ID-em već postoji.
+var ErrRoomExists = &user.ConflictError{FieldError: user.FieldError{Field: "id", Code: "taken", Message: "soba s tim ID-em već postoji"}}
+
+// ErrForbidden vraća se kad korisnik nema pravo na radnju u sobi.
+var ErrForbidden = errors.New("nemate pristup ovoj sobi")
+
+// directRoomID vraća deterministički ID DM sobe za par korisnika (neovisno o redoslijedu).
+func directRoomID(a, b int64) string {
+	if a > b {
+		a, b = b, a
+	}
+	return fmt.Sprintf("dm-%d-%d", a, b)
+}
+
+// directRoomPeer vraća ID sugovornika u DM sobi; ok je false ako soba nije DM soba korisnika.
+func directRoomPeer(roomID string, userID int64) (peerID int64, ok bool) {
+	var a, b int64
+	if _, err := fmt.Sscanf(roomID, "dm-%d-%d", &a, &b); err != nil {
+		return 0, false
+	}
+	switch userID {
+	case a:
+		return b, true
+	case b:
+		return a, true
+	}
+	return 0, false
+}
+
+// Repository predstavlja apstrakciju nad bazom za sobe i poruke.
+type Repository interface {
+	CreateRoom(ctx context.Context, room *StoredRoom, creatorID int64) error
+	GetRoom(ctx context.Context, id string) (*StoredRoom, error)
+	GetRoomsByKind(ctx context.Context, kind string) ([]*StoredRoom, error)
+	CreateDirectRoom(ctx context.Context, roomID string, userA, userB int64) error
+	IsMember(ctx context.Context, roomID string, userID int64) (bool, error)
+	SaveMessage(ctx context.Context, message *StoredMessage) (*StoredMessage, error)
+	GetMessageByClientID(ctx context.Context, roomID string, userID int64, clientMsgID string) (*StoredMessage, error)
+	GetMessagesSince(ctx context.Context, roomID string, since int64, limit int) ([]*StoredMessage, error)
+	GetReadMarkersSince(ctx context.Context, roomID string, since int64) ([]*ReadMarker, error)
+	GetMessagesBefore(ctx context.Context, roomID string, before int64, limit int) ([]*StoredMessage, error)
+	GetMessage(ctx context.Context, id int64) (*StoredMessage, error)
+	GetThreadReplies(ctx context.Context, parentID int64, limit int) ([]*StoredMessage, error)
+	GetThreadSummaries(ctx context.Context, parentIDs []int64) (map[int64]ThreadSummary, error)
+	GetThreadParticipants(ctx context.Context, parentID int64) ([]int64, error)
+	EditMessage(ctx context.Context, id, editorID int64, content string) (*time.Time, int64, error)
+	DeleteMessage(ctx context.Context, id int64) (*time.Time, int64, error)
+	AddReaction(ctx context.Context, roomID string, messageID, userID int64, emoji string) (int64, error)
+	RemoveReaction(ctx context.Context, roomID string, messageID, userID int64, emoji string) (int64, error)
+	GetReactionCounts(ctx context.Context, messageIDs []int64, userID int64) (map[int64][]ReactionCount, error)
+	AddMember(ctx context.Context, roomID string, userID int64) error
+	GetMemberRole(ctx context.Context, roomID string, userID int64) (string, error)
+	GetMemberIDs(ctx context.Context, roomID string) ([]int64, error)
+	GetMemberIDsByUsername(ctx context.Context, roomID string, usernames []string) ([]int64, error)
+	SaveMentions(ctx context.Context, messageID int64, userIDs []int64) error
+	GetMentions(ctx context.Context, userID int64, limit, offset int) ([]*Mention, error)
+	PinMessage(ctx context.Context, roomID string, messageID, userID int64, limit int) (*Pin, error)
+	UnpinMessage(ctx context.Context, roomID string, messageID int64) (int64, error)
+	GetPins(ctx context.Context, roomID string) ([]*Pin, error)
+	SearchMessages(ctx context.Context, userID int64, req *MessageSearchReq, limit int) ([]*MessageSearchResult, error)
+	CreateAttachment(ctx context.Context, attachment *Attachment) (*Attachment, error)
+	GetAttachment(ctx context.Context, id int64) (*Attachment, error)
+	GetAttachments(ctx context.Context, ids []int64) ([]*Attachment, error)
+	GetMessageAttachments(ctx context.Context, messageIDs []int64) (map[int64][]*Attachment, error)
+	AttachToMessage(ctx context.Context, messageID int64, ids []int64) error
+	DeleteMessageAttachments(ctx context.Context, messageID int64) ([]*Attachment, error)
+	DeleteAttachmentsByUser(ctx context.Context, userID int64) ([]*Attachment, error)
+	DeleteUnattachedAttachments(ctx context.Context, before time.Time) ([]*Attachment, error)
+	MarkRoomRead(ctx context.Context, roomID string, userID, messageID int64) (int64, int64, bool, error)
+	GetUnreadCounts(ctx context.Context, userID int64) (map[string]int, error)
+	GetDirectConversations(ctx context.Context, userID int64) ([]DirectConversation, error)
+	GetMessagesByUser(ctx context.Context, userID int64) ([]*StoredMessage, error)
+	AnonymizeMessagesByUser(ctx context.Context, userID int64) error
+	RecordCall(ctx context.Context, roomID string, callerID int64) error
+	GetCallsByUser(ctx context.Context, userID int64) ([]*CallRecord, error)
+	GetMembershipsByUser(ctx context.Context, userID int64) ([]*RoomMembership, error)
+}
+
+// Service predstavlja aplikacijsku logiku soba i poruka.
+type Service interface {
+	CreateRoom(ctx context.Context, userID int64, req *CreateRoomReq) (*StoredRoom, error)
+	GetRoom(ctx context.Context, id string) (*StoredRoom, error)
+	GetGroupRooms(ctx context.Context) ([]*StoredRoom, error)
+	CanJoin(ctx context.Context, room *StoredRoom, userID int64) (bool, error)
+	SaveMessage(ctx context.Context, userID int64, message *Message) (bool, error)
+	GetMissedMessages(ctx context.Context, roomID string, since int64) (*MissedMessages, error)
+	GetMessages(ctx context.Context, roomID string, userID, before int64, limit int) (*MessagesRes, error)
+	GetThread(ctx context.Context, userID, messageID int64) (*ThreadRes, error)
+	GetThreadParticipants(ctx context.Context, parentID int64) ([]int64, error)
+	SaveMentions(ctx context.Context, message *Message, hereIDs []int64) ([]int64, error)
+	GetMentions(ctx context.Context, userID int64, limit, offset int) (*MentionsRes, error)
+	PinMessage(ctx context.Context, roomID string, userID, messageID int64) (*Pin, int64, error)
+	UnpinMessage(ctx context.Context, roomID string, userID, messageID int64) (int64, error)
+	GetPins(ctx context.Context, roomID string, userID int64) ([]*Pin, error)
+	SearchMessages(ctx context.Context, userID int64, req *MessageSearchReq) (*MessageSearchRes, error)
+	UploadAttachment(ctx context.Context, roomID string, userID int64, filename string, data []byte) (*Attachment, error)
+	OpenAttachment(ctx context.Context, id int64, query url.Values) (*Attachment, io.ReadCloser, error)
+	SignAttachments(attachments []*Attachment, userID int64) []*Attachment
+	PurgeUnattachedAttachments(ctx context.Context) (int, error)
+	RunAttachmentPurge(interval time.Duration)
+	EditMessage(ctx context.Context, roomID string, userID, messageID int64, content string) (*StoredMessage, error)
+	DeleteMessage(ctx context.Context, roomID string, userID, messageID int64) (*StoredMessage, error)
+	AddReaction(ctx context.Context, roomID string, userID, messageID int64, emoji string) ([]ReactionCount, int64, error)
+	RemoveReaction(ctx context.Context, roomID string, userID, messageID int64, emoji string) ([]ReactionCount, int64, error)
+	AddMember(ctx context.Context, roomID string, userID int64) error
+	MarkRoomRead(ctx context.Context, roomID string, userID, messageID int64) (int64, int64, error)
+	GetUnreadCounts(ctx context.Context, userID int64) (map[string]int, error)
+	OpenDirectRoom(ctx context.Context, userID, peerID int64) (*DirectRoomRes, error)
+	GetDirectConversations(ctx context.Context, userID int64) ([]DirectConversationRes, error)
+	ExportUserData(ctx context.Context, userID int64) (map[string]interface{}, error)
+	DeleteUserData(ctx context.Context, userID int64) error
+	RecordCall(ctx context.Context, roomID string, callerID int64) error
+}
@@ -0,0 +1,955 @@
+// Package websocket sadrži implementaciju Repository sloja za sobe i poruke koji:
+// - sprema i dohvaća sobe (grupne i DM),
+// - vodi članstvo, uloge članova i zadnju pročitanu poruku po članu,
+// - sprema poruke s rednim brojem unutar sobe (seq) i dohvaća propuštene poruke,
+// - uređuje poruke (uz povijest izmjena) i briše ih ostavljajući zapis bez sadržaja,
+// - sprema reakcije na poruke i vraća njihove zbrojeve,
+// - dohvaća niti (odgovore, sažetke i sudionike),
+// - sprema i dohvaća spominjanja korisnika (@mentions) i prikvačene poruke,
+// - pretražuje poruke (full-text) i sprema metapodatke privitaka,
+// - dohvaća DM razgovore sa zadnjom porukom i brojem nepročitanih.
+//
+// Koristi isti DBTX interface kao i user repository.
+
+package websocket
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"server/internal/user"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// repository je konkretna implementacija Repository sučelja.
+type repository struct {
+	db user.DBTX
+}
+
+// NewRepository vraća novi repository instancu.
+func NewRepository(db user.DBTX) Repository {
+	return &repository{db: db}
+}
+
+// CreateRoom sprema novu sobu i u istom upitu dodaje autora (creatorID) kao moderatora sobe;
+// vraća ErrRoomExists ako soba s istim ID-em već postoji.
+func (r *repository) CreateRoom(ctx context.Context, room *StoredRoom, creatorID int64) error {
+	query := `WITH created AS (
+			INSERT INTO rooms(id, name, kind) VALUES ($1, $2, $3) RETURNING id, created_at
+		), creator AS (
+			INSERT INTO room_members(room_id, user_id, role) SELECT id, $4, $5 FROM created
+		)
+		SELECT created_at FROM created`
+	err := r.db.QueryRowContext(ctx, query, room.ID, room.Name, room.Kind, creatorID, RoleModerator).Scan(&room.CreatedAt)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return ErrRoomExists
+	}
+	return err
+}
+
+// GetRoom dohvaća sobu po ID-u.
+// Ako soba ne postoji, vraća (nil, nil).
+func (r *repository) GetRoom(ctx context.Context, id string) (*StoredRoom, error) {
+	room := StoredRoom{}
+	query := "SELECT id, name, kind, last_seq, pin_seq, created_at FROM rooms WHERE id = $1"
+	err := r.db.QueryRowContext(ctx, query, id).Scan(&room.ID, &room.Name, &room.Kind, &room.LastSeq, &room.PinSeq, &room.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &room, nil
+}
+
+// GetRoomsByKind vraća sve sobe zadane vrste.
+func (r *repository) GetRoomsByKind(ctx context.Context, kind string) ([]*StoredRoom, error) {
+	query := "SELECT id, name, kind, last_seq, pin_seq, created_at FROM rooms WHERE kind = $1 ORDER BY created_at"
+	rows, err := r.db.QueryContext(ctx, query, kind)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rooms []*StoredRoom
+	for rows.Next() {
+		room := &StoredRoom{}
+		if err := rows.Scan(&room.ID, &room.Name, &room.Kind, &room.LastSeq, &room.PinSeq, &room.CreatedAt); err != nil {
+			return nil, err
+		}
+		rooms = append(rooms, room)
+	}
+	return rooms, rows.Err()
+}
+
+// CreateDirectRoom idempotentno kreira DM sobu i oba članstva u jednom upitu.
+func (r *repository) CreateDirectRoom(ctx context.Context, roomID string, userA, userB int64) error {
+	query := `WITH room AS (
+		INSERT INTO rooms(id, name, kind) VALUES ($1, '', 'direct') ON CONFLICT (id) DO NOTHING
+	)
+	INSERT INTO room_members(room_id, user_id) VALUES ($1, $2), ($1, $3)
+	ON CONFLICT (room_id, user_id) DO NOTHING`
+	_, err := r.db.ExecContext(ctx, query, roomID, userA, userB)
+	return err
+}
+
+// IsMember provjerava je li korisnik član sobe.
+func (r *repository) IsMember(ctx context.Context, roomID string, userID int64) (bool, error) {
+	var exists bool
+	query := "SELECT EXISTS (SELECT 1 FROM room_members WHERE room_id = $1 AND user_id = $2)"
+	err := r.db.QueryRowContext(ctx, query, roomID, userID).Scan(&exists)
+	return exists, err
+}
+
+// SaveMessage sprema poruku sa sljedećim seq sobe i popunjava njen ID, seq i vrijeme nastanka.
+// Ako je autor već spremio poruku s istim ClientMsgID u istoj sobi, ne sprema ništa (ni ne troši seq) i vraća (nil, nil).
+// Neprijavljeni autori dijele ključ korisnika 0.
+func (r *repository) SaveMessage(ctx context.Context, message *StoredMessage) (*StoredMessage, error) {
+	query := `WITH room AS (
+		UPDATE rooms SET last_seq = last_seq + 1
+		WHERE id = $1 AND NOT EXISTS (
+			SELECT 1 FROM messages
+			WHERE room_id = $1 AND coalesce(user_id, 0) = coalesce($2::bigint, 0) AND client_msg_id = $6
+		)
+		RETURNING last_seq
+	)
+	INSERT INTO messages(room_id, user_id, username, type, content, client_msg_id, parent_id, seq)
+	SELECT $1, $2, $3, $4, $5, $6, $7, last_seq FROM room
+	ON CONFLICT (room_id, (coalesce(user_id, 0)), client_msg_id) WHERE client_msg_id IS NOT NULL DO NOTHING
+	RETURNING id, seq, created_at`
+	err := r.db.QueryRowContext(ctx, query,
+		message.RoomID, nullableUserID(message.UserID), message.Username, message.Type, message.Content,
+		sql.NullString{String: message.ClientMsgID, Valid: message.ClientMsgID != ""},
+		sql.NullInt64{Int64: message.ParentID, Valid: message.ParentID != 0},
+	).Scan(&message.ID, &message.Seq, &message.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// GetMessageByClientID dohvaća poruku autora u sobi po ID-u koji joj je dodijelio klijent (userID 0 = neprijavljeni autor).
+// Ako poruka ne postoji, vraća (nil, nil).
+func (r *repository) GetMessageByClientID(ctx context.Context, roomID string, userID int64, clientMsgID string) (*StoredMessage, error) {
+	message := StoredMessage{}
+	query := `SELECT id, room_id, coalesce(user_id, 0), username, type, content, client_msg_id, seq, created_at
+		FROM messages WHERE room_id = $1 AND coalesce(user_id, 0) = $2 AND client_msg_id = $3`
+	err := r.db.QueryRowContext(ctx, query, roomID, userID, clientMsgID).Scan(&message.ID, &message.RoomID, &message.UserID,
+		&message.Username, &message.Type, &message.Content, &message.ClientMsgID, &message.Seq, &message.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// messageColumns su stupci koje čitaju upiti koji vraćaju cijelu poruku (vidi scanMessage).
+const messageColumns = "id, room_id, coalesce(user_id, 0), username, type, content, coalesce(parent_id, 0), seq, created_at, edited_at, deleted_at, coalesce(update_seq, 0), coalesce(reaction_seq, 0)"
+
+// rowScanner je zajedničko sučelje za *sql.Row i *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanMessage čita jedan redak sa stupcima messageColumns; extra su odredišta stupaca iza njih.
+func scanMessage(row rowScanner, extra ...interface{}) (*StoredMessage, error) {
+	message := StoredMessage{}
+	var editedAt, deletedAt sql.NullTime
+	dest := []interface{}{&message.ID, &message.RoomID, &message.UserID, &message.Username,
+		&message.Type, &message.Content, &message.ParentID, &message.Seq, &message.CreatedAt, &editedAt, &deletedAt, &message.UpdateSeq, &message.ReactionSeq}
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return nil, err
+	}
+	if editedAt.Valid {
+		message.EditedAt = &editedAt.Time
+	}
+	if deletedAt.Valid {
+		message.DeletedAt = &deletedAt.Time
+	}
+	return &message, nil
+}
+
+// queryMessages izvršava upit koji vraća stupce messageColumns.
+func (r *repository) queryMessages(ctx context.Context, query string, args ...interface{}) ([]*StoredMessage, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := make([]*StoredMessage, 0)
+	for rows.Next() {
+		message, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+	return messages, rows.Err()
+}
+
+// GetMessagesSince vraća najviše limit poruka sobe spremljenih, izmijenjenih ili obrisanih nakon seq since,
+// poredane po seq zadnje promjene.
+func (r *repository) GetMessagesSince(ctx context.Context, roomID string, since int64, limit int) ([]*StoredMessage, error) {
+	query := "SELECT " + messageColumns + ` FROM messages
+		WHERE room_id = $1 AND (seq > $2 OR update_seq > $2 OR reaction_seq > $2)
+		ORDER BY greatest(seq, coalesce(update_seq, 0), coalesce(reaction_seq, 0)) LIMIT $3`
+	return r.queryMessages(ctx, query, roomID, since, limit)
+}
+
+// GetMessagesBefore vraća najviše limit zadnjih poruka sobe sa seq manjim od before (0 = od zadnje poruke),
+// poredane po seq.
+func (r *repository) GetMessagesBefore(ctx context.Context, roomID string, before int64, limit int) ([]*StoredMessage, error) {
+	query := "SELECT " + messageColumns + ` FROM (
+		SELECT * FROM messages WHERE room_id = $1 AND ($2 = 0 OR seq < $2) ORDER BY seq DESC LIMIT $3
+	) page ORDER BY seq`
+	return r.queryMessages(ctx, query, roomID, before, limit)
+}
+
+// GetMessage dohvaća poruku po ID-u.
+// Ako poruka ne postoji, vraća (nil, nil).
+func (r *repository) GetMessage(ctx context.Context, id int64) (*StoredMessage, error) {
+	query := "SELECT " + messageColumns + " FROM messages WHERE id = $1"
+	message, err := scanMessage(r.db.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// GetThreadReplies vraća najviše limit odgovora u niti, poredanih po seq.
+func (r *repository) GetThreadReplies(ctx context.Context, parentID int64, limit int) ([]*StoredMessage, error) {
+	query := "SELECT " + messageColumns + " FROM messages WHERE parent_id = $1 ORDER BY seq LIMIT $2"
+	return r.queryMessages(ctx, query, parentID, limit)
+}
+
+// GetThreadSummaries vraća broj odgovora i vrijeme zadnjeg odgovora za niti zadanih poruka
+// (parentID → sažetak); obrisani odgovori se ne broje, a poruke bez odgovora nisu u mapi.
+func (r *repository) GetThreadSummaries(ctx context.Context, parentIDs []int64) (map[int64]ThreadSummary, error) {
+	query := `SELECT parent_id, count(*), max(created_at)
+		FROM messages WHERE parent_id = ANY($1) AND deleted_at IS NULL
+		GROUP BY parent_id`
+	rows, err := r.db.QueryContext(ctx, query, pq.Array(parentIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summaries := make(map[int64]ThreadSummary)
+	for rows.Next() {
+		var parentID int64
+		var summary ThreadSummary
+		if err := rows.Scan(&parentID, &summary.ReplyCount, &summary.LastReplyAt); err != nil {
+			return nil, err
+		}
+		summaries[parentID] = summary
+	}
+	return summaries, rows.Err()
+}
+
+// GetThreadParticipants vraća ID-eve autora početne poruke i svih odgovora u niti.
+func (r *repository) GetThreadParticipants(ctx context.Context, parentID int64) ([]int64, error) {
+	query := `SELECT user_id FROM messages WHERE id = $1 AND user_id IS NOT NULL
+		UNION
+		SELECT user_id FROM messages WHERE parent_id = $1 AND user_id IS NOT NULL`
+	return r.queryIDs(ctx, query, parentID)
+}
+
+// EditMessage sprema prethodni sadržaj poruke u povijest izmjena i postavlja novi sadržaj.
+// Izmjena dobiva novi seq sobe (update_seq) kako bi se ponovno poslala klijentu koji nastavlja sesiju.
+// Vraća vrijeme i seq izmjene ili nil ako poruka ne postoji ili je obrisana.
+func (r *repository) EditMessage(ctx context.Context, id, editorID int64, content string) (*time.Time, int64, error) {
+	var editedAt time.Time
+	var updateSeq int64
+	query := `WITH old AS (
+		SELECT id, room_id, content FROM messages WHERE id = $1 AND deleted_at IS NULL FOR UPDATE
+	), room AS (
+		UPDATE rooms SET last_seq = last_seq + 1 WHERE id = (SELECT room_id FROM old) RETURNING last_seq
+	), history AS (
+		INSERT INTO message_edits(message_id, user_id, content) SELECT id, $2, content FROM old
+	)
+	UPDATE messages m SET content = $3, edited_at = now(), update_seq = room.last_seq
+	FROM old, room WHERE m.id = old.id
+	RETURNING m.edited_at, m.update_seq`
+	err := r.db.QueryRowContext(ctx, query, id, nullableUserID(editorID), content).Scan(&editedAt, &updateSeq)
+	if err == sql.ErrNoRows {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return &editedAt, updateSeq, nil
+}
+
+// DeleteMessage briše sadržaj poruke, njenu povijest izmjena, reakcije i prikvačivanje;
+// zapis ostaje kao tombstone.
+// Vraća vrijeme i seq brisanja ili nil ako poruka ne postoji ili je već obrisana.
+func (r *repository) DeleteMessage(ctx context.Context, id int64) (*time.Time, int64, error) {
+	var deletedAt time.Time
+	var updateSeq int64
+	query := `WITH target AS (
+		SELECT id, room_id FROM messages WHERE id = $1 AND deleted_at IS NULL FOR UPDATE
+	), room AS (
+		UPDATE rooms SET last_seq = last_seq + 1 WHERE id = (SELECT room_id FROM target) RETURNING last_seq
+	), deleted AS (
+		UPDATE messages m SET content = '', deleted_at = now(), update_seq = room.last_seq
+		FROM target, room WHERE m.id = target.id
+		RETURNING m.id, m.deleted_at, m.update_seq
+	), history AS (
+		DELETE FROM message_edits WHERE message_id IN (SELECT id FROM deleted)
+	), reactions AS (
+		DELETE FROM message_reactions WHERE message_id IN (SELECT id FROM deleted)
+	), pins AS (
+		DELETE FROM pinned_messages WHERE message_id IN (SELECT id FROM deleted)
+	)
+	SELECT deleted_at, update_seq FROM deleted`
+	err := r.db.QueryRowContext(ctx, query, id).Scan(&deletedAt, &updateSeq)
+	if err == sql.ErrNoRows {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return &deletedAt, updateSeq, nil
+}
+
+// AddMember dodaje korisnika među članove sobe; novi član počinje bez nepročitanih poruka.
+// Član dobiva zadanu ulogu (member); moderator sobe je samo njen autor (vidi CreateRoom).
+func (r *repository) AddMember(ctx context.Context, roomID string, userID int64) error {
+	query := `INSERT INTO room_members(room_id, user_id, last_read_message_id)
+		VALUES ($1, $2, coalesce((SELECT max(id) FROM messages WHERE room_id = $1), 0))
+		ON CONFLICT (room_id, user_id) DO NOTHING`
+	_, err := r.db.ExecContext(ctx, query, roomID, userID)
+	return err
+}
+
+// AddReaction dodaje reakciju korisnika na poruku sobe roomID i vraća seq promjene (vidi changeReaction);
+// vraća 0 ako je reakcija već postojala.
+func (r *repository) AddReaction(ctx context.Context, roomID string, messageID, userID int64, emoji string) (int64, error) {
+	change := `INSERT INTO message_reactions(message_id, user_id, emoji) VALUES ($2, $3, $4)
+		ON CONFLICT (message_id, user_id, emoji) DO NOTHING
+		RETURNING message_id`
+	return r.changeReaction(ctx, change, roomID, messageID, userID, emoji)
+}
+
+// RemoveReaction uklanja reakciju korisnika s poruke sobe roomID i vraća seq promjene (vidi changeReaction);
+// vraća 0 ako reakcija nije postojala.
+func (r *repository) RemoveReaction(ctx context.Context, roomID string, messageID, userID int64, emoji string) (int64, error) {
+	change := `DELETE FROM message_reactions WHERE message_id = $2 AND user_id = $3 AND emoji = $4
+		RETURNING message_id`
+	return r.changeReaction(ctx, change, roomID, messageID, userID, emoji)
+}
+
+// changeReaction izvršava promjenu reakcije (change, s parametrima $2-$4) i, ako se reakcija promijenila,
+// u istom upitu poruci dodjeljuje novi seq sobe (reaction_seq) koji vraća. Ako se ništa nije promijenilo, vraća 0.
+func (r *repository) changeReaction(ctx context.Context, change, roomID string, messageID, userID int64, emoji string) (int64, error) {
+	var seq int64
+	query := `WITH changed AS (` + change + `), room AS (
+			UPDATE rooms SET last_seq = last_seq + 1
+			WHERE id = $1 AND EXISTS (SELECT 1 FROM changed)
+			RETURNING last_seq
+		), marked AS (
+			UPDATE messages m SET reaction_seq = room.last_seq FROM room WHERE m.id = $2
+		)
+		SELECT last_seq FROM room`
+	err := r.db.QueryRowContext(ctx, query, roomID, messageID, userID, emoji).Scan(&seq)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return seq, err
+}
+
+// GetReactionCounts vraća zbroj reakcija po emojiju za svaku od poruka (messageID → zbrojevi),
+// poredane po prvoj reakciji. Reacted označava reakcije korisnika userID (0 = ne označava se).
+func (r *repository) GetReactionCounts(ctx context.Context, messageIDs []int64, userID int64) (map[int64][]ReactionCount, error) {
+	query := `SELECT message_id, emoji, count(*), bool_or(user_id = $2)
+		FROM message_reactions WHERE message_id = ANY($1)
+		GROUP BY message_id, emoji
+		ORDER BY message_id, min(created_at)`
+	rows, err := r.db.QueryContext(ctx, query, pq.Array(messageIDs), userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[int64][]ReactionCount)
+	for rows.Next() {
+		var messageID int64
+		var count ReactionCount
+		if err := rows.Scan(&messageID, &count.Emoji, &count.Count, &count.Reacted); err != nil {
+			return nil, err
+		}
+		counts[messageID] = append(counts[messageID], count)
+	}
+	return counts, rows.Err()
+}
+
+// GetMemberRole vraća ulogu člana sobe ili "" ako korisnik nije član.
+func (r *repository) GetMemberRole(ctx context.Context, roomID string, userID int64) (string, error) {
+	var role string
+	query := "SELECT role FROM room_members WHERE room_id = $1 AND user_id = $2"
+	err := r.db.QueryRowContext(ctx, query, roomID, userID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return role, err
+}
+
+// GetMemberIDs vraća ID-eve svih članova sobe.
+func (r *repository) GetMemberIDs(ctx context.Context, roomID string) ([]int64, error) {
+	query := "SELECT user_id FROM room_members WHERE room_id = $1"
+	return r.queryIDs(ctx, query, roomID)
+}
+
+// GetMemberIDsByUsername vraća ID-eve članova sobe sa zadanim korisničkim imenima (bez obzira na velika/mala slova).
+func (r *repository) GetMemberIDsByUsername(ctx context.Context, roomID string, usernames []string) ([]int64, error) {
+	query := `SELECT u.id FROM room_members rm
+		JOIN users u ON u.id = rm.user_id
+		WHERE rm.room_id = $1 AND lower(u.username) = ANY($2)`
+	return r.queryIDs(ctx, query, roomID, pq.Array(usernames))
+}
+
+// SaveMentions sprema spominjanja korisnika u poruci (postojeća se preskaču).
+func (r *repository) SaveMentions(ctx context.Context, messageID int64, userIDs []int64) error {
+	query := `INSERT INTO mentions(message_id, user_id) SELECT $1, unnest($2::bigint[])
+		ON CONFLICT (message_id, user_id) DO NOTHING`
+	_, err := r.db.ExecContext(ctx, query, messageID, pq.Array(userIDs))
+	return err
+}
+
+// GetMentions vraća spominjanja korisnika od najnovijeg, bez obrisanih poruka
+// i poruka korisnika s kojima postoji blokada.
+func (r *repository) GetMentions(ctx context.Context, userID int64, limit, offset int) ([]*Mention, error) {
+	query := "SELECT " + messageColumns + `, mentioned_at FROM (
+		SELECT m.*, mn.created_at AS mentioned_at
+		FROM mentions mn
+		JOIN messages m ON m.id = mn.message_id
+		WHERE mn.user_id = $1 AND m.deleted_at IS NULL
+			AND NOT EXISTS (
+				SELECT 1 FROM user_blocks b
+				WHERE (b.blocker_id = $1 AND b.blocked_id = m.user_id) OR (b.blocker_id = m.user_id AND b.blocked_id = $1)
+			)
+	) m
+	ORDER BY mentioned_at DESC, id DESC
+	LIMIT $2 OFFSET $3`
+	rows, err := r.db.QueryContext(ctx, query, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	mentions := make([]*Mention, 0)
+	for rows.Next() {
+		mention := &Mention{}
+		if mention.Message, err = scanMessage(rows, &mention.MentionedAt); err != nil {
+			return nil, err
+		}
+		mentions = append(mentions, mention)
+	}
+	return mentions, rows.Err()
+}
+
+// PinMessage prikvačuje poruku u sobi na prvo slobodno mjesto od 1 do limit i u istom upitu
+// sobi dodjeljuje novi seq (last_seq i pin_seq).
+// Jedinstveno mjesto (room_id, slot) jamči da soba nema više od limit prikvačenih poruka
+// i kad moderatori prikvačuju istovremeno. Ako je poruka već prikvačena, soba nema slobodnog mjesta
+// ili je mjesto upravo zauzeto, ne radi ništa i vraća (nil, nil).
+func (r *repository) PinMessage(ctx context.Context, roomID string, messageID, userID int64, limit int) (*Pin, error) {
+	pin := &Pin{PinnedBy: userID}
+	query := `WITH pinned AS (
+			INSERT INTO pinned_messages(message_id, room_id, pinned_by, slot)
+			SELECT $1, $2, $3, s.slot FROM generate_series(1, $4::integer) AS s(slot)
+			WHERE NOT EXISTS (SELECT 1 FROM pinned_messages p WHERE p.room_id = $2 AND p.slot = s.slot)
+			ORDER BY s.slot LIMIT 1
+			ON CONFLICT DO NOTHING
+			RETURNING pinned_at
+		), room AS (
+			UPDATE rooms SET last_seq = last_seq + 1, pin_seq = last_seq + 1
+			WHERE id = $2 AND EXISTS (SELECT 1 FROM pinned)
+			RETURNING last_seq
+		)
+		SELECT pinned_at, last_seq FROM pinned, room`
+	err := r.db.QueryRowContext(ctx, query, messageID, roomID, nullableUserID(userID), limit).Scan(&pin.PinnedAt, &pin.Seq)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return pin, nil
+}
+
+// UnpinMessage otkvačuje poruku u sobi i u istom upitu sobi dodjeljuje novi seq (last_seq i pin_seq)
+// koji vraća; vraća 0 ako poruka nije bila prikvačena.
+func (r *repository) UnpinMessage(ctx context.Context, roomID string, messageID int64) (int64, error) {
+	var seq int64
+	query := `WITH unpinned AS (
+			DELETE FROM pinned_messages WHERE room_id = $1 AND message_id = $2 RETURNING message_id
+		)
+		UPDATE rooms SET last_seq = last_seq + 1, pin_seq = last_seq + 1
+		WHERE id = $1 AND EXISTS (SELECT 1 FROM unpinned)
+		RETURNING last_seq`
+	err := r.db.QueryRowContext(ctx, query, roomID, messageID).Scan(&seq)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return seq, err
+}
+
+// GetPins vraća prikvačene poruke sobe, od zadnje prikvačene.
+func (r *repository) GetPins(ctx context.Context, roomID string) ([]*Pin, error) {
+	query := "SELECT " + messageColumns + `, pinned_by, pinned_at FROM (
+		SELECT m.*, coalesce(p.pinned_by, 0) AS pinned_by, p.pinned_at
+		FROM pinned_messages p
+		JOIN messages m ON m.id = p.message_id
+		WHERE p.room_id = $1
+	) m
+	ORDER BY pinned_at DESC`
+	rows, err := r.db.QueryContext(ctx, query, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pins := make([]*Pin, 0)
+	for rows.Next() {
+		pin := &Pin{}
+		if pin.Message, err = scanMessage(rows, &pin.PinnedBy, &pin.PinnedAt); err != nil {
+			return nil, err
+		}
+		pins = append(pins, pin)
+	}
+	return pins, rows.Err()
+}
+
+// SearchMessages vraća najviše limit chat poruka iz soba kojih je korisnik član koje odgovaraju upitu,
+// od najnovije. Upit se stema hrvatski i engleski (vidi migraciju add_message_search): poruka odgovara
+// ako odgovara upitu u bilo kojoj konfiguraciji, a isključena riječ (-riječ) isključuje poruku samo ako
+// se u njoj nalaze oba njena stema. Isječak sadržaja ima pogotke omeđene sa snippetStart i snippetStop,
+// označene konfiguracijom u kojoj poruka odgovara upitu; iste znakove iz sadržaja poruke isječak ne sadrži.
+func (r *repository) SearchMessages(ctx context.Context, userID int64, req *MessageSearchReq, limit int) ([]*MessageSearchResult, error) {
+	include, exclude := splitSearchQuery(req.Query)
+	query := `WITH q AS (
+		SELECT websearch_to_tsquery('croatian', $2) AS hr, websearch_to_tsquery('english', $2) AS en
+	), found AS (
+		SELECT m.id
+		FROM messages m
+		JOIN room_members rm ON rm.room_id = m.room_id AND rm.user_id = $1
+		CROSS JOIN q
+		WHERE ($2 = '' OR m.search_vector @@ (q.hr || q.en))
+			AND NOT EXISTS (
+				SELECT 1 FROM unnest($8::text[]) AS x(term)
+				WHERE m.search_vector @@ (websearch_to_tsquery('croatian', x.term) && websearch_to_tsquery('english', x.term))
+			)
+			AND m.type = 'chat' AND m.deleted_at IS NULL
+			AND ($3 = '' OR m.room_id = $3)
+			AND ($4 = '' OR m.user_id = (SELECT id FROM users WHERE lower(username) = lower($4)))
+			AND ($5 = 0 OR m.id < $5)
+			AND NOT EXISTS (
+				SELECT 1 FROM user_blocks b
+				WHERE (b.blocker_id = $1 AND b.blocked_id = m.user_id) OR (b.blocker_id = m.user_id AND b.blocked_id = $1)
+			)
+		ORDER BY m.id DESC
+		LIMIT $6
+	)
+	SELECT ` + messageColumns + `,
+		CASE WHEN to_tsvector('croatian', content) @@ q.hr
+			THEN ts_headline('croatian', translate(content, chr(1) || chr(2), ''), q.hr, $7)
+			ELSE ts_headline('english', translate(content, chr(1) || chr(2), ''), q.en, $7)
+		END
+	FROM messages CROSS JOIN q
+	WHERE id IN (SELECT id FROM found)
+	ORDER BY id DESC`
+	options := "StartSel=" + snippetStart + ", StopSel=" + snippetStop + ", MaxWords=30, MinWords=10, MaxFragments=2"
+	rows, err := r.db.QueryContext(ctx, query, userID, include, req.RoomID, req.From, req.Before, limit, options, pq.Array(exclude))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := make([]*MessageSearchResult, 0)
+	for rows.Next() {
+		result := &MessageSearchResult{}
+		if result.Message, err = scanMessage(rows, &result.Snippet); err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
+
+// queryIDs izvršava upit koji vraća jedan stupac s ID-evima korisnika.
+func (r *repository) queryIDs(ctx context.Context, query string, args ...interface{}) ([]int64, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]int64, 0)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// MarkRoomRead pomiče oznaku zadnje pročitane poruke člana do messageID (najviše do zadnje poruke u sobi).
+// Oznaka se nikad ne pomiče unatrag. Ako se pomaknula, u istom upitu dobiva novi seq sobe (read_seq).
+// Vraća novu oznaku, njen seq (0 ako se oznaka nije pomaknula) i false ako korisnik nije član sobe.
+func (r *repository) MarkRoomRead(ctx context.Context, roomID string, userID, messageID int64) (int64, int64, bool, error) {
+	var lastRead, seq int64
+	query := `WITH member AS (
+			SELECT last_read_message_id AS old, greatest(last_read_message_id,
+				least($3, coalesce((SELECT max(id) FROM messages WHERE room_id = $1), 0))) AS new
+			FROM room_members WHERE room_id = $1 AND user_id = $2
+		), room AS (
+			UPDATE rooms SET last_seq = last_seq + 1
+			WHERE id = $1 AND EXISTS (SELECT 1 FROM member WHERE new > old)
+			RETURNING last_seq
+		), marked AS (
+			UPDATE room_members rm
+			SET last_read_message_id = greatest(rm.last_read_message_id, member.new), read_seq = room.last_seq
+			FROM member, room
+			WHERE rm.room_id = $1 AND rm.user_id = $2
+		)
+		SELECT new, coalesce((SELECT last_seq FROM room), 0) FROM member`
+	err := r.db.QueryRowContext(ctx, query, roomID, userID, messageID).Scan(&lastRead, &seq)
+	if err == sql.ErrNoRows {
+		return 0, 0, false, nil
+	}
+	if err != nil {
+		return 0, 0, false, err
+	}
+	return lastRead, seq, true, nil
+}
+
+// GetReadMarkersSince vraća oznake pročitanosti članova sobe pomaknute nakon seq since, poredane po seq.
+func (r *repository) GetReadMarkersSince(ctx context.Context, roomID string, since int64) ([]*ReadMarker, error) {
+	query := `SELECT rm.user_id, u.username, rm.last_read_message_id, rm.read_seq
+		FROM room_members rm
+		JOIN users u ON u.id = rm.user_id
+		WHERE rm.room_id = $1 AND rm.read_seq > $2
+		ORDER BY rm.read_seq`
+	rows, err := r.db.QueryContext(ctx, query, roomID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	markers := make([]*ReadMarker, 0)
+	for rows.Next() {
+		marker := &ReadMarker{}
+		if err := rows.Scan(&marker.UserID, &marker.Username, &marker.LastReadMessageID, &marker.Seq); err != nil {
+			return nil, err
+		}
+		markers = append(markers, marker)
+	}
+	return markers, rows.Err()
+}
+
+// GetUnreadCounts vraća broj nepročitanih poruka (tuđih poruka nakon oznake) po sobi za sve sobe korisnika.
+func (r *repository) GetUnreadCounts(ctx context.Context, userID int64) (map[string]int, error) {
+	query := `SELECT rm.room_id, count(m.id)
+		FROM room_members rm
+		LEFT JOIN messages m ON m.room_id = rm.room_id
+			AND m.id > rm.last_read_message_id
+			AND m.user_id IS DISTINCT FROM rm.user_id
+		WHERE rm.user_id = $1
+		GROUP BY rm.room_id`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var roomID string
+		var count int
+		if err := rows.Scan(&roomID, &count); err != nil {
+			return nil, err
+		}
+		counts[roomID] = count
+	}
+	return counts, rows.Err()
+}
+
+// GetDirectConversations vraća DM razgovore korisnika sa zadnjom porukom i brojem nepročitanih,
+// sortirane po zadnjoj aktivnosti.
+func (r *repository) GetDirectConversations(ctx context.Context, userID int64) ([]DirectConversation, error) {
+	query := `SELECT r.id, r.created_at, peer.user_id,
+			lm.id, lm.user_id, lm.username, lm.type, lm.content, lm.created_at,
+			(SELECT count(*) FROM messages m
+				WHERE m.room_id = r.id
+					AND m.id > me.last_read_message_id
+					AND m.user_id IS DISTINCT FROM me.user_id) AS unread
+		FROM room_members me
+		JOIN rooms r ON r.id = me.room_id AND r.kind = 'direct'
+		JOIN room_members peer ON peer.room_id = r.id AND peer.user_id <> me.user_id
+		LEFT JOIN LATERAL (
+			SELECT id, user_id, username, type, content, created_at FROM messages
+			WHERE room_id = r.id ORDER BY id DESC LIMIT 1
+		) lm ON true
+		WHERE me.user_id = $1
+		ORDER BY coalesce(lm.created_at, r.created_at) DESC`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	conversations := make([]DirectConversation, 0)
+	for rows.Next() {
+		var conversation DirectConversation
+		var (
+			lastID       sql.NullInt64
+			lastUserID   sql.NullInt64
+			lastUsername sql.NullString
+			lastType     sql.NullString
+			lastContent  sql.NullString
+			lastCreated  sql.NullTime
+		)
+		err := rows.Scan(
+			&conversation.RoomID, &conversation.CreatedAt, &conversation.PeerID,
+			&lastID, &lastUserID, &lastUsername, &lastType, &lastContent, &lastCreated,
+			&conversation.UnreadCount,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if lastID.Valid {
+			conversation.LastMessage = &StoredMessage{
+				ID:        lastID.Int64,
+				RoomID:    conversation.RoomID,
+				UserID:    lastUserID.Int64,
+				Username:  lastUsername.String,
+				Type:      lastType.String,
+				Content:   lastContent.String,
+				CreatedAt: lastCreated.Time,
+			}
+		}
+		conversations = append(conversations, conversation)
+	}
+	return conversations, rows.Err()
+}
+
+// GetMessagesByUser vraća sve poruke koje je korisnik poslao (za izvoz podataka).
+func (r *repository) GetMessagesByUser(ctx context.Context, userID int64) ([]*StoredMessage, error) {
+	query := `SELECT id, room_id, user_id, username, type, content, created_at
+		FROM messages WHERE user_id = $1 ORDER BY id`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := make([]*StoredMessage, 0)
+	for rows.Next() {
+		message := &StoredMessage{}
+		err := rows.Scan(&message.ID, &message.RoomID, &message.UserID, &message.Username,
+			&message.Type, &message.Content, &message.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+	return messages, rows.Err()
+}
+
+// AnonymizeMessagesByUser uklanja autora, sadržaj i povijest izmjena svih poruka korisnika,
+// a zapisi ostaju kako se ne bi narušio tijek razgovora drugih članova.
+func (r *repository) AnonymizeMessagesByUser(ctx context.Context, userID int64) error {
+	query := `WITH history AS (
+		DELETE FROM message_edits WHERE message_id IN (SELECT id FROM messages WHERE user_id = $1)
+	)
+	UPDATE messages SET user_id = NULL, username = 'deleted', content = '', client_msg_id = NULL WHERE user_id = $1`
+	_, err := r.db.ExecContext(ctx, query, userID)
+	return err
+}
+
+// RecordCall bilježi poziv u sobi (callerID 0 = neprijavljeni pozivatelj).
+func (r *repository) RecordCall(ctx context.Context, roomID string, callerID int64) error {
+	query := "INSERT INTO calls (room_id, caller_id) VALUES ($1, NULLIF($2, 0))"
+	_, err := r.db.ExecContext(ctx, query, roomID, callerID)
+	return err
+}
+
+// GetCallsByUser vraća pozive koje je korisnik uputio i pozive u sobama čiji je član (za izvoz podataka).
+func (r *repository) GetCallsByUser(ctx context.Context, userID int64) ([]*CallRecord, error) {
+	query := `SELECT c.room_id, r.name, coalesce(c.caller_id, 0),
+			CASE WHEN c.caller_id = $1 THEN 'outgoing' ELSE 'incoming' END, c.created_at
+		FROM calls c
+		JOIN rooms r ON r.id = c.room_id
+		WHERE c.caller_id = $1
+			OR c.room_id IN (SELECT room_id FROM room_members WHERE user_id = $1)
+		ORDER BY c.created_at, c.id`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	calls := make([]*CallRecord, 0)
+	for rows.Next() {
+		call := &CallRecord{}
+		if err := rows.Scan(&call.RoomID, &call.RoomName, &call.CallerID, &call.Direction, &call.CreatedAt); err != nil {
+			return nil, err
+		}
+		calls = append(calls, call)
+	}
+	return calls, rows.Err()
+}
+
+// GetMembershipsByUser vraća sva članstva korisnika u sobama (za izvoz podataka).
+func (r *repository) GetMembershipsByUser(ctx context.Context, userID int64) ([]*RoomMembership, error) {
+	query := `SELECT rm.room_id, r.name, r.kind, rm.role, rm.joined_at, rm.last_read_message_id
+		FROM room_members rm
+		JOIN rooms r ON r.id = rm.room_id
+		WHERE rm.user_id = $1
+		ORDER BY rm.joined_at, rm.room_id`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	memberships := make([]*RoomMembership, 0)
+	for rows.Next() {
+		m := &RoomMembership{}
+		if err := rows.Scan(&m.RoomID, &m.RoomName, &m.Kind, &m.Role, &m.JoinedAt, &m.LastReadMessageID); err != nil {
+			return nil, err
+		}
+		memberships = append(memberships, m)
+	}
+	return memberships, rows.Err()
+}
+
+// attachmentColumns su stupci koje čitaju upiti koji vraćaju privitak (vidi scanAttachment).
+const attachmentColumns = "id, room_id, coalesce(user_id, 0), coalesce(message_id, 0), filename, content_type, size, width, height, created_at, storage_key, thumbnail_key"
+
+// scanAttachment čita jedan redak sa stupcima attachmentColumns.
+func scanAttachment(row rowScanner) (*Attachment, error) {
+	attachment := &Attachment{}
+	err := row.Scan(&attachment.ID, &attachment.RoomID, &attachment.UserID, &attachment.MessageID,
+		&attachment.Filename, &attachment.ContentType, &attachment.Size, &attachment.Width, &attachment.Height,
+		&attachment.CreatedAt, &attachment.StorageKey, &attachment.ThumbnailKey)
+	if err != nil {
+		return nil, err
+	}
+	return attachment, nil
+}
+
+// queryAttachments izvršava upit koji vraća stupce attachmentColumns.
+func (r *repository) queryAttachments(ctx context.Context, query string, args ...interface{}) ([]*Attachment, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attachments := make([]*Attachment, 0)
+	for rows.Next() {
+		attachment, err := scanAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, attachment)
+	}
+	return attachments, rows.Err()
+}
+
+// CreateAttachment sprema metapodatke uploadanog privitka i popunjava ID i vrijeme uploada.
+func (r *repository) CreateAttachment(ctx context.Context, attachment *Attachment) (*Attachment, error) {
+	query := `INSERT INTO attachments(room_id, user_id, storage_key, thumbnail_key, filename, content_type, size, width, height)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id, created_at`
+	err := r.db.QueryRowContext(ctx, query, attachment.RoomID, nullableUserID(attachment.UserID),
+		attachment.StorageKey, attachment.ThumbnailKey, attachment.Filename, attachment.ContentType,
+		attachment.Size, attachment.Width, attachment.Height).Scan(&attachment.ID, &attachment.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return attachment, nil
+}
+
+// GetAttachment dohvaća privitak po ID-u.
+// Ako privitak ne postoji, vraća (nil, nil).
+func (r *repository) GetAttachment(ctx context.Context, id int64) (*Attachment, error) {
+	query := "SELECT " + attachmentColumns + " FROM attachments WHERE id = $1"
+	attachment, err := scanAttachment(r.db.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return attachment, err
+}
+
+// GetAttachments dohvaća privitke po ID-evima; nepostojeći ID-evi se preskaču.
+func (r *repository) GetAttachments(ctx context.Context, ids []int64) ([]*Attachment, error) {
+	query := "SELECT " + attachmentColumns + " FROM attachments WHERE id = ANY($1) ORDER BY id"
+	return r.queryAttachments(ctx, query, pq.Array(ids))
+}
+
+// GetMessageAttachments vraća privitke poruka (messageID → privici redom uploada).
+func (r *repository) GetMessageAttachments(ctx context.Context, messageIDs []int64) (map[int64][]*Attachment, error) {
+	query := "SELECT " + attachmentColumns + " FROM attachments WHERE message_id = ANY($1) ORDER BY id"
+	attachments, err := r.queryAttachments(ctx, query, pq.Array(messageIDs))
+	if err != nil {
+		return nil, err
+	}
+
+	byMessage := make(map[int64][]*Attachment)
+	for _, attachment := range attachments {
+		byMessage[attachment.MessageID] = append(byMessage[attachment.MessageID], attachment)
+	}
+	return byMessage, nil
+}
+
+// AttachToMessage veže privitke koji još nisu poslani uz poruku.
+func (r *repository) AttachToMessage(ctx context.Context, messageID int64, ids []int64) error {
+	query := "UPDATE attachments SET message_id = $1 WHERE id = ANY($2) AND message_id IS NULL"
+	_, err := r.db.ExecContext(ctx, query, messageID, pq.Array(ids))
+	return err
+}
+
+// DeleteMessageAttachments briše privitke poruke i vraća ih (kako bi se obrisale i datoteke).
+func (r *repository) DeleteMessageAttachments(ctx context.Context, messageID int64) ([]*Attachment, error) {
+	query := "DELETE FROM attachments WHERE message_id = $1 RETURNING " + attachmentColumns
+	return r.queryAttachments(ctx, query, messageID)
+}
+
+// DeleteAttachmentsByUser briše sve privitke korisnika i vraća ih (kako bi se obrisale i datoteke).
+func (r *repository) DeleteAttachmentsByUser(ctx context.Context, userID int64) ([]*Attachment, error) {
+	query := "DELETE FROM attachments WHERE user_id = $1 RETURNING " + attachmentColumns
+	return r.queryAttachments(ctx, query, userID)
+}
+
+// DeleteUnattachedAttachments briše privitke uploadane prije before koji nisu poslani ni u jednoj poruci
+// i vraća ih kako bi se obrisale i njihove datoteke.
+func (r *repository) DeleteUnattachedAttachments(ctx context.Context, before time.Time) ([]*Attachment, error) {
+	query := "DELETE FROM attachments WHERE message_id IS NULL AND created_at < $1 RETURNING " + attachmentColumns
+	return r.queryAttachments(ctx, query, before)
+}
+
+// nullableUserID sprema 0 kao NULL (sistemske poruke nemaju autora).
+func nullableUserID(userID int64) interface{} {
+	if userID == 0 {
+		return nil
+	}
+	return userID
+}
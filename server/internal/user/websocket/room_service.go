@@ -0,0 +1,1399 @@
+// Package websocket implementira poslovnu logiku soba i poruka:
+// - kreiranje i dohvat grupnih soba,
+// - otvaranje DM soba (jedna soba po paru korisnika) i listu DM razgovora,
+// - spremanje chat poruka i dohvat propuštenih poruka nakon reconnecta,
+// - povijest poruka sa zbrojem reakcija te dodavanje i uklanjanje reakcija,
+// - niti: odgovori na poruke, sažetak niti u povijesti i sudionici niti,
+// - spominjanja (@korisnik, @room, @here) među članovima sobe,
+// - prikvačene poruke (samo moderatori, ograničen broj po sobi),
+// - pretragu poruka i privitke (upload, sličice slika i potpisani linkovi za preuzimanje),
+// - uređivanje i brisanje poruka (autor ili moderator sobe), članstvo i oznake pročitanosti (broj nepročitanih po sobi),
+// - izvoz i anonimizaciju poruka (uz brisanje privitaka) pri brisanju računa.
+//
+// Koristi Repository za pristup bazi, user.Service za javne profile sugovornika
+// i storage.Storage za datoteke privitaka.
+
+package websocket
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"mime"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"server/internal/user"
+	"server/storage"
+	"server/util"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	messageMaxLength     = 4000   // maksimalan broj znakova chat poruke
+	clientMsgIDMaxLength = 64     // maksimalna duljina ID-a koji poruci dodjeljuje klijent
+	directRoomPrefix     = "dm-"  // prefiks ID-a DM soba (vidi directRoomID)
+	persistedType        = "chat" // vrsta poruka koje se spremaju u bazu
+)
+
+// replayMaxMessages je najveći broj propuštenih poruka koje JoinRoom ponovno šalje;
+// uz veći razmak klijent dobiva "resync" i sam ponovno učitava sobu.
+const replayMaxMessages = 200
+
+const (
+	historyDefaultLimit = 50 // broj poruka po stranici povijesti ako klijent ne zada limit
+	historyMaxLimit     = 100
+	reactionMaxLength   = 16 // maksimalan broj znakova reakcije (emoji s modifikatorima)
+)
+
+// threadMaxReplies je najveći broj odgovora koje vraća GetThread.
+const threadMaxReplies = 500
+
+// pinMaxPerRoom je najveći broj prikvačenih poruka u jednoj sobi.
+const pinMaxPerRoom = 25
+
+// pinAttempts je broj pokušaja prikvačivanja kad drugi moderator istovremeno zauzme slobodno mjesto.
+const pinAttempts = 3
+
+// Ograničenja pretrage poruka.
+const (
+	searchMinQueryLength = 2
+	searchMaxQueryLength = 200
+)
+
+// Ograničenja privitaka.
+const (
+	attachmentMaxBytes          = 25 << 20 // najveća veličina datoteke (25 MB)
+	attachmentMaxPerMessage     = 10
+	attachmentFilenameMaxLength = 255
+	attachmentThumbnailSize     = 320             // najveća širina i visina sličice slike
+	attachmentUnattachedTTL     = 24 * time.Hour  // rok nakon kojeg se brišu uploadi koji nisu poslani u poruci
+	attachmentPurgeTimeout      = 5 * time.Minute // gornja granica za jedan prolaz brisanja neposlanih uploada
+)
+
+// attachmentTypes su dopuštene vrste privitaka, prepoznate iz sadržaja (http.DetectContentType).
+var attachmentTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"application/pdf": true,
+	"application/zip": true,
+	"text/plain":      true,
+	"audio/mpeg":      true,
+	"audio/wave":      true,
+	"application/ogg": true,
+	"video/mp4":       true,
+	"video/webm":      true,
+}
+
+// attachmentImageFormats su vrste privitaka za koje se radi sličica (vrsta → format za util.DecodeImage).
+var attachmentImageFormats = map[string]string{
+	"image/jpeg": "jpeg",
+	"image/png":  "png",
+	"image/gif":  "gif",
+	"image/webp": "webp",
+}
+
+// service je privatna implementacija Service interfejsa.
+type service struct {
+	Repository
+	users       user.Service
+	attachments storage.Storage
+	urls        *storage.URLSigner
+	timeout     time.Duration
+}
+
+// NewService kreira novi Service s definiranim timeoutom.
+// user.Service se koristi za provjeru postojanja i javne profile sugovornika,
+// attachments sprema datoteke privitaka, a urls potpisuje linkove za njihovo preuzimanje.
+func NewService(repository Repository, users user.Service, attachments storage.Storage, urls *storage.URLSigner) Service {
+	return &service{
+		Repository:  repository,
+		users:       users,
+		attachments: attachments,
+		urls:        urls,
+		timeout:     time.Duration(2) * time.Second,
+	}
+}
+
+// CreateRoom sprema novu grupnu sobu.
+// ID-evi s prefiksom "dm-" rezervirani su za DM sobe.
+// Sobu kreira samo prijavljeni korisnik i postaje njen moderator.
+func (s *service) CreateRoom(c context.Context, userID int64, req *CreateRoomReq) (*StoredRoom, error) {
+	if userID == 0 {
+		return nil, ErrForbidden
+	}
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	req.ID = strings.TrimSpace(req.ID)
+	req.Name = strings.TrimSpace(req.Name)
+
+	var fields []user.FieldError
+	if req.ID == "" {
+		fields = append(fields, user.FieldError{Field: "id", Code: "required", Message: "ID sobe je obavezan"})
+	} else if strings.HasPrefix(req.ID, directRoomPrefix) {
+		fields = append(fields, user.FieldError{Field: "id", Code: "reserved", Message: "ID sobe ne smije počinjati s \"dm-\""})
+	}
+	if len(fields) > 0 {
+		return nil, &user.ValidationError{Fields: fields}
+	}
+
+	room := &StoredRoom{ID: req.ID, Name: req.Name, Kind: RoomKindGroup}
+	if err := s.Repository.CreateRoom(ctx, room, userID); err != nil {
+		log.Println("Greška pri spremanju sobe:", err)
+		return nil, err
+	}
+	return room, nil
+}
+
+// GetRoom dohvaća sobu iz baze; vraća ErrRoomNotFound ako ne postoji.
+func (s *service) GetRoom(c context.Context, id string) (*StoredRoom, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	room, err := s.Repository.GetRoom(ctx, id)
+	if err != nil {
+		log.Println("Greška pri dohvaćanju sobe:", err)
+		return nil, err
+	}
+	if room == nil {
+		return nil, ErrRoomNotFound
+	}
+	return room, nil
+}
+
+// GetGroupRooms vraća sve grupne sobe (koriste se za punjenje huba pri pokretanju).
+func (s *service) GetGroupRooms(c context.Context) ([]*StoredRoom, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	return s.Repository.GetRoomsByKind(ctx, RoomKindGroup)
+}
+
+// CanJoin provjerava smije li korisnik ući u sobu.
+// Grupne sobe su otvorene svima, a u DM sobu smiju samo njena dva člana
+// dok među njima nema blokade i dok sugovornik dopušta poruke od korisnika (vidi user.CanContact).
+func (s *service) CanJoin(c context.Context, room *StoredRoom, userID int64) (bool, error) {
+	if room.Kind != RoomKindDirect {
+		return true, nil
+	}
+	peerID, ok := directRoomPeer(room.ID, userID)
+	if !ok {
+		return false, nil
+	}
+
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	member, err := s.Repository.IsMember(ctx, room.ID, userID)
+	if err != nil || !member {
+		return false, err
+	}
+	err = s.users.CanContact(ctx, userID, peerID)
+	if errors.Is(err, user.ErrBlocked) || errors.Is(err, user.ErrContactsOnly) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// SaveMessage sprema chat poruku i popunjava njen ID i vrijeme nastanka.
+// Ostale vrste poruka (signal, notification...) se ne spremaju.
+// Ako je korisnik već poslao poruku s istim ClientMsgID (npr. ponovno slanje nakon reconnecta),
+// poruka se ne sprema ponovno: popunjava se podacima spremljene poruke i vraća se true.
+// Odgovor na odgovor pripada niti početne poruke (ParentID se postavlja na početnu poruku).
+func (s *service) SaveMessage(c context.Context, userID int64, message *Message) (bool, error) {
+	if message.Type != persistedType {
+		return false, nil
+	}
+	var fields []user.FieldError
+	if utf8.RuneCountInString(message.Content) > messageMaxLength {
+		fields = append(fields, user.FieldError{Field: "content", Code: "too_long", Message: "poruka je predugačka"})
+	}
+	if len(message.ClientMsgID) > clientMsgIDMaxLength {
+		fields = append(fields, user.FieldError{Field: "clientMsgId", Code: "too_long", Message: "clientMsgId je predugačak"})
+	}
+	if len(message.AttachmentIDs) > attachmentMaxPerMessage {
+		fields = append(fields, user.FieldError{
+			Field:   "attachmentIds",
+			Code:    "too_many",
+			Message: fmt.Sprintf("poruka može imati najviše %d privitaka", attachmentMaxPerMessage),
+		})
+	}
+	if len(fields) > 0 {
+		return false, &user.ValidationError{Fields: fields}
+	}
+
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	if err := s.checkAttachments(ctx, userID, message); err != nil {
+		return false, err
+	}
+
+	if message.ParentID != 0 {
+		parent, err := s.Repository.GetMessage(ctx, message.ParentID)
+		if err != nil {
+			log.Println("Greška pri dohvaćanju poruke:", err)
+			return false, err
+		}
+		if parent == nil || parent.RoomID != message.RoomID || parent.Type != persistedType || parent.DeletedAt != nil {
+			return false, ErrMessageNotFound
+		}
+		if parent.ParentID != 0 {
+			message.ParentID = parent.ParentID
+		}
+	}
+
+	stored, err := s.Repository.SaveMessage(ctx, &StoredMessage{
+		RoomID:      message.RoomID,
+		UserID:      userID,
+		Username:    message.Username,
+		Type:        message.Type,
+		Content:     message.Content,
+		ParentID:    message.ParentID,
+		ClientMsgID: message.ClientMsgID,
+	})
+	if err != nil {
+		log.Println("Greška pri spremanju poruke:", err)
+		return false, err
+	}
+
+	duplicate := stored == nil
+	if duplicate {
+		stored, err = s.Repository.GetMessageByClientID(ctx, message.RoomID, userID, message.ClientMsgID)
+		if err != nil {
+			log.Println("Greška pri dohvaćanju poruke:", err)
+			return false, err
+		}
+		if stored == nil {
+			return false, fmt.Errorf("poruka nije spremljena")
+		}
+	}
+
+	// Ponovno poslana poruka već ima svoje privitke
+	if !duplicate && len(message.AttachmentIDs) > 0 {
+		if err := s.Repository.AttachToMessage(ctx, stored.ID, message.AttachmentIDs); err != nil {
+			log.Println("Greška pri spremanju privitaka poruke:", err)
+			return false, err
+		}
+	}
+	if len(message.AttachmentIDs) > 0 {
+		attachments, err := s.Repository.GetMessageAttachments(ctx, []int64{stored.ID})
+		if err != nil {
+			log.Println("Greška pri dohvaćanju privitaka:", err)
+			return false, err
+		}
+		message.Attachments = attachments[stored.ID]
+	}
+
+	message.ID = stored.ID
+	message.ParentID = stored.ParentID
+	message.Seq = stored.Seq
+	message.CreatedAt = &stored.CreatedAt
+	return duplicate, nil
+}
+
+// checkAttachments provjerava da je pošiljatelj uploadao privitke koje poruka navodi u njenu sobu
+// i da još nisu poslani. Već poslan privitak prihvaća se samo kod ponovnog slanja s istim ClientMsgID,
+// i to samo ako pripada upravo toj (već spremljenoj) poruci.
+func (s *service) checkAttachments(ctx context.Context, userID int64, message *Message) error {
+	if len(message.AttachmentIDs) == 0 {
+		return nil
+	}
+	invalid := &user.ValidationError{Fields: []user.FieldError{{
+		Field:   "attachmentIds",
+		Code:    "invalid",
+		Message: "privitak ne postoji ili je već poslan",
+	}}}
+	if userID == 0 {
+		return invalid
+	}
+
+	attachments, err := s.Repository.GetAttachments(ctx, message.AttachmentIDs)
+	if err != nil {
+		log.Println("Greška pri dohvaćanju privitaka:", err)
+		return err
+	}
+	var resent *StoredMessage
+	found := make(map[int64]bool, len(attachments))
+	for _, attachment := range attachments {
+		if attachment.RoomID != message.RoomID || attachment.UserID != userID {
+			continue
+		}
+		if attachment.MessageID != 0 {
+			if message.ClientMsgID == "" {
+				continue
+			}
+			if resent == nil {
+				resent, err = s.Repository.GetMessageByClientID(ctx, message.RoomID, userID, message.ClientMsgID)
+				if err != nil {
+					log.Println("Greška pri dohvaćanju poruke po ClientMsgID:", err)
+					return err
+				}
+			}
+			if resent == nil || attachment.MessageID != resent.ID {
+				continue
+			}
+		}
+		found[attachment.ID] = true
+	}
+	for _, id := range message.AttachmentIDs {
+		if !found[id] {
+			return invalid
+		}
+	}
+	return nil
+}
+
+// GetMissedMessages vraća poruke sobe spremljene, izmijenjene ili obrisane nakon since i seq zadnje promjene u sobi.
+// Ako je propušteno više od replayMaxMessages poruka ili since nije poznat sobi
+// (npr. veći je od zadnjeg seq), vraća samo Resync = true.
+func (s *service) GetMissedMessages(c context.Context, roomID string, since int64) (*MissedMessages, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	room, err := s.Repository.GetRoom(ctx, roomID)
+	if err != nil {
+		log.Println("Greška pri dohvaćanju sobe:", err)
+		return nil, err
+	}
+	if room == nil {
+		return nil, ErrRoomNotFound
+	}
+
+	res := &MissedMessages{Messages: []*StoredMessage{}, LastSeq: room.LastSeq}
+	// Otkvačivanje se ne može ponoviti iz povijesti pa promjena prikvačenih poruka traži resync
+	if since < 0 || since > room.LastSeq || room.LastSeq-since > replayMaxMessages || room.PinSeq > since {
+		res.Resync = true
+		return res, nil
+	}
+	if since == room.LastSeq {
+		return res, nil
+	}
+
+	res.Messages, err = s.Repository.GetMessagesSince(ctx, roomID, since, replayMaxMessages)
+	if err != nil {
+		log.Println("Greška pri dohvaćanju propuštenih poruka:", err)
+		return nil, err
+	}
+	res.ReadMarkers, err = s.Repository.GetReadMarkersSince(ctx, roomID, since)
+	if err != nil {
+		log.Println("Greška pri dohvaćanju oznaka pročitanosti:", err)
+		return nil, err
+	}
+	if err := s.addReactions(ctx, res.Messages, 0); err != nil {
+		return nil, err
+	}
+	// Linkove privitaka potpisuje WriteMessage za svakog klijenta
+	if err := s.addAttachments(ctx, res.Messages, 0); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// GetMessages vraća stranicu povijesti sobe: najviše limit poruka prije seq before (0 = najnovije),
+// sa zbrojem reakcija. Vraća ErrForbidden ako korisnik ne smije u sobu (vidi CanJoin).
+func (s *service) GetMessages(c context.Context, roomID string, userID, before int64, limit int) (*MessagesRes, error) {
+	if limit <= 0 {
+		limit = historyDefaultLimit
+	}
+	if limit > historyMaxLimit {
+		limit = historyMaxLimit
+	}
+	if before < 0 {
+		before = 0
+	}
+
+	room, err := s.GetRoom(c, roomID)
+	if err != nil {
+		return nil, err
+	}
+	allowed, err := s.CanJoin(c, room, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, ErrForbidden
+	}
+
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	// Jedan redak više od traženog govori postoji li starija stranica
+	messages, err := s.Repository.GetMessagesBefore(ctx, roomID, before, limit+1)
+	if err != nil {
+		log.Println("Greška pri dohvaćanju poruka:", err)
+		return nil, err
+	}
+
+	res := &MessagesRes{}
+	if len(messages) > limit {
+		messages = messages[1:]
+		next := messages[0].Seq
+		res.NextBefore = &next
+	}
+	if err := s.addReactions(ctx, messages, userID); err != nil {
+		return nil, err
+	}
+	if err := s.addThreadSummaries(ctx, messages); err != nil {
+		return nil, err
+	}
+	if err := s.addAttachments(ctx, messages, userID); err != nil {
+		return nil, err
+	}
+	res.Messages = messages
+	return res, nil
+}
+
+// GetThread vraća početnu poruku niti i njene odgovore sa zbrojem reakcija.
+// Za odgovor vraća cijelu nit kojoj pripada. Vraća ErrForbidden ako korisnik ne smije u sobu.
+func (s *service) GetThread(c context.Context, userID, messageID int64) (*ThreadRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	parent, err := s.Repository.GetMessage(ctx, messageID)
+	if err != nil {
+		log.Println("Greška pri dohvaćanju poruke:", err)
+		return nil, err
+	}
+	if parent != nil && parent.ParentID != 0 {
+		if parent, err = s.Repository.GetMessage(ctx, parent.ParentID); err != nil {
+			log.Println("Greška pri dohvaćanju poruke:", err)
+			return nil, err
+		}
+	}
+	if parent == nil || parent.Type != persistedType {
+		return nil, ErrMessageNotFound
+	}
+
+	room, err := s.GetRoom(ctx, parent.RoomID)
+	if err != nil {
+		return nil, err
+	}
+	allowed, err := s.CanJoin(ctx, room, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, ErrForbidden
+	}
+
+	replies, err := s.Repository.GetThreadReplies(ctx, parent.ID, threadMaxReplies)
+	if err != nil {
+		log.Println("Greška pri dohvaćanju niti:", err)
+		return nil, err
+	}
+	thread := append([]*StoredMessage{parent}, replies...)
+	if err := s.addReactions(ctx, thread, userID); err != nil {
+		return nil, err
+	}
+	if err := s.addAttachments(ctx, thread, userID); err != nil {
+		return nil, err
+	}
+	if err := s.addThreadSummaries(ctx, []*StoredMessage{parent}); err != nil {
+		return nil, err
+	}
+	return &ThreadRes{Parent: parent, Replies: replies}, nil
+}
+
+// GetThreadParticipants vraća ID-eve korisnika koji sudjeluju u niti (autor početne poruke i autori odgovora).
+func (s *service) GetThreadParticipants(c context.Context, parentID int64) ([]int64, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	return s.Repository.GetThreadParticipants(ctx, parentID)
+}
+
+// SaveMentions sprema spominjanja u chat poruci i vraća ID-eve spomenutih korisnika.
+// @korisnik se razrješava među članovima sobe, @room znači sve članove, a @here spojene
+// korisnike u sobi (hereIDs, njih zna samo hub). Pošiljatelj se nikad ne spominje sam.
+// Neprijavljeni pošiljatelji ne spominju nikoga, a @room i @here smiju samo članovi sobe.
+func (s *service) SaveMentions(c context.Context, message *Message, hereIDs []int64) ([]int64, error) {
+	if message.senderID == 0 {
+		return nil, nil
+	}
+	usernames, room, here := parseMentions(message.Content)
+	if len(usernames) == 0 && !room && !here {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	if room || here {
+		member, err := s.Repository.IsMember(ctx, message.RoomID, message.senderID)
+		if err != nil {
+			log.Println("Greška pri provjeri članstva:", err)
+			return nil, err
+		}
+		if !member {
+			room, here = false, false
+		}
+	}
+
+	var candidates []int64
+	if room {
+		members, err := s.Repository.GetMemberIDs(ctx, message.RoomID)
+		if err != nil {
+			log.Println("Greška pri dohvaćanju članova sobe:", err)
+			return nil, err
+		}
+		candidates = append(candidates, members...)
+	} else if len(usernames) > 0 {
+		members, err := s.Repository.GetMemberIDsByUsername(ctx, message.RoomID, usernames)
+		if err != nil {
+			log.Println("Greška pri dohvaćanju članova sobe:", err)
+			return nil, err
+		}
+		candidates = append(candidates, members...)
+	}
+	if here {
+		candidates = append(candidates, hereIDs...)
+	}
+
+	seen := make(map[int64]bool, len(candidates))
+	mentioned := make([]int64, 0, len(candidates))
+	for _, id := range candidates {
+		if id == 0 || id == message.senderID || seen[id] {
+			continue
+		}
+		seen[id] = true
+		mentioned = append(mentioned, id)
+	}
+	if len(mentioned) == 0 {
+		return nil, nil
+	}
+
+	if err := s.Repository.SaveMentions(ctx, message.ID, mentioned); err != nil {
+		log.Println("Greška pri spremanju spominjanja:", err)
+		return nil, err
+	}
+	return mentioned, nil
+}
+
+// GetMentions vraća spominjanja korisnika od najnovijeg uz paginaciju (limit, offset).
+func (s *service) GetMentions(c context.Context, userID int64, limit, offset int) (*MentionsRes, error) {
+	if limit <= 0 {
+		limit = historyDefaultLimit
+	}
+	if limit > historyMaxLimit {
+		limit = historyMaxLimit
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	// Jedan redak više od traženog govori postoji li sljedeća stranica
+	mentions, err := s.Repository.GetMentions(ctx, userID, limit+1, offset)
+	if err != nil {
+		log.Println("Greška pri dohvaćanju spominjanja:", err)
+		return nil, err
+	}
+
+	res := &MentionsRes{}
+	if len(mentions) > limit {
+		mentions = mentions[:limit]
+		next := offset + limit
+		res.NextOffset = &next
+	}
+	messages := make([]*StoredMessage, 0, len(mentions))
+	for _, mention := range mentions {
+		messages = append(messages, mention.Message)
+	}
+	if err := s.addAttachments(ctx, messages, userID); err != nil {
+		return nil, err
+	}
+	res.Results = mentions
+	return res, nil
+}
+
+// addThreadSummaries popunjava broj odgovora i vrijeme zadnjeg odgovora za početne poruke niti.
+func (s *service) addThreadSummaries(ctx context.Context, messages []*StoredMessage) error {
+	ids := make([]int64, 0, len(messages))
+	for _, message := range messages {
+		if message.ParentID == 0 {
+			ids = append(ids, message.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	summaries, err := s.Repository.GetThreadSummaries(ctx, ids)
+	if err != nil {
+		log.Println("Greška pri dohvaćanju niti:", err)
+		return err
+	}
+	for _, message := range messages {
+		if summary, ok := summaries[message.ID]; ok {
+			message.ReplyCount = summary.ReplyCount
+			lastReplyAt := summary.LastReplyAt
+			message.LastReplyAt = &lastReplyAt
+		}
+	}
+	return nil
+}
+
+// addReactions popunjava zbroj reakcija poruka; userID označava vlastite reakcije (0 = ne označava).
+func (s *service) addReactions(ctx context.Context, messages []*StoredMessage, userID int64) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	ids := make([]int64, 0, len(messages))
+	for _, message := range messages {
+		ids = append(ids, message.ID)
+	}
+
+	counts, err := s.Repository.GetReactionCounts(ctx, ids, userID)
+	if err != nil {
+		log.Println("Greška pri dohvaćanju reakcija:", err)
+		return err
+	}
+	for _, message := range messages {
+		message.Reactions = counts[message.ID]
+	}
+	return nil
+}
+
+// EditMessage mijenja sadržaj chat poruke u sobi; prethodni sadržaj ostaje u povijesti izmjena.
+// Poruku smiju mijenjati njen autor i moderator sobe.
+func (s *service) EditMessage(c context.Context, roomID string, userID, messageID int64, content string) (*StoredMessage, error) {
+	var fields []user.FieldError
+	if strings.TrimSpace(content) == "" {
+		fields = append(fields, user.FieldError{Field: "content", Code: "required", Message: "poruka ne smije biti prazna"})
+	} else if utf8.RuneCountInString(content) > messageMaxLength {
+		fields = append(fields, user.FieldError{Field: "content", Code: "too_long", Message: "poruka je predugačka"})
+	}
+	if len(fields) > 0 {
+		return nil, &user.ValidationError{Fields: fields}
+	}
+
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	message, err := s.modifiableMessage(ctx, roomID, userID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	editedAt, updateSeq, err := s.Repository.EditMessage(ctx, messageID, userID, content)
+	if err != nil {
+		log.Println("Greška pri uređivanju poruke:", err)
+		return nil, err
+	}
+	if editedAt == nil {
+		return nil, ErrMessageNotFound
+	}
+
+	message.Content = content
+	message.EditedAt = editedAt
+	message.UpdateSeq = updateSeq
+	return message, nil
+}
+
+// DeleteMessage briše chat poruku u sobi; zapis ostaje bez sadržaja (tombstone).
+// Poruku smiju brisati njen autor i moderator sobe.
+func (s *service) DeleteMessage(c context.Context, roomID string, userID, messageID int64) (*StoredMessage, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	message, err := s.modifiableMessage(ctx, roomID, userID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	deletedAt, updateSeq, err := s.Repository.DeleteMessage(ctx, messageID)
+	if err != nil {
+		log.Println("Greška pri brisanju poruke:", err)
+		return nil, err
+	}
+	if deletedAt == nil {
+		return nil, ErrMessageNotFound
+	}
+	attachments, err := s.Repository.DeleteMessageAttachments(ctx, messageID)
+	if err != nil {
+		log.Println("Greška pri brisanju privitaka poruke:", err)
+	}
+	s.deleteAttachmentFiles(ctx, attachments)
+
+	message.Content = ""
+	message.DeletedAt = deletedAt
+	message.UpdateSeq = updateSeq
+	return message, nil
+}
+
+// AddReaction dodaje reakciju korisnika na poruku u sobi.
+// Vraća novi zbroj reakcija poruke i seq promjene (vidi resume.go), ili 0 ako je korisnik već reagirao istim emojijem.
+func (s *service) AddReaction(c context.Context, roomID string, userID, messageID int64, emoji string) ([]ReactionCount, int64, error) {
+	return s.react(c, roomID, userID, messageID, emoji, true)
+}
+
+// RemoveReaction uklanja reakciju korisnika s poruke u sobi.
+// Vraća novi zbroj reakcija poruke i seq promjene, ili 0 ako korisnik nije reagirao tim emojijem.
+func (s *service) RemoveReaction(c context.Context, roomID string, userID, messageID int64, emoji string) ([]ReactionCount, int64, error) {
+	return s.react(c, roomID, userID, messageID, emoji, false)
+}
+
+// react dodaje (add = true) ili uklanja reakciju i vraća novi zbroj reakcija poruke i seq promjene.
+func (s *service) react(c context.Context, roomID string, userID, messageID int64, emoji string, add bool) ([]ReactionCount, int64, error) {
+	emoji = strings.TrimSpace(emoji)
+	var fields []user.FieldError
+	if emoji == "" {
+		fields = append(fields, user.FieldError{Field: "emoji", Code: "required", Message: "reakcija je obavezna"})
+	} else if utf8.RuneCountInString(emoji) > reactionMaxLength {
+		fields = append(fields, user.FieldError{Field: "emoji", Code: "too_long", Message: "reakcija je predugačka"})
+	}
+	if len(fields) > 0 {
+		return nil, 0, &user.ValidationError{Fields: fields}
+	}
+	if userID == 0 {
+		return nil, 0, ErrForbidden
+	}
+
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	message, err := s.Repository.GetMessage(ctx, messageID)
+	if err != nil {
+		log.Println("Greška pri dohvaćanju poruke:", err)
+		return nil, 0, err
+	}
+	if message == nil || message.RoomID != roomID || message.Type != persistedType || message.DeletedAt != nil {
+		return nil, 0, ErrMessageNotFound
+	}
+
+	var seq int64
+	if add {
+		seq, err = s.Repository.AddReaction(ctx, roomID, messageID, userID, emoji)
+	} else {
+		seq, err = s.Repository.RemoveReaction(ctx, roomID, messageID, userID, emoji)
+	}
+	if err != nil {
+		log.Println("Greška pri spremanju reakcije:", err)
+		return nil, 0, err
+	}
+
+	counts, err := s.Repository.GetReactionCounts(ctx, []int64{messageID}, 0)
+	if err != nil {
+		log.Println("Greška pri dohvaćanju reakcija:", err)
+		return nil, 0, err
+	}
+	return counts[messageID], seq, nil
+}
+
+// modifiableMessage dohvaća poruku koju korisnik smije urediti ili obrisati.
+// Vraća ErrMessageNotFound ako poruka ne postoji u sobi ili je obrisana,
+// a ErrForbidden ako korisnik nije autor poruke ni moderator sobe.
+func (s *service) modifiableMessage(ctx context.Context, roomID string, userID, messageID int64) (*StoredMessage, error) {
+	if userID == 0 {
+		return nil, ErrForbidden
+	}
+
+	message, err := s.Repository.GetMessage(ctx, messageID)
+	if err != nil {
+		log.Println("Greška pri dohvaćanju poruke:", err)
+		return nil, err
+	}
+	if message == nil || message.RoomID != roomID || message.Type != persistedType || message.DeletedAt != nil {
+		return nil, ErrMessageNotFound
+	}
+	if message.UserID == userID {
+		return message, nil
+	}
+
+	if err := s.requireModerator(ctx, roomID, userID); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// isModerator provjerava je li korisnik moderator sobe.
+func (s *service) isModerator(ctx context.Context, roomID string, userID int64) (bool, error) {
+	if userID == 0 {
+		return false, nil
+	}
+	role, err := s.Repository.GetMemberRole(ctx, roomID, userID)
+	if err != nil {
+		log.Println("Greška pri dohvaćanju uloge člana:", err)
+		return false, err
+	}
+	return role == RoleModerator, nil
+}
+
+// PinMessage prikvačuje chat poruku u sobi; smiju samo moderatori sobe.
+// Vraća prikvačenu poruku i seq prikvačivanja (vidi resume.go), ili 0 ako je poruka već bila prikvačena.
+func (s *service) PinMessage(c context.Context, roomID string, userID, messageID int64) (*Pin, int64, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	if err := s.requireModerator(ctx, roomID, userID); err != nil {
+		return nil, 0, err
+	}
+	message, err := s.Repository.GetMessage(ctx, messageID)
+	if err != nil {
+		log.Println("Greška pri dohvaćanju poruke:", err)
+		return nil, 0, err
+	}
+	if message == nil || message.RoomID != roomID || message.Type != persistedType || message.DeletedAt != nil {
+		return nil, 0, ErrMessageNotFound
+	}
+
+	for attempt := 0; attempt < pinAttempts; attempt++ {
+		pins, err := s.Repository.GetPins(ctx, roomID)
+		if err != nil {
+			log.Println("Greška pri dohvaćanju prikvačenih poruka:", err)
+			return nil, 0, err
+		}
+		for _, pin := range pins {
+			if pin.Message.ID == messageID {
+				return pin, 0, nil
+			}
+		}
+		if len(pins) >= pinMaxPerRoom {
+			return nil, 0, &user.ValidationError{Fields: []user.FieldError{{
+				Field:   "messageId",
+				Code:    "pin_limit",
+				Message: fmt.Sprintf("soba može imati najviše %d prikvačenih poruka", pinMaxPerRoom),
+			}}}
+		}
+
+		pin, err := s.Repository.PinMessage(ctx, roomID, messageID, userID, pinMaxPerRoom)
+		if err != nil {
+			log.Println("Greška pri prikvačivanju poruke:", err)
+			return nil, 0, err
+		}
+		if pin != nil {
+			pin.Message = message
+			return pin, pin.Seq, nil
+		}
+		// Drugi moderator je upravo prikvačio ovu poruku ili zauzeo slobodno mjesto — provjera se ponavlja
+	}
+	return nil, 0, fmt.Errorf("poruka nije prikvačena nakon %d pokušaja", pinAttempts)
+}
+
+// UnpinMessage otkvačuje poruku u sobi; smiju samo moderatori sobe.
+// Vraća seq otkvačivanja, ili 0 ako poruka nije bila prikvačena.
+func (s *service) UnpinMessage(c context.Context, roomID string, userID, messageID int64) (int64, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	if err := s.requireModerator(ctx, roomID, userID); err != nil {
+		return 0, err
+	}
+	seq, err := s.Repository.UnpinMessage(ctx, roomID, messageID)
+	if err != nil {
+		log.Println("Greška pri otkvačivanju poruke:", err)
+		return 0, err
+	}
+	return seq, nil
+}
+
+// GetPins vraća prikvačene poruke sobe; vraća ErrForbidden ako korisnik ne smije u sobu.
+func (s *service) GetPins(c context.Context, roomID string, userID int64) ([]*Pin, error) {
+	room, err := s.GetRoom(c, roomID)
+	if err != nil {
+		return nil, err
+	}
+	allowed, err := s.CanJoin(c, room, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, ErrForbidden
+	}
+
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	pins, err := s.Repository.GetPins(ctx, roomID)
+	if err != nil {
+		log.Println("Greška pri dohvaćanju prikvačenih poruka:", err)
+		return nil, err
+	}
+	messages := make([]*StoredMessage, 0, len(pins))
+	for _, pin := range pins {
+		messages = append(messages, pin.Message)
+	}
+	if err := s.addAttachments(ctx, messages, userID); err != nil {
+		return nil, err
+	}
+	return pins, nil
+}
+
+// SearchMessages pretražuje poruke u sobama kojih je korisnik član, od najnovije,
+// uz paginaciju po ID-u poruke (req.Before).
+func (s *service) SearchMessages(c context.Context, userID int64, req *MessageSearchReq) (*MessageSearchRes, error) {
+	req.Query = strings.TrimSpace(req.Query)
+	req.From = strings.TrimPrefix(strings.TrimSpace(req.From), "@")
+	switch length := utf8.RuneCountInString(req.Query); {
+	case length < searchMinQueryLength:
+		return nil, &user.ValidationError{Fields: []user.FieldError{{
+			Field:   "q",
+			Code:    "too_short",
+			Message: fmt.Sprintf("upit mora imati barem %d znaka", searchMinQueryLength),
+		}}}
+	case length > searchMaxQueryLength:
+		return nil, &user.ValidationError{Fields: []user.FieldError{{
+			Field:   "q",
+			Code:    "too_long",
+			Message: "upit je predugačak",
+		}}}
+	}
+	if req.Limit <= 0 {
+		req.Limit = historyDefaultLimit
+	}
+	if req.Limit > historyMaxLimit {
+		req.Limit = historyMaxLimit
+	}
+	if req.Before < 0 {
+		req.Before = 0
+	}
+
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	// Jedan redak više od traženog govori postoji li sljedeća stranica
+	results, err := s.Repository.SearchMessages(ctx, userID, req, req.Limit+1)
+	if err != nil {
+		log.Println("Greška pri pretrazi poruka:", err)
+		return nil, err
+	}
+
+	res := &MessageSearchRes{}
+	if len(results) > req.Limit {
+		results = results[:req.Limit]
+		next := results[len(results)-1].Message.ID
+		res.NextBefore = &next
+	}
+	messages := make([]*StoredMessage, 0, len(results))
+	for _, result := range results {
+		result.Snippet = highlightSnippet(result.Snippet)
+		messages = append(messages, result.Message)
+	}
+	if err := s.addAttachments(ctx, messages, userID); err != nil {
+		return nil, err
+	}
+	res.Results = results
+	return res, nil
+}
+
+// requireModerator vraća ErrForbidden ako korisnik nije moderator sobe.
+func (s *service) requireModerator(ctx context.Context, roomID string, userID int64) error {
+	moderator, err := s.isModerator(ctx, roomID, userID)
+	if err != nil {
+		return err
+	}
+	if !moderator {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// AddMember bilježi korisnika kao člana sobe (pri prvom ulasku u grupnu sobu).
+func (s *service) AddMember(c context.Context, roomID string, userID int64) error {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	return s.Repository.AddMember(ctx, roomID, userID)
+}
+
+// MarkRoomRead pomiče oznaku zadnje pročitane poruke korisnika u sobi do messageID
+// (0 = do zadnje poruke) i vraća novu oznaku i njen seq (0 ako se oznaka nije pomaknula, vidi resume.go).
+// Vraća ErrForbidden ako korisnik nije član sobe.
+func (s *service) MarkRoomRead(c context.Context, roomID string, userID, messageID int64) (int64, int64, error) {
+	if messageID <= 0 {
+		messageID = math.MaxInt64
+	}
+
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	lastRead, seq, member, err := s.Repository.MarkRoomRead(ctx, roomID, userID, messageID)
+	if err != nil {
+		log.Println("Greška pri označavanju sobe pročitanom:", err)
+		return 0, 0, err
+	}
+	if !member {
+		return 0, 0, ErrForbidden
+	}
+	return lastRead, seq, nil
+}
+
+// GetUnreadCounts vraća broj nepročitanih poruka po sobi (roomID → broj).
+func (s *service) GetUnreadCounts(c context.Context, userID int64) (map[string]int, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	return s.Repository.GetUnreadCounts(ctx, userID)
+}
+
+// OpenDirectRoom vraća DM sobu za korisnika i sugovornika, kreirajući je ako još ne postoji.
+// Poziv je idempotentan — isti par uvijek dobiva istu sobu.
+// Ako postoji blokada ili sugovornik prima poruke samo od kontakata, vraća grešku iz user.CanContact.
+func (s *service) OpenDirectRoom(c context.Context, userID, peerID int64) (*DirectRoomRes, error) {
+	if userID == peerID {
+		return nil, &user.ValidationError{Fields: []user.FieldError{{
+			Field:   "userID",
+			Code:    "self",
+			Message: "ne možete otvoriti razgovor sami sa sobom",
+		}}}
+	}
+
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	peer, err := s.users.GetPublicProfile(ctx, peerID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.users.CanContact(ctx, userID, peerID); err != nil {
+		return nil, err
+	}
+
+	roomID := directRoomID(userID, peerID)
+	if err := s.Repository.CreateDirectRoom(ctx, roomID, userID, peerID); err != nil {
+		log.Println("Greška pri kreiranju DM sobe:", err)
+		return nil, err
+	}
+
+	return &DirectRoomRes{RoomID: roomID, Peer: peer}, nil
+}
+
+// GetDirectConversations vraća DM razgovore korisnika s profilom sugovornika,
+// zadnjom porukom i brojem nepročitanih poruka.
+func (s *service) GetDirectConversations(c context.Context, userID int64) ([]DirectConversationRes, error) {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	conversations, err := s.Repository.GetDirectConversations(ctx, userID)
+	if err != nil {
+		log.Println("Greška pri dohvaćanju DM razgovora:", err)
+		return nil, err
+	}
+
+	res := make([]DirectConversationRes, 0, len(conversations))
+	for _, conversation := range conversations {
+		peer, err := s.users.GetPublicProfile(ctx, conversation.PeerID)
+		if err != nil {
+			log.Println("Greška pri dohvaćanju sugovornika:", err)
+			continue
+		}
+		res = append(res, DirectConversationRes{
+			RoomID:      conversation.RoomID,
+			Peer:        peer,
+			LastMessage: conversation.LastMessage,
+			UnreadCount: conversation.UnreadCount,
+		})
+	}
+	return res, nil
+}
+
+// ExportUserData vraća sve poruke koje je korisnik poslao, njegova članstva u sobama i povijest poziva.
+func (s *service) ExportUserData(ctx context.Context, userID int64) (map[string]interface{}, error) {
+	messages, err := s.Repository.GetMessagesByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	rooms, err := s.Repository.GetMembershipsByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	calls, err := s.Repository.GetCallsByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"messages": messages, "rooms": rooms, "calls": calls}, nil
+}
+
+// RecordCall bilježi call-request u povijest poziva sobe.
+func (s *service) RecordCall(c context.Context, roomID string, callerID int64) error {
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	return s.Repository.RecordCall(ctx, roomID, callerID)
+}
+
+// DeleteUserData briše privitke i anonimizira poruke korisnika; članstva se brišu kaskadno s korisnikom.
+func (s *service) DeleteUserData(ctx context.Context, userID int64) error {
+	attachments, err := s.Repository.DeleteAttachmentsByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	s.deleteAttachmentFiles(ctx, attachments)
+	return s.Repository.AnonymizeMessagesByUser(ctx, userID)
+}
+
+// addAttachments popunjava privitke poruka s linkovima potpisanima za korisnika userID.
+func (s *service) addAttachments(ctx context.Context, messages []*StoredMessage, userID int64) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	ids := make([]int64, 0, len(messages))
+	for _, message := range messages {
+		ids = append(ids, message.ID)
+	}
+
+	attachments, err := s.Repository.GetMessageAttachments(ctx, ids)
+	if err != nil {
+		log.Println("Greška pri dohvaćanju privitaka:", err)
+		return err
+	}
+	for _, message := range messages {
+		message.Attachments = s.SignAttachments(attachments[message.ID], userID)
+	}
+	return nil
+}
+
+// UploadAttachment sprema datoteku koju korisnik prilaže u sobu i vraća privitak s potpisanim linkovima.
+// Vrsta datoteke prepoznaje se iz sadržaja (vidi attachmentTypes); za slike se sprema i sličica.
+// Privitak se u sobi pojavljuje tek kad ga korisnik navede u chat poruci (attachmentIds);
+// upload koji nije poslan unutar attachmentUnattachedTTL briše PurgeUnattachedAttachments.
+// Uploadati smiju samo prijavljeni članovi sobe.
+func (s *service) UploadAttachment(c context.Context, roomID string, userID int64, filename string, data []byte) (*Attachment, error) {
+	if userID == 0 {
+		return nil, ErrForbidden
+	}
+	if _, err := s.GetRoom(c, roomID); err != nil {
+		return nil, err
+	}
+	member, err := s.Repository.IsMember(c, roomID, userID)
+	if err != nil {
+		log.Println("Greška pri provjeri članstva:", err)
+		return nil, err
+	}
+	if !member {
+		return nil, ErrForbidden
+	}
+
+	if len(data) == 0 || len(data) > attachmentMaxBytes {
+		return nil, &user.ValidationError{Fields: []user.FieldError{{
+			Field:   "file",
+			Code:    "invalid_size",
+			Message: fmt.Sprintf("privitak mora imati između 1 B i %d MB", attachmentMaxBytes>>20),
+		}}}
+	}
+	contentType := http.DetectContentType(data)
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if !attachmentTypes[mediaType] {
+		return nil, &user.ValidationError{Fields: []user.FieldError{{
+			Field:   "file",
+			Code:    "unsupported_type",
+			Message: "vrsta datoteke nije dopuštena",
+		}}}
+	}
+
+	attachment := &Attachment{
+		RoomID:      roomID,
+		UserID:      userID,
+		Filename:    attachmentFilename(filename),
+		ContentType: contentType,
+		Size:        int64(len(data)),
+	}
+
+	var thumbnail bytes.Buffer
+	if format, ok := attachmentImageFormats[mediaType]; ok {
+		img, _, err := util.DecodeImage(data, format)
+		if err != nil {
+			log.Println("Neispravna slika privitka:", err)
+			return nil, &user.ValidationError{Fields: []user.FieldError{{
+				Field:   "file",
+				Code:    "invalid_image",
+				Message: "slika je oštećena ili prevelika",
+			}}}
+		}
+		attachment.Width, attachment.Height = img.Bounds().Dx(), img.Bounds().Dy()
+		if err := util.EncodePNG(&thumbnail, util.FitThumbnail(img, attachmentThumbnailSize)); err != nil {
+			return nil, fmt.Errorf("failed to encode thumbnail: %w", err)
+		}
+	}
+
+	// Obrada slike može trajati pa timeout počinje tek nakon izrade sličice
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	key, err := attachmentKey()
+	if err != nil {
+		return nil, err
+	}
+	attachment.StorageKey = key
+	if err := s.attachments.Put(ctx, attachment.StorageKey, bytes.NewReader(data), contentType); err != nil {
+		log.Println("Greška pri spremanju privitka:", err)
+		return nil, err
+	}
+	if thumbnail.Len() > 0 {
+		attachment.ThumbnailKey = key + "-thumb.png"
+		if err := s.attachments.Put(ctx, attachment.ThumbnailKey, &thumbnail, "image/png"); err != nil {
+			log.Println("Greška pri spremanju sličice privitka:", err)
+			s.deleteAttachmentFiles(ctx, []*Attachment{attachment})
+			return nil, err
+		}
+	}
+
+	if _, err := s.Repository.CreateAttachment(ctx, attachment); err != nil {
+		log.Println("Greška pri spremanju privitka u bazu:", err)
+		s.deleteAttachmentFiles(ctx, []*Attachment{attachment})
+		return nil, err
+	}
+	return s.SignAttachments([]*Attachment{attachment}, userID)[0], nil
+}
+
+// OpenAttachment provjerava potpisani link (vidi SignAttachments) i otvara datoteku privitka
+// ili njenu sličicu (variant=thumbnail). Korisnik za kojeg je link potpisan mora biti prijavljen
+// i i dalje član sobe privitka.
+// Pozivatelj mora zatvoriti ReadCloser.
+func (s *service) OpenAttachment(c context.Context, id int64, query url.Values) (*Attachment, io.ReadCloser, error) {
+	if err := s.urls.Verify(attachmentPath(id), query); err != nil {
+		return nil, nil, ErrAttachmentLink
+	}
+	userID, err := strconv.ParseInt(query.Get("user"), 10, 64)
+	if err != nil || userID == 0 {
+		return nil, nil, ErrAttachmentLink
+	}
+
+	ctx, cancel := context.WithTimeout(c, s.timeout)
+	defer cancel()
+
+	attachment, err := s.Repository.GetAttachment(ctx, id)
+	if err != nil {
+		log.Println("Greška pri dohvaćanju privitka:", err)
+		return nil, nil, err
+	}
+	if attachment == nil {
+		return nil, nil, ErrAttachmentNotFound
+	}
+	member, err := s.Repository.IsMember(ctx, attachment.RoomID, userID)
+	if err != nil {
+		log.Println("Greška pri provjeri članstva:", err)
+		return nil, nil, err
+	}
+	if !member {
+		return nil, nil, ErrForbidden
+	}
+
+	key := attachment.StorageKey
+	if query.Get("variant") == thumbnailVariant {
+		key = attachment.ThumbnailKey
+	}
+	if key == "" {
+		return nil, nil, ErrAttachmentNotFound
+	}
+	// Sadržaj se čita nakon povratka pa se ne veže uz timeout upita
+	content, err := s.attachments.Get(c, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil, ErrAttachmentNotFound
+	}
+	if err != nil {
+		log.Println("Greška pri otvaranju privitka:", err)
+		return nil, nil, err
+	}
+	return attachment, content, nil
+}
+
+// SignAttachments vraća kopije privitaka s linkovima za preuzimanje potpisanima za korisnika userID.
+// Anonimni korisnik (userID 0) dobiva privitke bez linkova jer ih OpenAttachment ne bi prihvatio.
+func (s *service) SignAttachments(attachments []*Attachment, userID int64) []*Attachment {
+	if len(attachments) == 0 {
+		return nil
+	}
+	signed := make([]*Attachment, 0, len(attachments))
+	for _, attachment := range attachments {
+		link := *attachment
+		if userID == 0 {
+			signed = append(signed, &link)
+			continue
+		}
+		query := url.Values{"user": {strconv.FormatInt(userID, 10)}}
+		link.URL = s.urls.Sign(attachmentPath(attachment.ID), query)
+		if attachment.ThumbnailKey != "" {
+			query.Set("variant", thumbnailVariant)
+			link.ThumbnailURL = s.urls.Sign(attachmentPath(attachment.ID), query)
+		}
+		signed = append(signed, &link)
+	}
+	return signed
+}
+
+// deleteAttachmentFiles briše datoteke i sličice privitaka; greške se samo logiraju.
+func (s *service) deleteAttachmentFiles(ctx context.Context, attachments []*Attachment) {
+	for _, attachment := range attachments {
+		for _, key := range []string{attachment.StorageKey, attachment.ThumbnailKey} {
+			if key == "" {
+				continue
+			}
+			if err := s.attachments.Delete(ctx, key); err != nil {
+				log.Println("Greška pri brisanju privitka:", err)
+			}
+		}
+	}
+}
+
+// PurgeUnattachedAttachments briše uploade koji ni nakon attachmentUnattachedTTL nisu poslani u poruci,
+// zajedno s datotekama. Vraća broj obrisanih privitaka.
+func (s *service) PurgeUnattachedAttachments(c context.Context) (int, error) {
+	ctx, cancel := context.WithTimeout(c, attachmentPurgeTimeout)
+	defer cancel()
+
+	attachments, err := s.Repository.DeleteUnattachedAttachments(ctx, time.Now().Add(-attachmentUnattachedTTL))
+	if err != nil {
+		return 0, err
+	}
+	s.deleteAttachmentFiles(ctx, attachments)
+	return len(attachments), nil
+}
+
+// RunAttachmentPurge periodično pokreće PurgeUnattachedAttachments (pokreće se kao go-rutina iz main).
+func (s *service) RunAttachmentPurge(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		purged, err := s.PurgeUnattachedAttachments(context.Background())
+		if err != nil {
+			log.Println("Greška pri brisanju neposlanih privitaka:", err)
+			continue
+		}
+		if purged > 0 {
+			log.Printf("Obrisano neposlanih privitaka: %d", purged)
+		}
+	}
+}
+
+// attachmentKey vraća novi nasumični ključ datoteke privitka u spremištu.
+func attachmentKey() (string, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return "attachments/" + hex.EncodeToString(token), nil
+}
+
+// attachmentFilename čisti ime datoteke koje je poslao klijent (bez putanje i kontrolnih znakova).
+func attachmentFilename(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, filepath.Base(strings.ReplaceAll(name, "\\", "/")))
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." || name == ".." || name == "/" {
+		return "privitak"
+	}
+	if runes := []rune(name); len(runes) > attachmentFilenameMaxLength {
+		name = string(runes[:attachmentFilenameMaxLength])
+	}
+	return name
+}
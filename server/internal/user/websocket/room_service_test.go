@@ -0,0 +1,41 @@
+package websocket
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAttachmentFilename(t *testing.T) {
+	long := strings.Repeat("ž", attachmentFilenameMaxLength+10)
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"plain", "izvjestaj.pdf", "izvjestaj.pdf"},
+		{"unicode", "Šibenik ljeto.jpg", "Šibenik ljeto.jpg"},
+		{"unix path", "/home/ana/slika.png", "slika.png"},
+		{"windows path", `C:\Users\ana\slika.png`, "slika.png"},
+		{"parent traversal", "../../etc/passwd", "passwd"},
+		{"windows traversal", `..\..\boot.ini`, "boot.ini"},
+		{"mixed separators", `a/..\../tajna.txt`, "tajna.txt"},
+		{"only parent", "..", "privitak"},
+		{"trailing slash", "../", "privitak"},
+		{"dot", ".", "privitak"},
+		{"root", "/", "privitak"},
+		{"empty", "", "privitak"},
+		{"spaces", "   ", "privitak"},
+		{"control characters", "ra\x00cun\n.pdf\r", "racun.pdf"},
+		{"control characters only", "\x00\x1f", "privitak"},
+		{"surrounding spaces", "  slika.png  ", "slika.png"},
+		{"too long", long, long[:len("ž")*attachmentFilenameMaxLength]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := attachmentFilename(tt.in); got != tt.want {
+				t.Fatalf("attachmentFilename(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
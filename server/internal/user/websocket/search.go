@@ -0,0 +1,93 @@
+// Package websocket - pretraga poruka.
+// GET /search/messages?q=&room=&from=&before= pretražuje chat poruke u sobama kojih je korisnik član.
+// Upit podržava sintaksu websearch_to_tsquery (riječi, "fraza", -riječ, or) i stema se hrvatski i engleski,
+// pa "poruke" pronalazi i "poruka", a "messages" i "message".
+// Rezultati su poredani od najnovije poruke i straniče se preko before (ID poruke iz nextBefore).
+
+package websocket
+
+import (
+	"html"
+	"net/http"
+	"server/internal/user"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Oznake pogodaka u isječku koji vraća baza. HTML escapiranje ne mijenja kontrolne znakove,
+// a baza ih uklanja iz sadržaja prije označavanja (vidi Repository.SearchMessages),
+// pa se nakon escapiranja sigurno zamjenjuju s <mark> oznakama.
+const (
+	snippetStart = "\x01"
+	snippetStop  = "\x02"
+)
+
+// snippetReplacer pretvara oznake pogodaka u HTML.
+var snippetReplacer = strings.NewReplacer(snippetStart, "<mark>", snippetStop, "</mark>")
+
+// highlightSnippet escapira isječak iz baze i omata pogotke u <mark></mark>.
+func highlightSnippet(snippet string) string {
+	return snippetReplacer.Replace(html.EscapeString(snippet))
+}
+
+// splitSearchQuery dijeli websearch upit na dio kojem poruka mora odgovarati i isključene riječi
+// ili fraze (-riječ, -"fraza"), koje se stemaju i provjeravaju zasebno (vidi Repository.SearchMessages).
+func splitSearchQuery(query string) (include string, exclude []string) {
+	var kept []string
+	for _, term := range searchTerms(query) {
+		if len(term) > 1 && term[0] == '-' {
+			exclude = append(exclude, term[1:])
+			continue
+		}
+		kept = append(kept, term)
+	}
+	return strings.Join(kept, " "), exclude
+}
+
+// searchTerms dijeli upit na riječi i fraze u navodnicima (navodnici ostaju dio fraze).
+func searchTerms(query string) []string {
+	var terms []string
+	var term strings.Builder
+	quoted := false
+	for _, r := range query {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			term.WriteRune(r)
+		case unicode.IsSpace(r) && !quoted:
+			if term.Len() > 0 {
+				terms = append(terms, term.String())
+				term.Reset()
+			}
+		default:
+			term.WriteRune(r)
+		}
+	}
+	if term.Len() > 0 {
+		terms = append(terms, term.String())
+	}
+	return terms
+}
+
+// SearchMessages pretražuje poruke prijavljenog korisnika (GET /search/messages, ?limit=).
+func (h *Handler) SearchMessages(c *gin.Context) {
+	before, _ := strconv.ParseInt(c.Query("before"), 10, 64)
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	req := &MessageSearchReq{
+		Query:  c.Query("q"),
+		RoomID: c.Query("room"),
+		From:   c.Query("from"),
+		Before: before,
+		Limit:  limit,
+	}
+	res, err := h.rooms.SearchMessages(c.Request.Context(), user.CurrentUserID(c), req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
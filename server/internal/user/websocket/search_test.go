@@ -0,0 +1,85 @@
+package websocket
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSearchTerms(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{"empty", "", nil},
+		{"spaces only", " \t\n", nil},
+		{"words", "  ana   poruka\tsutra ", []string{"ana", "poruka", "sutra"}},
+		{"phrase", `"dobro jutro" ana`, []string{`"dobro jutro"`, "ana"}},
+		{"phrase inside word", `a"b c"d e`, []string{`a"b c"d`, "e"}},
+		{"excluded word", "ana -ivan", []string{"ana", "-ivan"}},
+		{"excluded phrase", `ana -"dobro  jutro"`, []string{"ana", `-"dobro  jutro"`}},
+		{"unterminated quote", `ana "dobro jutro`, []string{"ana", `"dobro jutro`}},
+		{"empty quotes", `"" ana`, []string{`""`, "ana"}},
+		{"unicode", "čaša  žličica", []string{"čaša", "žličica"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := searchTerms(tt.query); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("searchTerms(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitSearchQuery(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		wantInclude string
+		wantExclude []string
+	}{
+		{"empty", "", "", nil},
+		{"words", "ana  poruka", "ana poruka", nil},
+		{"or", "ana or ivan", "ana or ivan", nil},
+		{"excluded word", "ana -ivan", "ana", []string{"ivan"}},
+		{"excluded phrase", `poruka -"dobro jutro"`, "poruka", []string{`"dobro jutro"`}},
+		{"only excluded", `-ivan -"dobro jutro"`, "", []string{"ivan", `"dobro jutro"`}},
+		{"kept phrase with dash", `"ana -ivan" sutra`, `"ana -ivan" sutra`, nil},
+		{"lone dash", "ana - ivan", "ana - ivan", nil},
+		{"dash inside word", "e-mail -spam", "e-mail", []string{"spam"}},
+		{"double dash", "--ivan", "", []string{"-ivan"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			include, exclude := splitSearchQuery(tt.query)
+			if include != tt.wantInclude || !reflect.DeepEqual(exclude, tt.wantExclude) {
+				t.Fatalf("splitSearchQuery(%q) = %q, %q, want %q, %q",
+					tt.query, include, exclude, tt.wantInclude, tt.wantExclude)
+			}
+		})
+	}
+}
+
+func TestHighlightSnippet(t *testing.T) {
+	tests := []struct {
+		name    string
+		snippet string
+		want    string
+	}{
+		{"plain", "dobro jutro", "dobro jutro"},
+		{"match", "dobro \x01jutro\x02 svima", "dobro <mark>jutro</mark> svima"},
+		{"several matches", "\x01ana\x02 i \x01ivan\x02", "<mark>ana</mark> i <mark>ivan</mark>"},
+		{"html in content", "<script>alert(1)</script>", "&lt;script&gt;alert(1)&lt;/script&gt;"},
+		{"html in match", "\x01<b>\x02 & \"x\"", "<mark>&lt;b&gt;</mark> &amp; &#34;x&#34;"},
+		{"mark in content", "<mark>lažni</mark> \x01pogodak\x02", "&lt;mark&gt;lažni&lt;/mark&gt; <mark>pogodak</mark>"},
+		{"entity in content", "&lt;b&gt;", "&amp;lt;b&amp;gt;"},
+		{"empty", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := highlightSnippet(tt.snippet); got != tt.want {
+				t.Fatalf("highlightSnippet(%q) = %q, want %q", tt.snippet, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+// Package websocket - niti (odgovori na poruke).
+// Chat poruka s "parentId" je odgovor u niti te poruke; odgovor na odgovor pripada istoj niti.
+// Odgovori se šalju cijeloj sobi kao i ostale chat poruke, a sudionici niti (autor početne poruke
+// i autori odgovora) koji su spojeni samo u drugim sobama dobivaju "thread-reply" obavijest.
+// Cijela nit dohvaća se s GET /messages/:messageID/thread.
+
+package websocket
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"server/internal/user"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// threadReplyType je vrsta obavijesti o novom odgovoru u niti.
+const threadReplyType = "thread-reply"
+
+// notifyThread javlja sudionicima niti da je klijent odgovorio u niti.
+func (client *Client) notifyThread(hub *Hub, reply *Message) {
+	if client.rooms == nil {
+		return
+	}
+	participants, err := client.rooms.GetThreadParticipants(context.Background(), reply.ParentID)
+	if err != nil {
+		log.Println("Greška pri dohvaćanju sudionika niti:", err)
+		return
+	}
+	// U sobi niti odgovor stiže kao chat poruka, pa se obavijest šalje samo vezama u drugim sobama
+	hub.sendToUsers(participants, reply.senderID, reply.RoomID, messageNotice(threadReplyType, reply))
+}
+
+// GetThread vraća nit poruke: početnu poruku i sve odgovore (GET /messages/:messageID/thread).
+func (h *Handler) GetThread(c *gin.Context) {
+	messageID, err := strconv.ParseInt(c.Param("messageID"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "neispravan ID poruke"})
+		return
+	}
+
+	res, err := h.rooms.GetThread(c.Request.Context(), user.CurrentUserID(c), messageID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
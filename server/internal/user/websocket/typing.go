@@ -0,0 +1,104 @@
+// Package websocket - indikatori tipkanja.
+// Klijent šalje "typing-start" dok tipka (i ponavlja ga kao osvježenje) te "typing-stop" kad prestane.
+// Poruke se ne spremaju i ne vraćaju se pošiljatelju, a server:
+// - prosljeđuje "typing-start" najviše jednom u typingThrottle po klijentu (i nakon typing-stop),
+// - prosljeđuje "typing-stop" samo ako je ostalima javljen typing-start, pa ni izmjenjivanje
+//   typing-start i typing-stop ne šalje sobi više od jednog para poruka u typingThrottle,
+// - sam šalje "typing-stop" ako klijent ne osvježi tipkanje unutar typingTimeout,
+// - šalje "typing-stop" kad klijent pošalje poruku ili se odspoji.
+
+package websocket
+
+import (
+	"sync"
+	"time"
+)
+
+// Vrste poruka za tipkanje.
+const (
+	typingStartType = "typing-start"
+	typingStopType  = "typing-stop"
+)
+
+const (
+	typingTimeout  = 5 * time.Second // nakon koliko vremena bez osvježenja tipkanje istječe
+	typingThrottle = 2 * time.Second // najmanji razmak između proslijeđenih typing-start poruka klijenta
+)
+
+// typingState je stanje tipkanja jednog klijenta.
+type typingState struct {
+	mu       sync.Mutex
+	active   bool        // ostalima je javljen typing-start (i još nije javljen typing-stop)
+	lastSent time.Time   // kada je zadnji typing-start proslijeđen ostalima
+	timer    *time.Timer // istek tipkanja ako klijent ne osvježi typing-start
+}
+
+// isTypingType vraća true za typing-start i typing-stop poruke.
+func isTypingType(messageType string) bool {
+	return messageType == typingStartType || messageType == typingStopType
+}
+
+// handleTyping obrađuje typing poruku klijenta i prosljeđuje je hubu ako je potrebno.
+func (client *Client) handleTyping(hub *Hub, messageType string) {
+	t := &client.typing
+	t.mu.Lock()
+	forward := false
+
+	switch messageType {
+	case typingStartType:
+		if t.timer != nil {
+			t.timer.Stop()
+		}
+		t.timer = time.AfterFunc(typingTimeout, func() { client.stopTyping(hub) })
+
+		// Ograničenje vrijedi i kad tipkanje nije aktivno, inače bi typing-stop odmah otvorio novi typing-start
+		now := time.Now()
+		if now.Sub(t.lastSent) >= typingThrottle {
+			t.active = true
+			t.lastSent = now
+			forward = true
+		}
+	case typingStopType:
+		forward = t.stop()
+	}
+	t.mu.Unlock()
+
+	if forward {
+		hub.Broadcast <- client.typingMessage(messageType)
+	}
+}
+
+// stopTyping prekida tipkanje (istek, poslana poruka ili odspajanje) i javlja to ostalima.
+func (client *Client) stopTyping(hub *Hub) {
+	client.typing.mu.Lock()
+	forward := client.typing.stop()
+	client.typing.mu.Unlock()
+
+	if forward {
+		hub.Broadcast <- client.typingMessage(typingStopType)
+	}
+}
+
+// stop poništava tipkanje i vraća je li klijent tipkao; poziva se dok je t.mu zaključan.
+func (t *typingState) stop() bool {
+	if t.timer != nil {
+		t.timer.Stop()
+		t.timer = nil
+	}
+	if !t.active {
+		return false
+	}
+	t.active = false
+	return true
+}
+
+// typingMessage gradi typing poruku klijenta za hub.
+func (client *Client) typingMessage(messageType string) *Message {
+	return &Message{
+		Type:     messageType,
+		RoomID:   client.RoomID,
+		Username: client.Username,
+		senderID: client.userID,
+		sender:   client,
+	}
+}
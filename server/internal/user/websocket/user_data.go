@@ -0,0 +1,43 @@
+// Package websocket - implementacija user.UserDataProvider sučelja za podatke koje drže hub i baza soba.
+// Koristi se za izvoz podataka korisnika (GET /me/export) i za brisanje računa (DELETE /me),
+// kada se sve aktivne WebSocket veze korisnika moraju prekinuti.
+
+package websocket
+
+import (
+	"context"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ExportUserData vraća poruke korisnika, njegova članstva u sobama (iz baze, neovisno o tome je li spojen)
+// i povijest poziva.
+func (h *Handler) ExportUserData(ctx context.Context, userID int64) (map[string]interface{}, error) {
+	return h.rooms.ExportUserData(ctx, userID)
+}
+
+// DeleteUserData anonimizira spremljene poruke korisnika.
+func (h *Handler) DeleteUserData(ctx context.Context, userID int64) error {
+	return h.rooms.DeleteUserData(ctx, userID)
+}
+
+// DisconnectUser zatvara sve WebSocket veze korisnika; ReadMessage zatim odjavljuje klijenta iz huba.
+func (h *Handler) DisconnectUser(userID int64) {
+	h.hub.mu.RLock()
+	var clients []*Client
+	for _, room := range h.hub.Rooms {
+		for _, client := range room.Clients {
+			if client.userID == userID {
+				clients = append(clients, client)
+			}
+		}
+	}
+	h.hub.mu.RUnlock()
+
+	closeMessage := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "account deleted")
+	for _, client := range clients {
+		client.Connection.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(time.Second))
+		client.Connection.Close()
+	}
+}
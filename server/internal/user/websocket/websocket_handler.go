@@ -1,15 +1,24 @@
 // Package websocket sadrži HTTP handler funkcije koje:
 // - kreiraju nove sobe,
 // - iniciraju WebSocket konekciju (JoinRoom),
-// - vraćaju listu soba i aktivnih klijenata u sobi.
+// - vraćaju listu soba i aktivnih klijenata u sobi,
+// - vraćaju povijest poruka sobe,
+// - otvaraju DM sobe i vraćaju listu DM razgovora.
 //
-// Handler koristi centralni Hub za registraciju/odjavu klijenata i pristup sobama.
+// Handler koristi centralni Hub za registraciju/odjavu klijenata i pristup sobama,
+// a Service za sobe i poruke koje se spremaju u bazu.
 
 package websocket
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"log"
 	"net/http"
+	"server/internal/user"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
@@ -17,7 +26,9 @@ import (
 
 // Handler struktura povezuje HTTP rute sa websocket hub-om.
 type Handler struct {
-	hub *Hub
+	hub   *Hub
+	users user.Service // za podatke o korisnicima (npr. avatar)
+	rooms Service      // za sobe i poruke spremljene u bazi
 }
 
 // CreateRoomReq predstavlja podatke potrebne za kreiranje sobe.
@@ -27,11 +38,25 @@ type CreateRoomReq struct {
 }
 
 // NewHandler inicijalizira novi websocket HTTP handler.
-func NewHandler(h *Hub) *Handler {
-	return &Handler{hub: h}
+func NewHandler(h *Hub, users user.Service, rooms Service) *Handler {
+	return &Handler{hub: h, users: users, rooms: rooms}
 }
 
-// CreateRoom prima JSON zahtjev i registrira novu sobu u Hubu.
+// LoadRooms učitava spremljene grupne sobe u hub (poziva se pri pokretanju aplikacije).
+// DM sobe se učitavaju tek kad netko uđe u njih.
+func (h *Handler) LoadRooms(ctx context.Context) error {
+	rooms, err := h.rooms.GetGroupRooms(ctx)
+	if err != nil {
+		return err
+	}
+	for _, room := range rooms {
+		h.hub.AddRoom(room.ID, room.Name, room.Kind, room.LastSeq)
+	}
+	log.Printf("Učitano soba: %d", len(rooms))
+	return nil
+}
+
+// CreateRoom prima JSON zahtjev, sprema novu sobu i registrira je u Hubu.
 func (h *Handler) CreateRoom(c *gin.Context) {
 	log.Println("Pozvan CreateRoom")
 	var request CreateRoomReq
@@ -39,11 +64,12 @@ func (h *Handler) CreateRoom(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	h.hub.Rooms[request.ID] = &Room{
-		ID:      request.ID,
-		Name:    request.Name,
-		Clients: make(map[string]*Client),
+	room, err := h.rooms.CreateRoom(c.Request.Context(), user.CurrentUserID(c), &request)
+	if err != nil {
+		respondError(c, err)
+		return
 	}
+	h.hub.AddRoom(room.ID, room.Name, room.Kind, room.LastSeq)
 	c.JSON(http.StatusOK, request)
 }
 
@@ -58,7 +84,44 @@ var upgrader = websocket.Upgrader{
 }
 
 // JoinRoom uspostavlja WebSocket konekciju za klijenta i registrira ga u hub.
+// Prijavljeni korisnik ulazi pod svojim ID-em i imenom iz tokena; ostali šalju samo ime (?username=)
+// i dobivaju nasumični ID "anon-..." kako se ne bi mogli predstaviti kao prijavljeni korisnik.
+// U DM sobu smiju ući samo njena dva člana.
+// Klijent koji nastavlja prekinutu sesiju šalje since=<zadnji primljeni seq> (vidi resume.go).
 func (h *Handler) JoinRoom(c *gin.Context) {
+	roomID := c.Param("roomID")
+	since, err := parseSince(c.Query("since"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID := user.CurrentUserID(c)
+	username := c.Query("username")
+	var clientID string
+	if userID != 0 {
+		clientID = strconv.FormatInt(userID, 10)
+		username = c.GetString(user.ContextUsername)
+	} else if clientID, err = anonymousClientID(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	room, err := h.rooms.GetRoom(c.Request.Context(), roomID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	allowed, err := h.rooms.CanJoin(c.Request.Context(), room, userID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if !allowed {
+		respondError(c, ErrForbidden)
+		return
+	}
+	h.hub.AddRoom(room.ID, room.Name, room.Kind, room.LastSeq)
+
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		log.Println("Greška pri WebSocket upgrade:", err)
@@ -66,51 +129,243 @@ func (h *Handler) JoinRoom(c *gin.Context) {
 		return
 	}
 
-	roomID := c.Param("roomID")
-	clientID := c.Query("userID")
-	username := c.Query("username")
+	if userID != 0 {
+		if err := h.rooms.AddMember(c.Request.Context(), roomID, userID); err != nil {
+			log.Println("Greška pri dodavanju člana sobe:", err)
+		}
+		h.loadRelations(c.Request.Context(), userID)
+	}
 
+	key, err := connectionKey()
+	if err != nil {
+		log.Println("Greška pri izradi ključa veze:", err)
+		conn.Close()
+		return
+	}
 	client := &Client{
 		Connection: conn,
-		Message:    make(chan *Message, 10),
 		ID:         clientID,
+		key:        key,
 		RoomID:     roomID,
 		Username:   username,
+		AvatarURL:  h.avatarURL(c, userID),
+		userID:     userID,
+		rooms:      h.rooms,
+		done:       make(chan struct{}),
+	}
+	if userID != 0 {
+		if profile, err := h.users.GetProfile(c.Request.Context(), userID); err == nil {
+			client.contactsOnly = profile.ContactsOnly
+			client.status = profile.Presence
+		}
 	}
 
-	// Registracija klijenta u hub
-	h.hub.Register <- client
+	// Registracija klijenta u hub: poruke spremljene nakon delivered stižu u Message kanal,
+	// a starije propuštene poruke WriteMessage šalje prije njih
+	client.Message = make(chan *Message, clientQueueSize)
+	delivered, ok := h.hub.join(client)
+	if !ok {
+		conn.Close()
+		return
+	}
+	missed := h.missedMessages(c.Request.Context(), client, since, delivered)
 
 	// Paralelne go-rutine za slanje i primanje poruka
-	go client.WriteMessage()
+	go client.WriteMessage(missed)
 	go client.ReadMessage(h.hub)
 }
 
+// clientQueueSize je veličina reda poruka klijenta; klijent čiji se red napuni se odspaja (vidi Client.deliver).
+const clientQueueSize = 64
+
+// anonymousClientIDPrefix označava ID-eve neprijavljenih klijenata; brojčani ID-evi pripadaju samo korisnicima.
+const anonymousClientIDPrefix = "anon-"
+
+// anonymousClientID vraća nasumični ID za neprijavljenog klijenta.
+func anonymousClientID() (string, error) {
+	token, err := randomHex(8)
+	if err != nil {
+		return "", err
+	}
+	return anonymousClientIDPrefix + token, nil
+}
+
+// connectionKey vraća nasumični ključ WebSocket veze u sobi (vidi Client.key).
+func connectionKey() (string, error) {
+	return randomHex(8)
+}
+
+// randomHex vraća n nasumičnih bajtova kao heksadecimalni zapis.
+func randomHex(n int) (string, error) {
+	token := make([]byte, n)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(token), nil
+}
+
+// loadRelations učitava blokade i kontakte korisnika u hub kako bi hub mogao filtrirati poruke.
+func (h *Handler) loadRelations(ctx context.Context, userID int64) {
+	blocked, err := h.users.GetBlockRelations(ctx, userID)
+	if err != nil {
+		log.Println("Greška pri dohvaćanju blokada:", err)
+	}
+	for _, id := range blocked {
+		h.hub.SetBlocked(userID, id, true)
+	}
+
+	contacts, err := h.users.GetContactIDs(ctx, userID)
+	if err != nil {
+		log.Println("Greška pri dohvaćanju kontakata:", err)
+	}
+	for _, id := range contacts {
+		h.hub.SetContact(userID, id, true)
+	}
+}
+
+// ContactChanged ažurira kontakte u hubu (implementira user.ContactListener).
+func (h *Handler) ContactChanged(userA, userB int64, contacts bool) {
+	h.hub.SetContact(userA, userB, contacts)
+}
+
+// Presence javlja trenutnu prisutnost korisnika (implementira user.PresenceProvider).
+func (h *Handler) Presence(userID int64) string {
+	return h.hub.Presence(userID)
+}
+
+// SetPresence sprema ručno postavljen status prisutnosti (PUT /me/presence)
+// i odmah ga javlja kontaktima i članovima soba ako je korisnik spojen.
+func (h *Handler) SetPresence(c *gin.Context) {
+	var req user.SetPresenceReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := user.CurrentUserID(c)
+	if err := h.users.SetPresenceStatus(c.Request.Context(), userID, req.Status); err != nil {
+		respondError(c, err)
+		return
+	}
+	h.hub.SetStatus(userID, req.Status)
+	c.JSON(http.StatusOK, gin.H{"status": req.Status})
+}
+
+// BlockChanged ažurira blokade u hubu (implementira user.BlockListener).
+// Nakon odblokiranja par ostaje blokiran ako je i drugi korisnik blokirao prvoga.
+func (h *Handler) BlockChanged(blockerID, blockedID int64, blocked bool) {
+	if !blocked {
+		stillBlocked, err := h.users.IsBlocked(context.Background(), blockerID, blockedID)
+		if err != nil {
+			log.Println("Greška pri provjeri blokade:", err)
+			return
+		}
+		blocked = stillBlocked
+	}
+	h.hub.SetBlocked(blockerID, blockedID, blocked)
+}
+
+// avatarURL dohvaća URL avatara korisnika; ako korisnik ne postoji ili nema avatar, vraća "".
+func (h *Handler) avatarURL(c *gin.Context, userID int64) string {
+	if userID == 0 {
+		return ""
+	}
+	profile, err := h.users.GetPublicProfile(c.Request.Context(), userID)
+	if err != nil {
+		return ""
+	}
+	return profile.AvatarURL
+}
+
 // RoomRes predstavlja strukturu za ispis soba (GET /rooms).
 type RoomRes struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	UnreadCount int    `json:"unreadCount"` // 0 za neprijavljene i sobe u kojima korisnik nije član
 }
 
-// GetRooms vraća sve registrirane sobe u hubu.
+// GetRooms vraća sve grupne sobe registrirane u hubu (DM sobe su na GET /dm),
+// uz broj nepročitanih poruka za prijavljenog korisnika.
 func (h *Handler) GetRooms(c *gin.Context) {
+	unread := map[string]int{}
+	if userID := user.CurrentUserID(c); userID != 0 {
+		counts, err := h.rooms.GetUnreadCounts(c.Request.Context(), userID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		unread = counts
+	}
+
 	rooms := make([]RoomRes, 0)
+	h.hub.mu.RLock()
 	for _, room := range h.hub.Rooms {
+		if room.Kind == RoomKindDirect {
+			continue
+		}
 		rooms = append(rooms, RoomRes{
-			ID:   room.ID,
-			Name: room.Name,
+			ID:          room.ID,
+			Name:        room.Name,
+			UnreadCount: unread[room.ID],
 		})
 	}
+	h.hub.mu.RUnlock()
 	c.JSON(http.StatusOK, rooms)
 }
 
+// GetMessages vraća povijest poruka sobe sa zbrojem reakcija (GET /rooms/:roomID/messages).
+// Stranice se čitaju unatrag: ?before=<seq> (bez njega od najnovije poruke) i ?limit=.
+func (h *Handler) GetMessages(c *gin.Context) {
+	before, _ := strconv.ParseInt(c.Query("before"), 10, 64)
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	res, err := h.rooms.GetMessages(c.Request.Context(), c.Param("roomID"), user.CurrentUserID(c), before, limit)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// MarkRoomRead pomiče oznaku pročitanosti prijavljenog korisnika (POST /rooms/:roomID/read)
+// i javlja je ostalim članovima sobe.
+func (h *Handler) MarkRoomRead(c *gin.Context) {
+	var req MarkReadReq
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	roomID := c.Param("roomID")
+	userID := user.CurrentUserID(c)
+	var lastRead int64
+	err := h.hub.publishSaved(roomID, func() (*Message, error) {
+		var seq int64
+		var err error
+		lastRead, seq, err = h.rooms.MarkRoomRead(c.Request.Context(), roomID, userID, req.MessageID)
+		if err != nil || seq == 0 {
+			return nil, err
+		}
+		return readMarker(roomID, c.GetString(user.ContextUsername), userID, lastRead, seq), nil
+	})
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, MarkReadRes{RoomID: roomID, LastReadMessageID: lastRead})
+}
+
 // ClientRes predstavlja prikaz klijenata u sobi.
 type ClientRes struct {
-	ID       string `json:"id"`
-	Username string `json:"username"`
+	ID        string `json:"id"`
+	Username  string `json:"username"`
+	AvatarURL string `json:"avatarUrl,omitempty"`
 }
 
 // GetClients vraća sve klijente registrirane u odabranoj sobi.
+// Korisnik spojen s više veza (npr. s više uređaja) navodi se jednom.
 func (h *Handler) GetClients(c *gin.Context) {
 	roomID := c.Param("roomID")
 
@@ -122,13 +377,79 @@ func (h *Handler) GetClients(c *gin.Context) {
 		c.JSON(http.StatusOK, []ClientRes{})
 		return
 	}
+	if room.Kind == RoomKindDirect {
+		allowed, err := h.rooms.CanJoin(c.Request.Context(), &StoredRoom{ID: room.ID, Kind: room.Kind}, user.CurrentUserID(c))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		if !allowed {
+			respondError(c, ErrForbidden)
+			return
+		}
+	}
 
+	h.hub.mu.RLock()
+	defer h.hub.mu.RUnlock()
 	clients := make([]ClientRes, 0, len(room.Clients))
+	listed := make(map[string]bool, len(room.Clients))
 	for _, cl := range room.Clients {
+		if listed[cl.ID] {
+			continue
+		}
+		listed[cl.ID] = true
 		clients = append(clients, ClientRes{
-			ID:       cl.ID,
-			Username: cl.Username,
+			ID:        cl.ID,
+			Username:  cl.Username,
+			AvatarURL: cl.AvatarURL,
 		})
 	}
 	c.JSON(http.StatusOK, clients)
 }
+
+// OpenDirectRoom vraća (i po potrebi kreira) DM sobu s korisnikom :userID.
+// U sobu se zatim ulazi istim JoinRoom endpointom kao i u grupne sobe.
+func (h *Handler) OpenDirectRoom(c *gin.Context) {
+	peerID, err := strconv.ParseInt(c.Param("userID"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "neispravan ID korisnika"})
+		return
+	}
+
+	res, err := h.rooms.OpenDirectRoom(c.Request.Context(), user.CurrentUserID(c), peerID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	// Seq sobe hub preuzima iz baze kad netko uđe u sobu (JoinRoom)
+	h.hub.AddRoom(res.RoomID, "", RoomKindDirect, 0)
+	c.JSON(http.StatusOK, res)
+}
+
+// GetDirectConversations vraća DM razgovore prijavljenog korisnika.
+func (h *Handler) GetDirectConversations(c *gin.Context) {
+	res, err := h.rooms.GetDirectConversations(c.Request.Context(), user.CurrentUserID(c))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// respondError mapira greške servisa na HTTP statuse (422, 403, 404, inače 500).
+func respondError(c *gin.Context, err error) {
+	var validation *user.ValidationError
+	var conflict *user.ConflictError
+	switch {
+	case errors.As(err, &validation):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": validation.Error(), "fields": validation.Fields})
+	case errors.As(err, &conflict):
+		c.JSON(http.StatusConflict, gin.H{"error": conflict.Error(), "fields": []user.FieldError{conflict.FieldError}})
+	case errors.Is(err, ErrForbidden), errors.Is(err, ErrAttachmentLink), errors.Is(err, user.ErrBlocked), errors.Is(err, user.ErrContactsOnly):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrRoomNotFound), errors.Is(err, ErrMessageNotFound), errors.Is(err, ErrAttachmentNotFound), errors.Is(err, user.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
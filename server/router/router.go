@@ -1,13 +1,15 @@
 // Package router inicijalizira i pokreće HTTP server koristeći Gin framework.
-// Ovdje se definiraju rute za korisničke zahtjeve (signup, login, logout) i WebSocket funkcionalnosti (sobe, klijenti).
+// Ovdje se definiraju rute za korisničke zahtjeve (signup, login, logout, SSO) i WebSocket funkcionalnosti (sobe, klijenti).
 // Također postavlja CORS pravila za komunikaciju s frontendom (npr. localhost:3000).
 
 package router
 
 import (
 	"log"
+	"os"
 	"server/internal/user"
 	"server/internal/user/websocket"
+	"strings"
 	"time"
 
 	"github.com/gin-contrib/cors"
@@ -17,14 +19,21 @@ import (
 var route *gin.Engine
 
 // InitRouter konfigurira sve rute aplikacije i postavlja CORS middleware.
-func InitRouter(userHandler *user.Handler, webSocketHandler *websocket.Handler) {
+// mediaDir je direktorij lokalnog spremišta koji se poslužuje pod /media.
+func InitRouter(userHandler *user.Handler, oidcHandler *user.OIDCHandler, webSocketHandler *websocket.Handler, mediaDir string) {
 	route = gin.Default()
 
+	// ClientIP (limit prijava po IP adresi) čita X-Forwarded-For samo od navedenih proxyja;
+	// bez TRUSTED_PROXIES koristi se adresa TCP veze pa klijent ne može lažirati svoju IP adresu
+	if err := route.SetTrustedProxies(trustedProxies()); err != nil {
+		log.Fatalf("Neispravan TRUSTED_PROXIES: %v", err)
+	}
+
 	// CORS omogućava pristup frontend aplikaciji na drugom portu (npr. localhost:3000)
 	route.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:3000"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
@@ -33,12 +42,87 @@ func InitRouter(userHandler *user.Handler, webSocketHandler *websocket.Handler)
 	route.POST("/signup", userHandler.CreateUser)
 	route.POST("/login", userHandler.Login)
 	route.GET("/logout", userHandler.Logout)
+	route.POST("/login/2fa", userHandler.VerifyLoginTOTP)
+
+	// SSO prijava putem OpenID Connecta
+	route.GET("/auth/oidc/:provider/login", oidcHandler.Login)
+	route.GET("/auth/oidc/:provider/callback", oidcHandler.Callback)
+
+	// Rute za prijavljenog korisnika
+	me := route.Group("/me", userHandler.Authenticate)
+	me.GET("", userHandler.GetProfile)
+	me.PATCH("", userHandler.UpdateProfile)
+	me.DELETE("", userHandler.DeleteAccount)
+	me.GET("/export", userHandler.ExportData)
+	me.POST("/password", userHandler.ChangePassword)
+	me.PUT("/avatar", userHandler.UploadAvatar)
+	me.POST("/2fa/totp", userHandler.EnrollTOTP)
+	me.POST("/2fa/totp/confirm", userHandler.ConfirmTOTP)
+	me.POST("/blocks/:userID", userHandler.BlockUser)
+	me.DELETE("/blocks/:userID", userHandler.UnblockUser)
+	me.GET("/contacts", userHandler.GetContacts)
+	me.DELETE("/contacts/:userID", userHandler.RemoveContact)
+	me.GET("/contacts/requests", userHandler.GetContactRequests)
+	me.POST("/contacts/requests/:userID", userHandler.SendContactRequest)
+	me.POST("/contacts/requests/:userID/accept", userHandler.AcceptContactRequest)
+	me.DELETE("/contacts/requests/:userID", userHandler.DeleteContactRequest)
+	me.PUT("/presence", webSocketHandler.SetPresence)
+	me.GET("/mentions", webSocketHandler.GetMentions)
+
+	route.GET("/users/available", userHandler.CheckUsernameAvailability)
+	users := route.Group("/users", userHandler.Authenticate)
+	users.GET("/search", userHandler.SearchUsers)
+	users.GET("/:id", userHandler.GetPublicProfile)
+
+	// Statične datoteke iz lokalnog spremišta (avatari)
+	route.Static("/media", mediaDir)
+
+	// Direktne poruke (DM) — u sobu se ulazi kroz /websocket/joinRoom/:roomID
+	dm := route.Group("/dm", userHandler.Authenticate)
+	dm.GET("", webSocketHandler.GetDirectConversations)
+	dm.POST("/:userID", webSocketHandler.OpenDirectRoom)
+
+	// Povijest poruka, oznake pročitanosti, uređivanje i brisanje, prikvačivanje poruka i upload privitaka
+	rooms := route.Group("/rooms", userHandler.Authenticate)
+	rooms.GET("/:roomID/messages", webSocketHandler.GetMessages)
+	rooms.POST("/:roomID/read", webSocketHandler.MarkRoomRead)
+	rooms.PATCH("/:roomID/messages/:messageID", webSocketHandler.EditMessage)
+	rooms.DELETE("/:roomID/messages/:messageID", webSocketHandler.DeleteMessage)
+	rooms.GET("/:roomID/pins", webSocketHandler.GetPins)
+	rooms.POST("/:roomID/pins/:messageID", webSocketHandler.PinMessage)
+	rooms.DELETE("/:roomID/pins/:messageID", webSocketHandler.UnpinMessage)
+	rooms.POST("/:roomID/attachments", webSocketHandler.UploadAttachment)
+
+	// Preuzimanje privitaka potpisanim linkom (bez prijave, vidi websocket.Service.SignAttachments)
+	route.GET("/attachments/:attachmentID", webSocketHandler.DownloadAttachment)
+
+	// Niti poruka
+	messages := route.Group("/messages", userHandler.Authenticate)
+	messages.GET("/:messageID/thread", webSocketHandler.GetThread)
+
+	// Pretraga poruka
+	search := route.Group("/search", userHandler.Authenticate)
+	search.GET("/messages", webSocketHandler.SearchMessages)
+
+	// Kreiranje sobe zahtijeva prijavu jer autor postaje moderator sobe
+	route.POST("/websocket/createRoom", userHandler.Authenticate, webSocketHandler.CreateRoom)
+
+	// WebSocket rute za sobe i klijente (token nije obavezan, ali je potreban za DM sobe)
+	ws := route.Group("/websocket", userHandler.OptionalAuthenticate)
+	ws.GET("/joinRoom/:roomID", webSocketHandler.JoinRoom)
+	ws.GET("/getRooms", webSocketHandler.GetRooms)
+	ws.GET("/getClients/:roomID", webSocketHandler.GetClients)
+}
 
-	// WebSocket rute za sobe i klijente
-	route.POST("/websocket/createRoom", webSocketHandler.CreateRoom)
-	route.GET("/websocket/joinRoom/:roomID", webSocketHandler.JoinRoom)
-	route.GET("/websocket/getRooms", webSocketHandler.GetRooms)
-	route.GET("/websocket/getClients/:roomID", webSocketHandler.GetClients)
+// trustedProxies vraća listu IP adresa ili CIDR raspona iz TRUSTED_PROXIES (odvojenih zarezom).
+func trustedProxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
 }
 
 // Start pokreće HTTP server na zadanoj adresi (npr. "0.0.0.0:8080").
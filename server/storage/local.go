@@ -0,0 +1,99 @@
+// Package storage - implementacija Storage sučelja nad lokalnim direktorijem.
+// Objekti se spremaju kao obične datoteke, a URL se gradi od baseURL-a
+// (router ih poslužuje kao statične datoteke).
+
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LocalStorage sprema objekte u direktorij na disku.
+type LocalStorage struct {
+	dir     string
+	baseURL string
+}
+
+// NewLocalStorage vraća LocalStorage nad direktorijem dir (kreira ga ako ne postoji).
+// baseURL je prefiks pod kojim se objekti poslužuju (npr. "/media").
+func NewLocalStorage(dir, baseURL string) (*LocalStorage, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+	return &LocalStorage{dir: dir, baseURL: strings.TrimSuffix(baseURL, "/")}, nil
+}
+
+// Dir vraća korijenski direktorij spremišta.
+func (s *LocalStorage) Dir() string {
+	return s.dir
+}
+
+// path pretvara ključ u putanju na disku i sprječava izlazak iz korijenskog direktorija.
+func (s *LocalStorage) path(key string) (string, error) {
+	clean := filepath.Clean("/" + key)
+	if clean == "/" {
+		return "", fmt.Errorf("invalid storage key %q", key)
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(clean)), nil
+}
+
+// Put sprema sadržaj u privremenu datoteku pa je atomarno preimenuje.
+func (s *LocalStorage) Put(ctx context.Context, key string, content io.Reader, contentType string) error {
+	target, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), target)
+}
+
+// Get otvara datoteku objekta.
+func (s *LocalStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	target, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(target)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return file, err
+}
+
+// Delete briše datoteku objekta.
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	target, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// URL vraća URL pod kojim router poslužuje objekt.
+func (s *LocalStorage) URL(key string) string {
+	return s.baseURL + "/" + strings.TrimPrefix(key, "/")
+}
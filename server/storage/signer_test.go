@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// signedQuery potpisuje putanju path s parametrima query i vraća parametre potpisanog URL-a.
+func signedQuery(t *testing.T, s *URLSigner, path string, query url.Values) url.Values {
+	t.Helper()
+	signed, err := url.Parse(s.Sign(path, query))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signed.Path != path {
+		t.Fatalf("signed path = %q, want %q", signed.Path, path)
+	}
+	return signed.Query()
+}
+
+func TestURLSignerVerify(t *testing.T) {
+	signer := NewURLSigner("http://localhost:8080/", []byte("tajna"), time.Hour)
+	const path = "/attachments/42"
+	original := func(t *testing.T) url.Values {
+		return signedQuery(t, signer, path, url.Values{"user": {"7"}})
+	}
+	thumbnail := func(t *testing.T) url.Values {
+		return signedQuery(t, signer, path, url.Values{"user": {"7"}, "variant": {"thumbnail"}})
+	}
+
+	tests := []struct {
+		name  string
+		path  string
+		query func(t *testing.T) url.Values
+		want  error
+	}{
+		{"valid", path, original, nil},
+		{"valid thumbnail", path, thumbnail, nil},
+		{"reordered parameters", path, func(t *testing.T) url.Values {
+			// Redoslijed parametara u URL-u ne smije utjecati na potpis
+			q := original(t)
+			reordered, err := url.ParseQuery("sig=" + q.Get("sig") + "&user=7&expires=" + q.Get("expires"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return reordered
+		}, nil},
+		{"other path", "/attachments/43", original, ErrInvalidSignature},
+		{"tampered user", path, func(t *testing.T) url.Values {
+			q := original(t)
+			q.Set("user", "8")
+			return q
+		}, ErrInvalidSignature},
+		{"added parameter", path, func(t *testing.T) url.Values {
+			q := original(t)
+			q.Add("user", "8")
+			return q
+		}, ErrInvalidSignature},
+		{"extended expiry", path, func(t *testing.T) url.Values {
+			q := original(t)
+			q.Set("expires", "99999999999")
+			return q
+		}, ErrInvalidSignature},
+		{"variant added to original", path, func(t *testing.T) url.Values {
+			q := original(t)
+			q.Set("variant", "thumbnail")
+			return q
+		}, ErrInvalidSignature},
+		{"variant removed from thumbnail", path, func(t *testing.T) url.Values {
+			q := thumbnail(t)
+			q.Del("variant")
+			return q
+		}, ErrInvalidSignature},
+		{"thumbnail signature on original", path, func(t *testing.T) url.Values {
+			q := original(t)
+			q.Set("sig", thumbnail(t).Get("sig"))
+			return q
+		}, ErrInvalidSignature},
+		{"missing signature", path, func(t *testing.T) url.Values {
+			q := original(t)
+			q.Del("sig")
+			return q
+		}, ErrInvalidSignature},
+		{"malformed signature", path, func(t *testing.T) url.Values {
+			q := original(t)
+			q.Set("sig", "!"+q.Get("sig"))
+			return q
+		}, ErrInvalidSignature},
+		{"other secret", path, func(t *testing.T) url.Values {
+			other := NewURLSigner("http://localhost:8080", []byte("druga tajna"), time.Hour)
+			return signedQuery(t, other, path, url.Values{"user": {"7"}})
+		}, ErrInvalidSignature},
+		{"expired", path, func(t *testing.T) url.Values {
+			expired := NewURLSigner("http://localhost:8080", []byte("tajna"), -time.Minute)
+			return signedQuery(t, expired, path, url.Values{"user": {"7"}})
+		}, ErrURLExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := signer.Verify(tt.path, tt.query(t)); !errors.Is(err, tt.want) {
+				t.Fatalf("Verify = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestURLSignerSignKeepsQuery(t *testing.T) {
+	signer := NewURLSigner("http://localhost:8080/", []byte("tajna"), time.Hour)
+	query := url.Values{"user": {"7"}}
+
+	signed := signer.Sign("/attachments/42", query)
+	if !strings.HasPrefix(signed, "http://localhost:8080/attachments/42?") {
+		t.Fatalf("Sign = %q, want URL on base URL without double slash", signed)
+	}
+	// Sign ne smije mijenjati parametre pozivatelja (SignAttachments ih ponovno koristi za sličicu)
+	if len(query) != 1 || query.Get("user") != "7" {
+		t.Fatalf("Sign modified query: %v", query)
+	}
+}
@@ -0,0 +1,26 @@
+// Package storage definira sučelje za spremanje binarnih datoteka (avatari, privici)
+// i zadanu implementaciju na lokalnom datotečnom sustavu.
+// Ostale implementacije (npr. S3) trebaju samo zadovoljiti Storage sučelje.
+
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrNotFound vraća se kad traženi objekt ne postoji.
+var ErrNotFound = errors.New("object not found")
+
+// Storage je apstrakcija nad spremištem binarnih objekata adresiranih ključem (npr. "avatars/12/abc-128.png").
+type Storage interface {
+	// Put sprema sadržaj pod zadanim ključem (postojeći objekt se prepisuje).
+	Put(ctx context.Context, key string, content io.Reader, contentType string) error
+	// Get otvara objekt za čitanje; pozivatelj mora zatvoriti ReadCloser.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete briše objekt; brisanje nepostojećeg objekta nije greška.
+	Delete(ctx context.Context, key string) error
+	// URL vraća javni URL objekta.
+	URL(key string) string
+}
@@ -0,0 +1,92 @@
+// Package util - pomoćne funkcije za obradu slika (avatari, sličice privitaka).
+// Podržani ulazni formati su JPEG, PNG, WebP i GIF (samo prvi kadar); format se prepoznaje iz sadržaja, ne iz imena datoteke.
+
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif"  // registracija GIF dekodera (sličice privitaka)
+	_ "image/jpeg" // registracija JPEG dekodera
+	"image/png"
+	"io"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // registracija WebP dekodera
+)
+
+// MaxImagePixels ograničava dimenzije slike prije dekodiranja (zaštita od "decompression bomb" slika).
+const MaxImagePixels = 40_000_000
+
+// DecodeImage dekodira sliku i vraća je zajedno s prepoznatim formatom ("jpeg", "png", "webp").
+// Slika se odbija ako format nije u allowed ili ako je prevelika.
+func DecodeImage(data []byte, allowed ...string) (image.Image, string, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("unsupported image: %w", err)
+	}
+	if !contains(allowed, format) {
+		return nil, "", fmt.Errorf("unsupported image format %q", format)
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > MaxImagePixels {
+		return nil, "", fmt.Errorf("image dimensions %dx%d are not allowed", config.Width, config.Height)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode image: %w", err)
+	}
+	return img, format, nil
+}
+
+// SquareThumbnail izrezuje centralni kvadrat slike i skalira ga na size×size piksela.
+func SquareThumbnail(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	side := bounds.Dx()
+	if bounds.Dy() < side {
+		side = bounds.Dy()
+	}
+	x0 := bounds.Min.X + (bounds.Dx()-side)/2
+	y0 := bounds.Min.Y + (bounds.Dy()-side)/2
+	crop := image.Rect(x0, y0, x0+side, y0+side)
+
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, crop, draw.Src, nil)
+	return dst
+}
+
+// FitThumbnail smanjuje sliku tako da stane u maxSize×maxSize piksela uz očuvan omjer stranica.
+// Manje slike se ne povećavaju.
+func FitThumbnail(img image.Image, maxSize int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > maxSize || height > maxSize {
+		if width >= height {
+			height = max(1, height*maxSize/width)
+			width = maxSize
+		} else {
+			width = max(1, width*maxSize/height)
+			height = maxSize
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+	return dst
+}
+
+// EncodePNG zapisuje sliku kao PNG.
+func EncodePNG(w io.Writer, img image.Image) error {
+	return png.Encode(w, img)
+}
+
+// contains provjerava nalazi li se vrijednost u listi.
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -1,27 +1,151 @@
 // Package util sadrži pomoćne funkcije za sigurnosne operacije poput hashiranja lozinke.
-// Ovdje se koristi bcrypt za:
+// Ovdje se koristi argon2id (PHC string format) za:
 // - hashiranje lozinki prilikom registracije,
 // - usporedbu unesene i spremljene lozinke prilikom prijave.
+//
+// Stari bcrypt hashevi se i dalje provjeravaju, a NeedsRehash javlja kad hash treba
+// ponovno izračunati (bcrypt ili zastarjeli argon2id parametri).
 
 package util
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"strings"
 
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
 )
 
-// HashPassword prima lozinku i vraća njen bcrypt hash.
+// ErrPasswordMismatch vraća CheckPassword kad lozinka ne odgovara hashu.
+var ErrPasswordMismatch = errors.New("password does not match")
+
+// Argon2Params su parametri argon2id algoritma.
+type Argon2Params struct {
+	Memory      uint32 // memorija u KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2Params slijede OWASP preporuke za argon2id.
+var DefaultArgon2Params = Argon2Params{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// argon2Params su parametri kojima se hashiraju nove lozinke.
+var argon2Params = DefaultArgon2Params
+
+// SetArgon2Params mijenja parametre za nove hasheve. Postojeći hashevi s drugim
+// parametrima i dalje se mogu provjeriti, a NeedsRehash za njih vraća true.
+func SetArgon2Params(p Argon2Params) {
+	argon2Params = p
+}
+
+// Argon2ParamsFromEnv čita parametre iz .env varijabli
+// (ARGON2_MEMORY_KIB, ARGON2_ITERATIONS, ARGON2_PARALLELISM), uz zadane vrijednosti.
+func Argon2ParamsFromEnv() Argon2Params {
+	p := DefaultArgon2Params
+	if v := envInt("ARGON2_MEMORY_KIB", 0); v > 0 {
+		p.Memory = uint32(v)
+	}
+	if v := envInt("ARGON2_ITERATIONS", 0); v > 0 {
+		p.Iterations = uint32(v)
+	}
+	if v := envInt("ARGON2_PARALLELISM", 0); v > 0 && v < 256 {
+		p.Parallelism = uint8(v)
+	}
+	return p
+}
+
+// HashPassword prima lozinku i vraća njen argon2id hash u PHC formatu:
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
 func HashPassword(password string) (string, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
+	p := argon2Params
+	salt := make([]byte, p.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
 		return "", fmt.Errorf("failed to hash password: %w", err)
 	}
-	return string(hashedPassword), nil
+
+	key := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
 }
 
-// CheckPassword uspoređuje plaintext lozinku s hashiranom verzijom.
+// CheckPassword uspoređuje plaintext lozinku s hashiranom verzijom (argon2id ili bcrypt).
 // Vraća nil ako su podudarne, grešku ako nisu.
 func CheckPassword(password string, hashedPassword string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+	if !strings.HasPrefix(hashedPassword, "$argon2id$") {
+		return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+	}
+
+	p, salt, key, err := decodeArgon2Hash(hashedPassword)
+	if err != nil {
+		return err
+	}
+	candidate := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, uint32(len(key)))
+	if subtle.ConstantTimeCompare(candidate, key) != 1 {
+		return ErrPasswordMismatch
+	}
+	return nil
+}
+
+// NeedsRehash vraća true ako hash nije argon2id s trenutnim parametrima.
+func NeedsRehash(hashedPassword string) bool {
+	if !strings.HasPrefix(hashedPassword, "$argon2id$") {
+		return true
+	}
+	p, salt, key, err := decodeArgon2Hash(hashedPassword)
+	if err != nil {
+		return true
+	}
+	current := argon2Params
+	return p.Memory != current.Memory ||
+		p.Iterations != current.Iterations ||
+		p.Parallelism != current.Parallelism ||
+		uint32(len(salt)) != current.SaltLength ||
+		uint32(len(key)) != current.KeyLength
+}
+
+// decodeArgon2Hash rastavlja PHC string na parametre, sol i izvedeni ključ.
+func decodeArgon2Hash(encoded string) (Argon2Params, []byte, []byte, error) {
+	var p Argon2Params
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return p, nil, nil, fmt.Errorf("invalid argon2id hash format")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return p, nil, nil, fmt.Errorf("invalid argon2id version: %w", err)
+	}
+	if version != argon2.Version {
+		return p, nil, nil, fmt.Errorf("unsupported argon2id version %d", version)
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return p, nil, nil, fmt.Errorf("invalid argon2id parameters: %w", err)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, fmt.Errorf("invalid argon2id salt: %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return p, nil, nil, fmt.Errorf("invalid argon2id key: %w", err)
+	}
+	p.SaltLength = uint32(len(salt))
+	p.KeyLength = uint32(len(key))
+	return p, salt, key, nil
 }
@@ -0,0 +1,182 @@
+// Package util - politika lozinki i provjera lozinki procurjelih u poznatim curenjima podataka.
+// Ovdje se nalazi:
+// - PasswordPolicy s minimalnom duljinom, klasama znakova i gornjom granicom od 72 bajta (bcrypt),
+// - odbijanje lozinki koje sadrže korisničko ime ili email,
+// - BreachedList koja po k-anonymity modelu (prvih 5 znakova SHA-1 hasha) čita lokalnu listu.
+
+package util
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// bcryptMaxBytes je maksimalna duljina lozinke koju bcrypt uzima u obzir — ostatak se tiho odbacuje.
+const bcryptMaxBytes = 72
+
+// PasswordViolation opisuje jedno kršenje politike lozinki.
+type PasswordViolation struct {
+	Code    string `json:"code"`    // strojno čitljiv kod, npr. "too_short"
+	Message string `json:"message"` // poruka za korisnika
+}
+
+// PasswordPolicy definira pravila koja lozinka mora zadovoljiti.
+type PasswordPolicy struct {
+	MinLength  int          // minimalan broj znakova
+	MaxBytes   int          // maksimalan broj bajtova (najviše 72 zbog bcrypta)
+	MinClasses int          // koliko različitih klasa znakova (mala, velika, znamenka, simbol) mora sadržavati
+	Breached   BreachedList // lista procurjelih lozinki (nil = ne provjerava se)
+}
+
+// NewPasswordPolicyFromEnv čita politiku iz .env varijabli
+// (PASSWORD_MIN_LENGTH, PASSWORD_MAX_BYTES, PASSWORD_MIN_CLASSES, BREACHED_PASSWORDS_PATH).
+func NewPasswordPolicyFromEnv() PasswordPolicy {
+	policy := PasswordPolicy{
+		MinLength:  envInt("PASSWORD_MIN_LENGTH", 10),
+		MaxBytes:   envInt("PASSWORD_MAX_BYTES", bcryptMaxBytes),
+		MinClasses: envInt("PASSWORD_MIN_CLASSES", 3),
+	}
+	if policy.MaxBytes <= 0 || policy.MaxBytes > bcryptMaxBytes {
+		policy.MaxBytes = bcryptMaxBytes
+	}
+	if path := os.Getenv("BREACHED_PASSWORDS_PATH"); path != "" {
+		policy.Breached = NewBreachedList(path)
+	}
+	return policy
+}
+
+// envInt čita cijeli broj iz .env varijable ili vraća zadanu vrijednost.
+func envInt(name string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(name))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// Validate provjerava lozinku i vraća sva kršenja politike (prazno ako je lozinka u redu).
+// personal su podaci korisnika (username, email) koje lozinka ne smije sadržavati.
+func (p PasswordPolicy) Validate(password string, personal ...string) ([]PasswordViolation, error) {
+	var violations []PasswordViolation
+
+	if utf8.RuneCountInString(password) < p.MinLength {
+		violations = append(violations, PasswordViolation{
+			Code:    "too_short",
+			Message: fmt.Sprintf("lozinka mora imati barem %d znakova", p.MinLength),
+		})
+	}
+	if len(password) > p.MaxBytes {
+		violations = append(violations, PasswordViolation{
+			Code:    "too_long",
+			Message: fmt.Sprintf("lozinka smije imati najviše %d bajtova", p.MaxBytes),
+		})
+	}
+	if classes := characterClasses(password); classes < p.MinClasses {
+		violations = append(violations, PasswordViolation{
+			Code:    "too_simple",
+			Message: fmt.Sprintf("lozinka mora sadržavati barem %d od: mala slova, velika slova, znamenke, simboli", p.MinClasses),
+		})
+	}
+
+	lower := strings.ToLower(password)
+	for _, value := range personal {
+		value = strings.ToLower(strings.TrimSpace(value))
+		if local, _, found := strings.Cut(value, "@"); found {
+			value = local
+		}
+		if len(value) >= 3 && strings.Contains(lower, value) {
+			violations = append(violations, PasswordViolation{
+				Code:    "contains_personal_info",
+				Message: "lozinka ne smije sadržavati korisničko ime ili email",
+			})
+			break
+		}
+	}
+
+	if p.Breached != nil && password != "" {
+		breached, err := p.Breached.Contains(password)
+		if err != nil {
+			return nil, err
+		}
+		if breached {
+			violations = append(violations, PasswordViolation{
+				Code:    "breached",
+				Message: "lozinka se pojavila u poznatom curenju podataka, odaberite drugu",
+			})
+		}
+	}
+
+	return violations, nil
+}
+
+// characterClasses vraća broj različitih klasa znakova u lozinci.
+func characterClasses(password string) int {
+	var lower, upper, digit, symbol int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+	return lower + upper + digit + symbol
+}
+
+// BreachedList provjerava nalazi li se lozinka na listi procurjelih lozinki.
+type BreachedList interface {
+	Contains(password string) (bool, error)
+}
+
+// rangeBreachedList čita lokalnu listu u formatu "Pwned Passwords" range datoteka:
+// direktorij s datotekom po prefiksu (npr. "5BAA6" ili "5BAA6.txt"),
+// u kojoj je svaki redak "SUFIKS:BROJ" (preostalih 35 heksadecimalnih znakova SHA-1 hasha).
+// Pretražuje se samo datoteka s 5-znakovnim prefiksom, pa se cijela lista nikad ne učitava.
+type rangeBreachedList struct {
+	dir string
+}
+
+// NewBreachedList vraća BreachedList nad direktorijem range datoteka.
+func NewBreachedList(dir string) BreachedList {
+	return &rangeBreachedList{dir: dir}
+}
+
+// Contains vraća true ako se SHA-1 hash lozinke nalazi u pripadajućoj range datoteci.
+func (l *rangeBreachedList) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	file, err := os.Open(filepath.Join(l.dir, prefix))
+	if os.IsNotExist(err) {
+		file, err = os.Open(filepath.Join(l.dir, prefix+".txt"))
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to open breached password range: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if strings.EqualFold(line, suffix) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
@@ -0,0 +1,164 @@
+// Package util - TOTP (RFC 6238) pomoćne funkcije za dvofaktorsku autentikaciju.
+// Ovdje se nalazi:
+// - generiranje tajnog ključa i otpauth URI-ja za aplikacije poput Google Authenticatora,
+// - validacija 6-znamenkastog koda uz toleranciju od jednog vremenskog koraka
+//   (MatchTOTP vraća i korak koda kako bi se isti kod mogao odbiti pri ponovnom korištenju),
+// - generiranje jednokratnih recovery kodova i njihovo hashiranje.
+
+package util
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	totpPeriod = 30 // trajanje jednog koraka u sekundama
+	totpDigits = 6  // broj znamenki koda
+	totpSkew   = 1  // dozvoljeno odstupanje (u koracima) zbog neusklađenih satova
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret vraća novi nasumični base32 tajni ključ (160 bita).
+func GenerateTOTPSecret() (string, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate totp secret: %w", err)
+	}
+	return totpEncoding.EncodeToString(secret), nil
+}
+
+// TOTPURI gradi otpauth:// URI koji se prikazuje kao QR kod u autentikatorskoj aplikaciji.
+func TOTPURI(issuer, account, secret string) string {
+	label := url.PathEscape(issuer + ":" + account)
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", issuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(totpDigits))
+	params.Set("period", fmt.Sprint(totpPeriod))
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// ValidateTOTP provjerava odgovara li kod tajnom ključu u trenutku t.
+// Prihvaća i kodove susjednih koraka (±totpSkew).
+func ValidateTOTP(secret, code string, t time.Time) bool {
+	_, ok := MatchTOTP(secret, code, t)
+	return ok
+}
+
+// MatchTOTP provjerava kod kao ValidateTOTP i vraća vremenski korak kojem kod pripada.
+// Pozivatelj sprema zadnji prihvaćeni korak i odbija kodove koji nisu noviji od njega.
+func MatchTOTP(secret, code string, t time.Time) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return 0, false
+	}
+
+	counter := t.Unix() / totpPeriod
+	for i := -totpSkew; i <= totpSkew; i++ {
+		step := counter + int64(i)
+		expected := totpCode(key, uint64(step))
+		if hmac.Equal([]byte(expected), []byte(code)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// totpCode računa HOTP vrijednost (RFC 4226) za zadani brojač.
+func totpCode(key []byte, counter uint64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// recoveryAlphabet su znakovi recovery kodova (bez znakova koji se lako zamijene, npr. 0/o, 1/l/i).
+const recoveryAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// GenerateRecoveryCodes vraća n jednokratnih recovery kodova u obliku "xxxxx-xxxxx".
+func GenerateRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		var b strings.Builder
+		for j := 0; j < 10; j++ {
+			if j == 5 {
+				b.WriteByte('-')
+			}
+			c, err := randomRecoveryChar()
+			if err != nil {
+				return nil, fmt.Errorf("failed to generate recovery code: %w", err)
+			}
+			b.WriteByte(c)
+		}
+		codes = append(codes, b.String())
+	}
+	return codes, nil
+}
+
+// randomRecoveryChar vraća jednoliko nasumičan znak iz recoveryAlphabet.
+// Bajtovi iz zadnjeg nepotpunog kruga abecede (256 nije djeljivo s njenom duljinom) se odbacuju,
+// inače bi prvi znakovi abecede bili vjerojatniji od ostalih.
+func randomRecoveryChar() (byte, error) {
+	limit := 256 - 256%len(recoveryAlphabet)
+	var raw [1]byte
+	for {
+		if _, err := rand.Read(raw[:]); err != nil {
+			return 0, err
+		}
+		if int(raw[0]) < limit {
+			return recoveryAlphabet[int(raw[0])%len(recoveryAlphabet)], nil
+		}
+	}
+}
+
+// HashRecoveryCode vraća hash recovery koda u obliku $sha256$<sol>$<hash>.
+// Kodovi su nasumični (~50 bita), pa im ne treba spori KDF kao lozinkama —
+// argon2id bi pri svakom pokušaju prijave koštao do recoveryCodeCount skupih izračuna.
+func HashRecoveryCode(code string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to hash recovery code: %w", err)
+	}
+	return "$sha256$" + base64.RawStdEncoding.EncodeToString(salt) + "$" + recoveryCodeDigest(salt, code), nil
+}
+
+// CheckRecoveryCode uspoređuje recovery kod s hashom iz HashRecoveryCode.
+func CheckRecoveryCode(code, hash string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[1] != "sha256" {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	return hmac.Equal([]byte(recoveryCodeDigest(salt, code)), []byte(parts[3]))
+}
+
+// recoveryCodeDigest računa SHA-256 soli i koda.
+func recoveryCodeDigest(salt []byte, code string) string {
+	sum := sha256.Sum256(append(append([]byte{}, salt...), code...))
+	return base64.RawStdEncoding.EncodeToString(sum[:])
+}